@@ -0,0 +1,130 @@
+// Command apikey manages API keys for the users API.
+//
+//	go run ./cmd/apikey create [-role viewer|editor|admin] [-user <user id>] <name>
+//	go run ./cmd/apikey list
+//	go run ./cmd/apikey revoke <id>
+package main
+
+import (
+	"context"
+	"crud-app/pkg/auth"
+	"crud-app/pkg/config"
+	"crud-app/pkg/models"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  apikey create [-role viewer|editor|admin] [-user <user id>] <name>")
+	fmt.Fprintln(os.Stderr, "                         Create a key and print it once")
+	fmt.Fprintln(os.Stderr, "  apikey list            List keys")
+	fmt.Fprintln(os.Stderr, "  apikey revoke <id>     Revoke a key")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	if _, err := models.InitDatabase(config.Load().Database.Pool); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		os.Exit(1)
+	}
+	defer models.CloseDatabase()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var err error
+	switch os.Args[1] {
+	case "create":
+		err = create(ctx, os.Args[2:])
+	case "list":
+		err = list(ctx)
+	case "revoke":
+		if len(os.Args) != 3 {
+			usage()
+		}
+		err = revoke(ctx, os.Args[2])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func create(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("create", flag.ExitOnError)
+	roleName := flags.String("role", string(auth.RoleViewer), "role granted to the key")
+	userID := flags.Int("user", 0, "user ID the key acts as, for editing your own record")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	role, err := auth.ParseRole(*roleName)
+	if err != nil {
+		return err
+	}
+
+	var user *int
+	if *userID > 0 {
+		user = userID
+	}
+
+	key, apiKey, err := models.CreateAPIKey(ctx, flags.Arg(0), string(role), user)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created %s API key %d (%s)\n", apiKey.Role, apiKey.ID, apiKey.Name)
+	fmt.Printf("Key: %s\n", key)
+	fmt.Println("Store it now, it will not be shown again.")
+	return nil
+}
+
+func list(ctx context.Context) error {
+	keys, err := models.ListAPIKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPREFIX\tROLE\tUSER\tCREATED\tSTATUS")
+	for _, key := range keys {
+		user := "-"
+		if key.UserID != nil {
+			user = strconv.Itoa(*key.UserID)
+		}
+		status := "active"
+		if key.RevokedAt != nil {
+			status = "revoked " + key.RevokedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s…\t%s\t%s\t%s\t%s\n",
+			key.ID, key.Name, key.KeyPrefix, key.Role, user, key.CreatedAt.Format(time.RFC3339), status)
+	}
+	return w.Flush()
+}
+
+func revoke(ctx context.Context, arg string) error {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return fmt.Errorf("invalid key id %q", arg)
+	}
+
+	if err := models.RevokeAPIKey(ctx, id); err != nil {
+		return err
+	}
+
+	fmt.Printf("Revoked API key %d\n", id)
+	return nil
+}
@@ -3,62 +3,212 @@ package main
 import (
 	"context"
 	"crud-app/pkg/api"
+	"crud-app/pkg/cache"
+	"crud-app/pkg/config"
+	"crud-app/pkg/grpcserver"
+	"crud-app/pkg/lifecycle"
 	"crud-app/pkg/models"
+	"crud-app/pkg/outbox"
+	"crud-app/pkg/stream"
+	"crud-app/pkg/telemetry"
+	"crud-app/pkg/webhooks"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"os/signal"
 	"syscall"
-	"time"
 )
 
 func main() {
+	// Load configuration
+	cfg := config.Load()
+
+	// Components start in this order and stop in reverse, so the servers stop
+	// taking requests before the workers, cache and database go away
+	manager := lifecycle.New()
+
+	// Initialize tracing
+	var shutdownTracing func(context.Context) error
+	manager.Add(lifecycle.Component{
+		Name: "tracing",
+		Start: func(ctx context.Context) (err error) {
+			shutdownTracing, err = telemetry.Init(ctx, cfg.Telemetry)
+			return err
+		},
+		// Flush any buffered spans
+		Stop: func(ctx context.Context) error { return shutdownTracing(ctx) },
+	})
+
 	// Initialize database
-	_, err := models.InitDatabase()
-	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
-	}
+	manager.Add(lifecycle.Component{
+		Name: "database",
+		Start: func(ctx context.Context) error {
+			if _, err := models.InitDatabase(cfg.Database.Pool); err != nil {
+				return err
+			}
+			return models.InitReplicas(cfg.Database)
+		},
+		Stop: func(ctx context.Context) error { return models.CloseDatabase() },
+	})
 
-	// Setup router with all API routes
-	router := api.SetupRouter()
+	// Cache user lookups in front of the database
+	var userCacheStore cache.Store
+	manager.Add(lifecycle.Component{
+		Name: "cache",
+		Start: func(ctx context.Context) (err error) {
+			userCacheStore, err = cache.New(cfg.Cache)
+			if err != nil {
+				return err
+			}
+			models.SetUserCache(userCacheStore, cfg.Cache.TTL)
+			return nil
+		},
+		// Close the connection to a shared cache
+		Stop: func(ctx context.Context) error {
+			if closer, ok := userCacheStore.(io.Closer); ok {
+				return closer.Close()
+			}
+			return nil
+		},
+	})
 
-	// Print available routes
-	api.PrintRoutes()
+	// Warn when queries wait for database connections
+	manager.Add(lifecycle.Component{
+		Name: "pool monitor",
+		Run: func(ctx context.Context) error {
+			models.MonitorPools(ctx, cfg.Database.StatsInterval)
+			return nil
+		},
+	})
 
-	// Create HTTP server
-	server := &http.Server{
-		Addr:    ":8787",
-		Handler: router,
+	// Deliver user change events from the outbox in the background. Stopping
+	// lets it finish the batch it is delivering.
+	var dispatcher *outbox.Dispatcher
+	manager.Add(lifecycle.Component{
+		Name: "outbox dispatcher",
+		Start: func(ctx context.Context) error {
+			sinks, err := outbox.NewSinks(cfg.Outbox)
+			if err != nil {
+				return err
+			}
+			if cfg.Webhooks.Enabled {
+				sinks = append(sinks, webhooks.NewSink())
+			}
+			if len(sinks) == 0 {
+				fmt.Println("Warning: no outbox sinks configured, user change events will not be delivered")
+				return nil
+			}
+			dispatcher = outbox.NewDispatcher(sinks, cfg.Outbox)
+			return nil
+		},
+		Run: func(ctx context.Context) error {
+			if dispatcher != nil {
+				dispatcher.Run(ctx)
+			}
+			return nil
+		},
+		StopTimeout: cfg.Shutdown.WorkerTimeout,
+	})
+	if cfg.Webhooks.Enabled {
+		manager.Add(lifecycle.Component{
+			Name: "webhook worker",
+			Run: func(ctx context.Context) error {
+				webhooks.NewWorker(cfg.Webhooks).Run(ctx)
+				return nil
+			},
+			StopTimeout: cfg.Shutdown.WorkerTimeout,
+		})
 	}
 
-	// Start server in a goroutine
-	go func() {
-		fmt.Printf("Starting server on %s\n", server.Addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server error: %v", err)
-		}
-	}()
+	// Follow the outbox for the live user change stream
+	broker := stream.NewBroker(cfg.Stream.BufferSize)
+	manager.Add(lifecycle.Component{
+		Name: "stream",
+		Run: func(ctx context.Context) error {
+			stream.Tail(ctx, broker, cfg.Stream.PollInterval)
+			return nil
+		},
+		StopTimeout: cfg.Shutdown.WorkerTimeout,
+	})
+
+	// Serve the HTTP API. Binding the port at startup means a port that is
+	// already taken stops the server before it reports itself started.
+	var server *http.Server
+	var httpListener net.Listener
+	manager.Add(lifecycle.Component{
+		Name: "HTTP server",
+		Start: func(ctx context.Context) error {
+			// Setup router with all API routes
+			router, err := api.SetupRouter(cfg, broker)
+			if err != nil {
+				return err
+			}
 
-	// Wait for interrupt signal to gracefully shutdown the server
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+			// Print available routes
+			api.PrintRoutes(router)
 
-	fmt.Println("Shutting down server...")
+			server = &http.Server{
+				Addr:    ":8787",
+				Handler: router,
+			}
+			// Shutdown waits for open requests, so end event streams as soon as it starts
+			server.RegisterOnShutdown(broker.Close)
 
-	// Create a deadline for server shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+			httpListener, err = net.Listen("tcp", server.Addr)
+			return err
+		},
+		Run: func(ctx context.Context) error {
+			fmt.Printf("Starting server on %s\n", server.Addr)
+			if err := server.Serve(httpListener); err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		},
+		// Wait for open requests, then cut off any that are left
+		Stop: func(ctx context.Context) error {
+			if err := server.Shutdown(ctx); err != nil {
+				server.Close()
+				return fmt.Errorf("server forced to shutdown: %v", err)
+			}
+			return nil
+		},
+		StopTimeout: cfg.Shutdown.ServerTimeout,
+	})
 
-	// Attempt graceful shutdown
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Server forced to shutdown: %v", err)
+	// Serve the gRPC UserService on its own port
+	if cfg.GRPC.Enabled {
+		var grpcServer *grpcserver.Server
+		var grpcListener net.Listener
+		manager.Add(lifecycle.Component{
+			Name: "gRPC server",
+			Start: func(ctx context.Context) (err error) {
+				grpcServer, err = grpcserver.New(cfg)
+				if err != nil {
+					return err
+				}
+				grpcListener, err = net.Listen("tcp", cfg.GRPC.Addr)
+				return err
+			},
+			Run: func(ctx context.Context) error {
+				fmt.Printf("Starting gRPC server on %s\n", cfg.GRPC.Addr)
+				return grpcServer.Serve(grpcListener)
+			},
+			Stop: func(ctx context.Context) error {
+				grpcServer.Shutdown(ctx)
+				return nil
+			},
+			StopTimeout: cfg.Shutdown.ServerTimeout,
+		})
 	}
 
-	// Close database connection
-	if err := models.CloseDatabase(); err != nil {
-		log.Printf("Error closing database: %v", err)
+	// Shut down gracefully on SIGINT or SIGTERM, and straight away on a second one
+	ctx, stop := lifecycle.SignalContext(context.Background(), func() { os.Exit(1) }, syscall.SIGINT, syscall.SIGTERM)
+	err := manager.Run(ctx)
+	stop()
+	if err != nil {
+		log.Fatalf("Server error: %v", err)
 	}
 
 	fmt.Println("Server exited gracefully")
@@ -1,6 +1,9 @@
 -- This is just in case you are creating a new database
 -- This is just here for demo, in actual assignment things should
 -- only be handled via migrations
+--
+-- It is the schema after every migration in migrations/ has run, so keep
+-- it in step when adding one.
 
 CREATE DATABASE IF NOT EXISTS `test_db`;
 
@@ -11,5 +14,104 @@ CREATE TABLE `users` (
  `name` varchar(255) DEFAULT NULL,
  `address` varchar(255) DEFAULT NULL,
  `country` varchar(255) DEFAULT NULL,
+ `email` varchar(255) NULL DEFAULT NULL,
+ `password_hash` varchar(255) NULL DEFAULT NULL,
+ `role` varchar(16) NOT NULL DEFAULT 'viewer',
+ `updated_at` timestamp(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+ PRIMARY KEY (`id`),
+ UNIQUE KEY `uq_users_email` (`email`)
+);
+
+CREATE TABLE `api_keys` (
+ `id` int NOT NULL AUTO_INCREMENT,
+ `name` varchar(255) NOT NULL,
+ `key_prefix` varchar(16) NOT NULL,
+ `key_hash` char(64) NOT NULL,
+ `role` varchar(16) NOT NULL DEFAULT 'viewer',
+ `user_id` int NULL DEFAULT NULL,
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `revoked_at` timestamp NULL DEFAULT NULL,
+ PRIMARY KEY (`id`),
+ UNIQUE KEY `uq_api_keys_key_hash` (`key_hash`)
+);
+
+CREATE TABLE `sessions` (
+ `token_hash` char(64) NOT NULL,
+ `user_id` int NOT NULL,
+ `csrf_token` char(43) NOT NULL,
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `expires_at` timestamp NOT NULL,
+ PRIMARY KEY (`token_hash`),
+ KEY `idx_sessions_user_id` (`user_id`),
+ CONSTRAINT `fk_sessions_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+
+CREATE TABLE `password_resets` (
+ `token_hash` char(64) NOT NULL,
+ `user_id` int NOT NULL,
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `expires_at` timestamp NOT NULL,
+ `used_at` timestamp NULL DEFAULT NULL,
+ PRIMARY KEY (`token_hash`),
+ CONSTRAINT `fk_password_resets_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+
+CREATE TABLE `idempotency_keys` (
+ `key_hash` char(64) NOT NULL,
+ `request_hash` char(64) NOT NULL,
+ `status_code` int NULL DEFAULT NULL,
+ `content_type` varchar(255) NULL DEFAULT NULL,
+ `response_body` mediumblob NULL,
+ `locked_until` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `expires_at` timestamp NOT NULL,
+ PRIMARY KEY (`key_hash`),
+ KEY `idx_idempotency_keys_expires_at` (`expires_at`)
+);
+
+CREATE TABLE `outbox_events` (
+ `id` bigint NOT NULL AUTO_INCREMENT,
+ `event_type` varchar(64) NOT NULL,
+ `user_id` int NOT NULL,
+ `payload` json NOT NULL,
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `attempts` int NOT NULL DEFAULT 0,
+ `next_attempt_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `last_error` text NULL,
+ `delivered_at` timestamp NULL DEFAULT NULL,
+ `failed_at` timestamp NULL DEFAULT NULL,
+ PRIMARY KEY (`id`),
+ KEY `idx_outbox_events_pending` (`delivered_at`, `failed_at`, `next_attempt_at`),
+ KEY `idx_outbox_events_type_created` (`event_type`, `created_at`)
+);
+
+CREATE TABLE `webhooks` (
+ `id` int NOT NULL AUTO_INCREMENT,
+ `url` varchar(2048) NOT NULL,
+ `secret` varchar(64) NOT NULL,
+ `events` varchar(255) NOT NULL,
+ `active` tinyint(1) NOT NULL DEFAULT 1,
+ `consecutive_failures` int NOT NULL DEFAULT 0,
+ `disabled_at` timestamp NULL DEFAULT NULL,
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
  PRIMARY KEY (`id`)
-);
\ No newline at end of file
+);
+
+CREATE TABLE `webhook_deliveries` (
+ `id` bigint NOT NULL AUTO_INCREMENT,
+ `webhook_id` int NOT NULL,
+ `event_id` bigint NOT NULL,
+ `event_type` varchar(64) NOT NULL,
+ `payload` json NOT NULL,
+ `status` varchar(16) NOT NULL DEFAULT 'pending',
+ `attempts` int NOT NULL DEFAULT 0,
+ `next_attempt_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `last_status_code` int NULL DEFAULT NULL,
+ `last_error` text NULL,
+ `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ `delivered_at` timestamp NULL DEFAULT NULL,
+ PRIMARY KEY (`id`),
+ UNIQUE KEY `uq_webhook_deliveries_event` (`webhook_id`, `event_id`),
+ KEY `idx_webhook_deliveries_due` (`status`, `next_attempt_at`),
+ CONSTRAINT `fk_webhook_deliveries_webhook` FOREIGN KEY (`webhook_id`) REFERENCES `webhooks` (`id`) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+USE `test_db`;
+DROP TABLE IF EXISTS `api_keys`;
\ No newline at end of file
@@ -0,0 +1,12 @@
+USE `test_db`;
+
+CREATE TABLE IF NOT EXISTS `api_keys` (
+    `id` int NOT NULL AUTO_INCREMENT,
+    `name` varchar(255) NOT NULL,
+    `key_prefix` varchar(16) NOT NULL,
+    `key_hash` char(64) NOT NULL,
+    `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `revoked_at` timestamp NULL DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uq_api_keys_key_hash` (`key_hash`)
+);
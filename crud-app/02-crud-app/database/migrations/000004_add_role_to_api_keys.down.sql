@@ -0,0 +1,2 @@
+USE `test_db`;
+ALTER TABLE `api_keys` DROP COLUMN `user_id`, DROP COLUMN `role`;
\ No newline at end of file
@@ -0,0 +1,5 @@
+USE `test_db`;
+
+ALTER TABLE `api_keys`
+    ADD COLUMN `role` varchar(16) NOT NULL DEFAULT 'viewer' AFTER `key_hash`,
+    ADD COLUMN `user_id` int NULL DEFAULT NULL AFTER `role`;
@@ -0,0 +1,4 @@
+USE `test_db`;
+DROP TABLE IF EXISTS `password_resets`;
+DROP TABLE IF EXISTS `sessions`;
+ALTER TABLE `users` DROP KEY `uq_users_email`, DROP COLUMN `role`, DROP COLUMN `password_hash`, DROP COLUMN `email`;
\ No newline at end of file
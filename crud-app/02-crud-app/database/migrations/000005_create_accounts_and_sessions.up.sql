@@ -0,0 +1,28 @@
+USE `test_db`;
+
+ALTER TABLE `users`
+    ADD COLUMN `email` varchar(255) NULL DEFAULT NULL,
+    ADD COLUMN `password_hash` varchar(255) NULL DEFAULT NULL,
+    ADD COLUMN `role` varchar(16) NOT NULL DEFAULT 'viewer',
+    ADD UNIQUE KEY `uq_users_email` (`email`);
+
+CREATE TABLE IF NOT EXISTS `sessions` (
+    `token_hash` char(64) NOT NULL,
+    `user_id` int NOT NULL,
+    `csrf_token` char(43) NOT NULL,
+    `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `expires_at` timestamp NOT NULL,
+    PRIMARY KEY (`token_hash`),
+    KEY `idx_sessions_user_id` (`user_id`),
+    CONSTRAINT `fk_sessions_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS `password_resets` (
+    `token_hash` char(64) NOT NULL,
+    `user_id` int NOT NULL,
+    `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `expires_at` timestamp NOT NULL,
+    `used_at` timestamp NULL DEFAULT NULL,
+    PRIMARY KEY (`token_hash`),
+    CONSTRAINT `fk_password_resets_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+USE `test_db`;
+DROP TABLE IF EXISTS `idempotency_keys`;
\ No newline at end of file
@@ -0,0 +1,13 @@
+USE `test_db`;
+
+CREATE TABLE IF NOT EXISTS `idempotency_keys` (
+    `key_hash` char(64) NOT NULL,
+    `request_hash` char(64) NOT NULL,
+    `status_code` int NULL DEFAULT NULL,
+    `content_type` varchar(255) NULL DEFAULT NULL,
+    `response_body` mediumblob NULL,
+    `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `expires_at` timestamp NOT NULL,
+    PRIMARY KEY (`key_hash`),
+    KEY `idx_idempotency_keys_expires_at` (`expires_at`)
+);
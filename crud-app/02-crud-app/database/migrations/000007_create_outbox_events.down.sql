@@ -0,0 +1,2 @@
+USE `test_db`;
+DROP TABLE IF EXISTS `outbox_events`;
\ No newline at end of file
@@ -0,0 +1,16 @@
+USE `test_db`;
+
+CREATE TABLE IF NOT EXISTS `outbox_events` (
+    `id` bigint NOT NULL AUTO_INCREMENT,
+    `event_type` varchar(64) NOT NULL,
+    `user_id` int NOT NULL,
+    `payload` json NOT NULL,
+    `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `attempts` int NOT NULL DEFAULT 0,
+    `next_attempt_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `last_error` text NULL,
+    `delivered_at` timestamp NULL DEFAULT NULL,
+    `failed_at` timestamp NULL DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    KEY `idx_outbox_events_pending` (`delivered_at`, `failed_at`, `next_attempt_at`)
+);
@@ -0,0 +1,3 @@
+USE `test_db`;
+DROP TABLE IF EXISTS `webhook_deliveries`;
+DROP TABLE IF EXISTS `webhooks`;
\ No newline at end of file
@@ -0,0 +1,32 @@
+USE `test_db`;
+
+CREATE TABLE IF NOT EXISTS `webhooks` (
+    `id` int NOT NULL AUTO_INCREMENT,
+    `url` varchar(2048) NOT NULL,
+    `secret` varchar(64) NOT NULL,
+    `events` varchar(255) NOT NULL,
+    `active` tinyint(1) NOT NULL DEFAULT 1,
+    `consecutive_failures` int NOT NULL DEFAULT 0,
+    `disabled_at` timestamp NULL DEFAULT NULL,
+    `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `webhook_deliveries` (
+    `id` bigint NOT NULL AUTO_INCREMENT,
+    `webhook_id` int NOT NULL,
+    `event_id` bigint NOT NULL,
+    `event_type` varchar(64) NOT NULL,
+    `payload` json NOT NULL,
+    `status` varchar(16) NOT NULL DEFAULT 'pending',
+    `attempts` int NOT NULL DEFAULT 0,
+    `next_attempt_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `last_status_code` int NULL DEFAULT NULL,
+    `last_error` text NULL,
+    `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `delivered_at` timestamp NULL DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uq_webhook_deliveries_event` (`webhook_id`, `event_id`),
+    KEY `idx_webhook_deliveries_due` (`status`, `next_attempt_at`),
+    CONSTRAINT `fk_webhook_deliveries_webhook` FOREIGN KEY (`webhook_id`) REFERENCES `webhooks` (`id`) ON DELETE CASCADE
+);
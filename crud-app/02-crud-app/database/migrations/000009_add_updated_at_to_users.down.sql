@@ -0,0 +1,3 @@
+USE `test_db`;
+
+ALTER TABLE `users` DROP COLUMN `updated_at`;
@@ -0,0 +1,5 @@
+USE `test_db`;
+
+-- Millisecond precision so ETags change even when a user is updated twice in a second
+ALTER TABLE `users`
+    ADD COLUMN `updated_at` timestamp(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3);
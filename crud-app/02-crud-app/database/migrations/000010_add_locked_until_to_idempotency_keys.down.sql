@@ -0,0 +1,3 @@
+USE `test_db`;
+
+ALTER TABLE `idempotency_keys` DROP COLUMN `locked_until`;
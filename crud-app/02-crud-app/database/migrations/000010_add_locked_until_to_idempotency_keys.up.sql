@@ -0,0 +1,6 @@
+USE `test_db`;
+
+-- A reservation whose request never finished (e.g. the process died) can be
+-- reclaimed by a retry once its lock has run out
+ALTER TABLE `idempotency_keys`
+    ADD COLUMN `locked_until` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP AFTER `response_body`;
@@ -0,0 +1,3 @@
+USE `test_db`;
+
+ALTER TABLE `outbox_events` DROP KEY `idx_outbox_events_type_created`;
@@ -0,0 +1,5 @@
+USE `test_db`;
+
+-- Lets GET /users find the latest deletion without scanning the outbox
+ALTER TABLE `outbox_events`
+    ADD KEY `idx_outbox_events_type_created` (`event_type`, `created_at`);
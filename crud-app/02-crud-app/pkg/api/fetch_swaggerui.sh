@@ -0,0 +1,17 @@
+#!/bin/sh
+# Vendors the Swagger UI assets served under /docs, so the docs page doesn't
+# load scripts from a CDN at runtime. Run via go generate ./pkg/api and
+# commit the result.
+set -eu
+
+VERSION=5.17.14
+DEST=swaggerui
+
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+curl -fsSL "https://registry.npmjs.org/swagger-ui-dist/-/swagger-ui-dist-$VERSION.tgz" | tar -xz -C "$tmp"
+for f in swagger-ui.css swagger-ui-bundle.js LICENSE; do
+	cp "$tmp/package/$f" "$DEST/$f"
+done
+echo "$VERSION" > "$DEST/VERSION"
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"crud-app/pkg/authz"
+	"crud-app/pkg/middleware"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// routeGroup registers routes on a router with a shared middleware stack.
+// Groups can share a path prefix while using different stacks.
+type routeGroup struct {
+	router *mux.Router
+	chain  middleware.Chain
+}
+
+// newGroup creates a route group on router with the given middlewares
+func newGroup(router *mux.Router, middlewares ...middleware.Middleware) *routeGroup {
+	return &routeGroup{router: router, chain: middleware.New(middlewares...)}
+}
+
+// HandleFunc registers f for path, wrapped in the group's middleware stack
+func (g *routeGroup) HandleFunc(path string, f http.HandlerFunc) *mux.Route {
+	return g.router.Handle(path, g.chain.ThenFunc(f))
+}
+
+// With returns a copy of the group whose routes also run middlewares,
+// after the group's own stack
+func (g *routeGroup) With(middlewares ...middleware.Middleware) *routeGroup {
+	return &routeGroup{router: g.router, chain: g.chain.Append(middlewares...)}
+}
+
+// Authorize returns a copy of the group whose routes also enforce pol.
+// The group's stack must authenticate requests before this runs.
+func (g *routeGroup) Authorize(pol authz.Policy) *routeGroup {
+	return g.With(authz.Require(pol))
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContentNegotiation(t *testing.T) {
+	router := newTestRouter(t)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		accept      string
+		status      int
+		contentType string
+	}{
+		{"refused before the handler runs", "DELETE", "/users/delete/x", "text/html", http.StatusNotAcceptable, "application/json"},
+		{"errors in XML", "DELETE", "/users/delete/x", "application/xml", http.StatusBadRequest, "application/xml"},
+		{"errors in MessagePack", "DELETE", "/users/delete/x", "application/msgpack", http.StatusBadRequest, "application/msgpack"},
+		{"CSV errors fall back to JSON", "DELETE", "/users/delete/x", "text/csv", http.StatusBadRequest, "application/json"},
+		{"GraphQL is always JSON", "GET", "/graphql", "application/xml", http.StatusBadRequest, "application/json"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req.Header.Set("Authorization", "Bearer "+signTestToken(t, "1", "admin"))
+			req.Header.Set("Accept", tc.accept)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tc.status || w.Header().Get("Content-Type") != tc.contentType {
+				t.Errorf("got %d %s, want %d %s", w.Code, w.Header().Get("Content-Type"), tc.status, tc.contentType)
+			}
+			if tc.contentType == "application/xml" && !strings.Contains(w.Body.String(), "<error>") {
+				t.Errorf("XML body = %s", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+//go:generate sh fetch_swaggerui.sh
+
+import (
+	"crud-app/pkg/middleware"
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// openAPISpec is the OpenAPI 3.1 document describing the users API.
+// Keep it in sync with SetupRouter; TestOpenAPISpecMatchesRouter checks this.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// swaggerUI holds a Swagger UI page that loads openAPISpec, along with the
+// Swagger UI assets vendored by fetch_swaggerui.sh
+//
+//go:embed swaggerui
+var swaggerUI embed.FS
+
+// docsSecurityHeaders lets the docs page load its own scripts, styles and
+// the inline images Swagger UI uses, and nothing else
+var docsSecurityHeaders = middleware.SecurityHeadersOptions{
+	ContentSecurityPolicy: "default-src 'self'; img-src 'self' data:; frame-ancestors 'none'",
+	HSTS:                  true,
+}
+
+// openAPIHandler handles GET /openapi.json
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// docsHandler handles GET /docs
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := swaggerUI.ReadFile("swaggerui/index.html")
+	if err != nil {
+		middleware.WriteError(w, http.StatusInternalServerError, "Error loading docs")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+// docsAssetsHandler handles GET /docs/{file}
+func docsAssetsHandler() http.Handler {
+	assets, _ := fs.Sub(swaggerUI, "swaggerui")
+	return http.StripPrefix("/docs/", http.FileServer(http.FS(assets)))
+}
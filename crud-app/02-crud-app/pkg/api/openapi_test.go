@@ -0,0 +1,106 @@
+package api
+
+import (
+	"crud-app/pkg/config"
+	"crud-app/pkg/stream"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// undocumentedRoutes are served by the router but intentionally left out of the spec
+var undocumentedRoutes = map[string]bool{
+	"GET /openapi.json": true,
+	"GET /docs":         true,
+	"GET /docs/{file}":  true,
+	"GET /_routes":      true,
+}
+
+func TestOpenAPISpecMatchesRouter(t *testing.T) {
+	router, err := SetupRouter(&config.Config{Debug: true, Mailer: config.MailerConfig{Driver: "log"}}, stream.NewBroker(0))
+	if err != nil {
+		t.Fatalf("SetupRouter: %v", err)
+	}
+
+	registered := map[string]bool{}
+	for _, route := range ListRoutes(router) {
+		for _, method := range route.Methods {
+			key := method + " " + route.Path
+			if !undocumentedRoutes[key] {
+				registered[key] = true
+			}
+		}
+	}
+
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("invalid openapi.json: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.1") {
+		t.Errorf("openapi version = %q, want 3.1.x", spec.OpenAPI)
+	}
+
+	documented := map[string]bool{}
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			if method == "parameters" || method == "summary" || method == "description" {
+				continue
+			}
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	for _, key := range sortedKeys(registered) {
+		if !documented[key] {
+			t.Errorf("route %s is registered but missing from openapi.json", key)
+		}
+	}
+	for _, key := range sortedKeys(documented) {
+		if !registered[key] {
+			t.Errorf("route %s is documented in openapi.json but not registered", key)
+		}
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestDocsLoadNothingFromOtherOrigins(t *testing.T) {
+	router, err := SetupRouter(&config.Config{Mailer: config.MailerConfig{Driver: "log"}}, stream.NewBroker(0))
+	if err != nil {
+		t.Fatalf("SetupRouter: %v", err)
+	}
+
+	for path, contentType := range map[string]string{
+		"/docs":         "text/html; charset=utf-8",
+		"/docs/init.js": "text/javascript; charset=utf-8",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d", path, w.Code)
+		}
+		if got := w.Header().Get("Content-Type"); got != contentType {
+			t.Errorf("GET %s: Content-Type = %q, want %q", path, got, contentType)
+		}
+		if csp := w.Header().Get("Content-Security-Policy"); !strings.HasPrefix(csp, "default-src 'self';") || strings.Contains(csp, "http") {
+			t.Errorf("GET %s: CSP = %q, want only 'self'", path, csp)
+		}
+		if strings.Contains(w.Body.String(), "https://") {
+			t.Errorf("GET %s references another origin:\n%s", path, w.Body)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"crud-app/pkg/auth"
+	"crud-app/pkg/authz"
+	"crud-app/pkg/config"
+	"crud-app/pkg/stream"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testJWTSecret = "policy-test-secret"
+
+// policyTable lists who may call each mutating route. Allowed requests carry
+// an invalid body or ID so they stop at validation instead of the database.
+var policyTable = []struct {
+	name    string
+	role    string // "" for an anonymous request
+	subject string
+	method  string
+	path    string
+	allowed bool
+}{
+	{"anonymous create", "", "", "POST", "/users/add", false},
+	{"viewer create", "viewer", "7", "POST", "/users/add", false},
+	{"self-registered create", string(auth.RoleRegistered), "7", "POST", "/users/add", false},
+	{"editor create", "editor", "7", "POST", "/users/add", true},
+	{"admin create", "admin", "7", "POST", "/users/add", true},
+
+	{"viewer update own", "viewer", "7", "PUT", "/users/update/7", true},
+	{"viewer update other", "viewer", "7", "PUT", "/users/update/8", false},
+	{"viewer without user update", "viewer", "ci-bot", "PUT", "/users/update/7", false},
+	{"editor update own", "editor", "7", "PUT", "/users/update/7", true},
+	{"editor update other", "editor", "7", "PUT", "/users/update/8", false},
+	{"editor without user update", "editor", "ci-bot", "PUT", "/users/update/7", false},
+	{"admin update other", "admin", "7", "PUT", "/users/update/8", true},
+
+	{"viewer patch own", "viewer", "7", "PATCH", "/users/update/7", true},
+	{"viewer patch other", "viewer", "7", "PATCH", "/users/update/8", false},
+	{"editor patch own", "editor", "7", "PATCH", "/users/update/7", true},
+	{"editor patch other", "editor", "7", "PATCH", "/users/update/8", false},
+	{"admin patch other", "admin", "7", "PATCH", "/users/update/8", true},
+
+	{"viewer delete own", "viewer", "7", "DELETE", "/users/delete/7", false},
+	{"editor delete own", "editor", "7", "DELETE", "/users/delete/x", false},
+	{"admin delete", "admin", "7", "DELETE", "/users/delete/x", true},
+
+	{"anonymous export", "", "", "GET", "/users/export?format=xml", false},
+	{"editor export", "editor", "7", "GET", "/users/export?format=xml", false},
+	{"admin export", "admin", "7", "GET", "/users/export?format=xml", true},
+	{"editor import", "editor", "7", "POST", "/users/import", false},
+	{"admin import", "admin", "7", "POST", "/users/import", true},
+
+	{"anonymous create webhook", "", "", "POST", "/webhooks", false},
+	{"editor create webhook", "editor", "7", "POST", "/webhooks", false},
+	{"admin create webhook", "admin", "7", "POST", "/webhooks", true},
+	{"editor delete webhook", "editor", "7", "DELETE", "/webhooks/x", false},
+	{"admin delete webhook", "admin", "7", "DELETE", "/webhooks/x", true},
+
+	{"anonymous metrics", "", "", "GET", "/debug/vars", false},
+	{"editor metrics", "editor", "7", "GET", "/debug/vars", false},
+	{"admin metrics", "admin", "7", "GET", "/debug/vars", true},
+}
+
+func TestRoutePolicies(t *testing.T) {
+	router := newTestRouter(t)
+
+	for _, tc := range policyTable {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader("not json"))
+			if tc.role != "" {
+				req.Header.Set("Authorization", "Bearer "+signTestToken(t, tc.subject, tc.role))
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			denied := w.Code == http.StatusUnauthorized || w.Code == http.StatusForbidden
+			if denied == tc.allowed {
+				t.Errorf("%s %s as %s: status %d, allowed = %v", tc.method, tc.path, tc.role, w.Code, tc.allowed)
+			}
+		})
+	}
+}
+
+// sharedPolicies are the authz policies GraphQL and gRPC apply to the same
+// changes as these routes
+var sharedPolicies = map[string]authz.Policy{
+	"POST /users/add":      authz.Editors,
+	"PUT /users/update":    authz.OwnerOrAdmin,
+	"PATCH /users/update":  authz.OwnerOrAdmin,
+	"DELETE /users/delete": authz.Admins,
+}
+
+// TestSharedPoliciesMatchRoutes checks the policies GraphQL and gRPC use
+// against the same table as the REST routes
+func TestSharedPoliciesMatchRoutes(t *testing.T) {
+	checked := 0
+	for _, tc := range policyTable {
+		dir, id := path.Split(tc.path)
+		pol, ok := sharedPolicies[tc.method+" "+strings.TrimSuffix(dir, "/")]
+		if !ok {
+			continue
+		}
+		checked++
+
+		var principal *auth.Principal
+		if tc.role != "" {
+			userID, _ := strconv.Atoi(tc.subject)
+			principal = &auth.Principal{Subject: tc.subject, Role: auth.Role(tc.role), UserID: userID}
+		}
+		if got := pol.Allows(principal, map[string]string{"id": id}); got != tc.allowed {
+			t.Errorf("%s: shared policy allows = %v, want %v", tc.name, got, tc.allowed)
+		}
+	}
+	if checked == 0 {
+		t.Fatal("no rows in policyTable matched a shared policy")
+	}
+}
+
+func TestBadCredentialsAreRateLimited(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.RateLimit = config.RateLimitConfig{
+		Enabled:     true,
+		Read:        config.RateLimit{Rate: 100, Burst: 100},
+		Write:       config.RateLimit{Rate: 100, Burst: 100},
+		Credentials: config.RateLimit{Rate: 0.001, Burst: 2},
+	}
+	router, err := SetupRouter(cfg, stream.NewBroker(0))
+	if err != nil {
+		t.Fatalf("SetupRouter: %v", err)
+	}
+
+	// Guesses on different routes share the per-address bucket
+	var codes []int
+	for _, route := range [][2]string{{"DELETE", "/users/delete/x"}, {"GET", "/users/export"}, {"DELETE", "/users/delete/x"}} {
+		req := httptest.NewRequest(route[0], route[1], nil)
+		req.Header.Set("Authorization", "Bearer not-a-token")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+
+	want := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("statuses = %v, want %v", codes, want)
+		}
+	}
+}
+
+// newTestConfig configures auth but no database
+func newTestConfig() *config.Config {
+	cfg := &config.Config{
+		Auth:   config.AuthConfig{JWTSecret: testJWTSecret},
+		Mailer: config.MailerConfig{Driver: "log"},
+	}
+	cfg.HTTP.RequestTimeout = time.Second
+	cfg.HTTP.AdminRequestTimeout = time.Second
+	return cfg
+}
+
+// newTestRouter sets up the router with auth but no database
+func newTestRouter(t *testing.T) http.Handler {
+	router, err := SetupRouter(newTestConfig(), stream.NewBroker(0))
+	if err != nil {
+		t.Fatalf("SetupRouter: %v", err)
+	}
+	return router
+}
+
+func signTestToken(t *testing.T, subject, role string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  subject,
+		"role": role,
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	})
+	signed, err := token.SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return signed
+}
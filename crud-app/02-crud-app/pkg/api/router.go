@@ -1,29 +1,194 @@
 package api
 
 import (
+	"crud-app/pkg/auth"
+	"crud-app/pkg/authz"
+	"crud-app/pkg/config"
 	"crud-app/pkg/controllers"
+	"crud-app/pkg/idempotency"
+	"crud-app/pkg/mailer"
+	"crud-app/pkg/middleware"
+	"crud-app/pkg/ratelimit"
+	"crud-app/pkg/stream"
+	"crud-app/pkg/telemetry"
+	"expvar"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
-// SetupRouter configures and returns a new router with all API routes
-func SetupRouter() *mux.Router {
+// SetupRouter configures and returns a new router with all API routes.
+// broker feeds the user change stream; closing it ends open streams.
+func SetupRouter(cfg *config.Config, broker *stream.Broker) (*mux.Router, error) {
 	router := mux.NewRouter()
 
+	authenticator, err := auth.NewAuthenticator(cfg.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up authentication: %v", err)
+	}
+
+	// Global middleware, applied to every matched route in this order
+	router.Use(
+		middleware.RequestID(),
+		middleware.Recover(),
+		// Start a server span for every request, continuing any incoming traceparent
+		otelmux.Middleware(telemetry.TracerName),
+		middleware.Logger(),
+		middleware.ReadYourWrites(),
+		middleware.CORS(middleware.CORSOptions{
+			AllowedOrigins: cfg.HTTP.CORSAllowedOrigins,
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowedHeaders: []string{
+				"Content-Type", "Authorization", auth.APIKeyHeader, auth.CSRFHeader, middleware.RequestIDHeader, idempotency.Header,
+				"If-None-Match", "If-Modified-Since", middleware.ConsistencyHeader,
+			},
+			ExposedHeaders: []string{
+				middleware.RequestIDHeader, controllers.NextCursorHeader, idempotency.ReplayedHeader, "Link", "Retry-After", "ETag",
+				"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+			},
+			MaxAge: 10 * time.Minute,
+		}),
+	)
+
+	// Answer CORS preflight requests for any path
+	router.PathPrefix("/").Methods("OPTIONS").HandlerFunc(preflightHandler)
+
+	mail, err := mailer.New(cfg.Mailer)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up mailer: %v", err)
+	}
+
+	// Per-client rate limits. Routes that share a name share a bucket.
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore())
+	limit := func(name string, l config.RateLimit) middleware.Middleware {
+		if !cfg.RateLimit.Enabled {
+			return func(next http.Handler) http.Handler { return next }
+		}
+		return limiter.Limit(name, ratelimit.Limit{Rate: l.Rate, Burst: l.Burst})
+	}
+	// The per-client limits run after authentication, so they can't stop
+	// anyone guessing credentials. This one runs before it, per IP address.
+	checkCredentials := func(authenticate middleware.Middleware) middleware.Chain {
+		if !cfg.RateLimit.Enabled {
+			return middleware.New(authenticate)
+		}
+		l := cfg.RateLimit.Credentials
+		return middleware.New(limiter.LimitAddr("credentials", ratelimit.Limit{Rate: l.Rate, Burst: l.Burst}), authenticate)
+	}
+
+	// Middleware stacks for public, account and admin routes
+	publicStack := middleware.New(
+		middleware.SecurityHeaders(middleware.DefaultSecurityHeaders),
+		middleware.Compress(),
+		middleware.Timeout(cfg.HTTP.RequestTimeout),
+	)
+	accountStack := middleware.New(
+		middleware.SecurityHeaders(middleware.DefaultSecurityHeaders),
+		middleware.Negotiate(),
+		middleware.Timeout(cfg.HTTP.AdminRequestTimeout),
+	)
+	adminStack := accountStack.Append(checkCredentials(authenticator.Require())...)
+
+	// Reads are public unless AUTH_PROTECT_READS is set
+	readAuth := checkCredentials(authenticator.Optional())
+	if cfg.Auth.ProtectReads {
+		readAuth = checkCredentials(authenticator.Require())
+	}
+
+	// Route groups with their own middleware stacks
+	public := newGroup(router, publicStack...)
+	reads := newGroup(router, publicStack.Append(middleware.Negotiate()).Append(readAuth...)...)
+	// GraphQL always answers in JSON, so it skips content negotiation
+	graphQLReads := newGroup(router, publicStack.Append(readAuth...)...)
+	accounts := newGroup(router, accountStack...)
+	admin := newGroup(router, adminStack...)
+	// Streams stay open indefinitely, so they skip the timeout and compression
+	streams := newGroup(router, middleware.New(
+		middleware.SecurityHeaders(middleware.DefaultSecurityHeaders),
+	).Append(readAuth...)...)
+	// Bulk exports and imports can take longer than any timeout, so they skip it
+	bulk := newGroup(router, middleware.New(
+		middleware.SecurityHeaders(middleware.DefaultSecurityHeaders),
+		middleware.Compress(),
+	).Append(checkCredentials(authenticator.Require())...)...)
+	docs := newGroup(router,
+		middleware.SecurityHeaders(docsSecurityHeaders),
+		middleware.Compress(),
+	)
+
+	userReads := reads.With(limit("users.read", cfg.RateLimit.Read))
+	userWrites := admin.With(limit("users.write", cfg.RateLimit.Write))
+	authAttempts := accounts.With(limit("auth", cfg.RateLimit.Auth))
+	userStreams := streams.With(limit("users.stream", cfg.RateLimit.Read))
+	userBulk := bulk.With(limit("users.bulk", cfg.RateLimit.Write))
+
 	// Initialize controllers
-	userController := controllers.NewUserController()
+	userController := controllers.NewUserController(cfg.HTTP.CacheMaxAge, cfg.Auth.ProtectReads)
+	authController := controllers.NewAuthController(mail, cfg.Auth)
+	webhookController := controllers.NewWebhookController()
+	streamController := controllers.NewStreamController(broker, cfg.Stream.Heartbeat)
+	wsController := controllers.NewWebSocketController(broker, cfg.Stream, cfg.HTTP.CORSAllowedOrigins)
+	graphQLController, err := controllers.NewGraphQLController(cfg.GraphQL)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up GraphQL: %v", err)
+	}
 
 	// Define routes
-	router.HandleFunc("/", homeHandler).Methods("GET")
-	router.HandleFunc("/users", userController.GetUsers).Methods("GET")
-	router.HandleFunc("/users/{id}", userController.GetUser).Methods("GET")
-	router.HandleFunc("/users/add", userController.CreateUser).Methods("POST")
-	router.HandleFunc("/users/update/{id}", userController.UpdateUser).Methods("PUT")
-	router.HandleFunc("/users/delete/{id}", userController.DeleteUser).Methods("DELETE")
-
-	return router
+	public.HandleFunc("/", homeHandler).Methods("GET")
+	userReads.HandleFunc("/users", userController.GetUsers).Methods("GET")
+	// Registered before /users/{id}, which would otherwise match them
+	userStreams.HandleFunc("/users/stream", streamController.StreamUsers).Methods("GET")
+	userStreams.HandleFunc("/users/ws", wsController.StreamUsers).Methods("GET")
+	userBulk.Authorize(authz.Admins).HandleFunc("/users/export", userController.ExportUsers).Methods("GET")
+	userReads.HandleFunc("/users/{id}", userController.GetUser).Methods("GET")
+	userWrites.Authorize(authz.Editors).
+		With(idempotency.Middleware(cfg.HTTP.IdempotencyKeyTTL, cfg.HTTP.IdempotencyLockTTL)).
+		HandleFunc("/users/add", userController.CreateUser).Methods("POST")
+	userWrites.Authorize(authz.OwnerOrAdmin).HandleFunc("/users/update/{id}", userController.UpdateUser).Methods("PUT")
+	userWrites.Authorize(authz.OwnerOrAdmin).HandleFunc("/users/update/{id}", userController.PatchUser).Methods("PATCH")
+	userWrites.Authorize(authz.Admins).HandleFunc("/users/delete/{id}", userController.DeleteUser).Methods("DELETE")
+	userBulk.Authorize(authz.Admins).With(middleware.Negotiate()).HandleFunc("/users/import", userController.ImportUsers).Methods("POST")
+
+	// GraphQL. Reads follow the same rules as GET /users; mutations check the
+	// caller's role themselves, as the REST routes' policies do, and share
+	// the REST routes' write limit.
+	graphQLController.WrapMutations(limit("users.write", cfg.RateLimit.Write))
+	graphQL := graphQLReads.With(limit("graphql", cfg.RateLimit.Read))
+	graphQL.HandleFunc("/graphql", graphQLController.Serve).Methods("GET", "POST")
+
+	// Accounts and sessions
+	authAttempts.HandleFunc("/auth/register", authController.Register).Methods("POST")
+	authAttempts.HandleFunc("/auth/login", authController.Login).Methods("POST")
+	authAttempts.HandleFunc("/auth/password-reset", authController.RequestPasswordReset).Methods("POST")
+	authAttempts.HandleFunc("/auth/password-reset/confirm", authController.ConfirmPasswordReset).Methods("POST")
+	admin.HandleFunc("/auth/logout", authController.Logout).Methods("POST")
+
+	// Webhook subscriptions
+	webhookAdmin := admin.With(limit("webhooks", cfg.RateLimit.Write)).Authorize(authz.Admins)
+	webhookAdmin.HandleFunc("/webhooks", webhookController.CreateWebhook).Methods("POST")
+	webhookAdmin.HandleFunc("/webhooks", webhookController.GetWebhooks).Methods("GET")
+	webhookAdmin.HandleFunc("/webhooks/{id}", webhookController.GetWebhook).Methods("GET")
+	webhookAdmin.HandleFunc("/webhooks/{id}", webhookController.DeleteWebhook).Methods("DELETE")
+	webhookAdmin.HandleFunc("/webhooks/{id}/enable", webhookController.EnableWebhook).Methods("POST")
+	webhookAdmin.HandleFunc("/webhooks/{id}/deliveries", webhookController.GetWebhookDeliveries).Methods("GET")
+
+	// Runtime metrics, including user cache hits and misses
+	admin.Authorize(authz.Admins).HandleFunc("/debug/vars", expvar.Handler().ServeHTTP).Methods("GET")
+
+	// API documentation
+	docs.HandleFunc("/openapi.json", openAPIHandler).Methods("GET")
+	docs.HandleFunc("/docs", docsHandler).Methods("GET")
+	docs.HandleFunc("/docs/{file}", docsAssetsHandler().ServeHTTP).Methods("GET")
+
+	// Debug-only endpoints
+	if cfg.Debug {
+		public.HandleFunc("/_routes", routesHandler(router)).Methods("GET")
+	}
+
+	return router, nil
 }
 
 // homeHandler handles the root endpoint
@@ -31,14 +196,7 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Hello World")
 }
 
-// PrintRoutes prints all available routes for debugging
-func PrintRoutes() {
-	fmt.Println("Server listening on http://localhost:8787")
-	fmt.Println("Available endpoints:")
-	fmt.Println("  GET  /")
-	fmt.Println("  GET  /users")
-	fmt.Println("  GET  /users/{id}")
-	fmt.Println("  POST /users/add")
-	fmt.Println("  PUT  /users/update/{id}")
-	fmt.Println("  DELETE /users/delete/{id}")
+// preflightHandler is reached only by OPTIONS requests the CORS middleware didn't answer
+func preflightHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
 }
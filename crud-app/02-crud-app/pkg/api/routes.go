@@ -0,0 +1,57 @@
+package api
+
+import (
+	"crud-app/pkg/render"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// RouteInfo describes a single registered route
+type RouteInfo struct {
+	Methods []string `json:"methods"`
+	Path    string   `json:"path"`
+}
+
+// ListRoutes walks the router and returns every route with a path template,
+// in registration order. The catch-all CORS preflight route is skipped.
+func ListRoutes(router *mux.Router) []RouteInfo {
+	var routes []RouteInfo
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+
+		methods, _ := route.GetMethods()
+		if len(methods) == 1 && methods[0] == http.MethodOptions {
+			return nil
+		}
+
+		routes = append(routes, RouteInfo{Methods: methods, Path: path})
+		return nil
+	})
+	return routes
+}
+
+// PrintRoutes prints all routes registered on the router
+func PrintRoutes(router *mux.Router) {
+	fmt.Println("Server listening on http://localhost:8787")
+	fmt.Println("Available endpoints:")
+	for _, route := range ListRoutes(router) {
+		methods := strings.Join(route.Methods, ",")
+		if methods == "" {
+			methods = "ANY"
+		}
+		fmt.Printf("  %-6s %s\n", methods, route.Path)
+	}
+}
+
+// routesHandler handles GET /_routes by listing the router's routes
+func routesHandler(router *mux.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.Respond(w, r, http.StatusOK, ListRoutes(router))
+	}
+}
@@ -0,0 +1,7 @@
+// Kept out of index.html so the docs CSP doesn't need 'unsafe-inline'
+if (typeof SwaggerUIBundle === "undefined") {
+  document.getElementById("swagger-ui").textContent =
+    "Swagger UI is not vendored in this build; run go generate ./pkg/api. The spec is at /openapi.json.";
+} else {
+  window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"context"
+	"crud-app/pkg/config"
+	"crud-app/pkg/middleware"
+	"crud-app/pkg/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIKeyHeader is the header clients send API keys in
+const APIKeyHeader = "X-API-Key"
+
+// Authentication methods recorded on a Principal
+const (
+	MethodAPIKey  = "api_key"
+	MethodJWT     = "jwt"
+	MethodSession = "session"
+)
+
+var (
+	// errNoCredentials means the request carried no credentials at all
+	errNoCredentials = errors.New("no credentials")
+	// ErrLookupFailed means credentials could not be checked, e.g. the database is down
+	ErrLookupFailed = errors.New("error checking credentials")
+	// errInvalidSession means the session cookie is unknown or expired
+	errInvalidSession = errors.New("session expired or invalid")
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Subject string // API key name, JWT "sub" claim or account email
+	Method  string // MethodAPIKey, MethodJWT or MethodSession
+	Role    Role
+	UserID  int // User record the caller acts as, or 0 if none
+}
+
+type principalKey struct{}
+
+// FromContext returns the authenticated principal, or nil for anonymous requests
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// WithPrincipal returns a copy of ctx carrying p
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// Authenticator verifies API keys and JWT bearer tokens
+type Authenticator struct {
+	jwt *jwtVerifier
+
+	// lookupAPIKey finds an active API key by its hash
+	lookupAPIKey func(ctx context.Context, hash string) (*models.APIKey, error)
+	// lookupSession finds an unexpired session by its token hash
+	lookupSession func(ctx context.Context, hash string) (*models.Session, error)
+}
+
+// NewAuthenticator creates an Authenticator from the auth config.
+// JWT support is enabled when a HS256 secret or a JWKS file is configured.
+func NewAuthenticator(cfg config.AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{
+		lookupAPIKey:  models.GetActiveAPIKeyByHash,
+		lookupSession: models.GetSessionByTokenHash,
+	}
+
+	if cfg.JWTSecret != "" || cfg.JWKSFile != "" {
+		verifier, err := newJWTVerifier(cfg)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = verifier
+	}
+
+	return a, nil
+}
+
+// Require rejects requests without valid credentials with 401
+func (a *Authenticator) Require() middleware.Middleware {
+	return a.middleware(true)
+}
+
+// Optional authenticates requests that carry credentials and lets anonymous
+// requests through. Invalid credentials are still rejected, except for stale
+// session cookies, which are ignored.
+func (a *Authenticator) Optional() middleware.Middleware {
+	return a.middleware(false)
+}
+
+func (a *Authenticator) middleware(required bool) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, csrfToken, err := a.authenticate(r)
+			if (err == errNoCredentials || err == errInvalidSession) && !required {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err == ErrLookupFailed {
+				middleware.WriteError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="users-api"`)
+				middleware.WriteError(w, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+				return
+			}
+
+			// Cookie-authenticated requests need a matching CSRF token
+			if principal.Method == MethodSession {
+				if err := checkCSRF(r, csrfToken); err != nil {
+					middleware.WriteError(w, http.StatusForbidden, err.Error())
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// authenticate checks the X-API-Key header, then the Authorization bearer
+// token, then the session cookie. For sessions it also returns the CSRF token.
+func (a *Authenticator) authenticate(r *http.Request) (*Principal, string, error) {
+	apiKey, authorization := r.Header.Get(APIKeyHeader), r.Header.Get("Authorization")
+	if apiKey == "" && authorization == "" {
+		if token := SessionToken(r); token != "" {
+			return a.authenticateSession(r.Context(), token)
+		}
+	}
+
+	principal, err := a.authenticateCredentials(r.Context(), apiKey, authorization)
+	return principal, "", err
+}
+
+// AuthenticateCredentials checks an API key or "Bearer" authorization value
+// sent outside of an HTTP request, such as in gRPC metadata. It returns nil
+// and no error if both are empty.
+func (a *Authenticator) AuthenticateCredentials(ctx context.Context, apiKey, authorization string) (*Principal, error) {
+	principal, err := a.authenticateCredentials(ctx, apiKey, authorization)
+	if err == errNoCredentials {
+		return nil, nil
+	}
+	return principal, err
+}
+
+// authenticateCredentials checks apiKey, or the bearer token in authorization
+// if apiKey is empty
+func (a *Authenticator) authenticateCredentials(ctx context.Context, apiKey, authorization string) (*Principal, error) {
+	if apiKey != "" {
+		return a.authenticateAPIKey(ctx, apiKey)
+	}
+	if authorization == "" {
+		return nil, errNoCredentials
+	}
+
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, fmt.Errorf("unsupported authorization scheme")
+	}
+
+	// API keys may also be sent as bearer tokens
+	if strings.HasPrefix(token, models.APIKeyPrefix) {
+		return a.authenticateAPIKey(ctx, token)
+	}
+
+	if a.jwt == nil {
+		return nil, fmt.Errorf("bearer tokens are not enabled")
+	}
+	return a.jwt.verify(token)
+}
+
+// authenticateAPIKey looks up the hash of key
+func (a *Authenticator) authenticateAPIKey(ctx context.Context, key string) (*Principal, error) {
+	apiKey, err := a.lookupAPIKey(ctx, models.HashToken(key))
+	if err != nil {
+		if err.Error() == "api key not found" {
+			return nil, fmt.Errorf("invalid api key")
+		}
+		return nil, ErrLookupFailed
+	}
+
+	principal := &Principal{Subject: apiKey.Name, Method: MethodAPIKey, Role: Role(apiKey.Role)}
+	if apiKey.UserID != nil {
+		principal.UserID = *apiKey.UserID
+	}
+	return principal, nil
+}
@@ -0,0 +1,347 @@
+package auth
+
+import (
+	"context"
+	"crud-app/pkg/config"
+	"crud-app/pkg/models"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testSecret = "auth-test-secret"
+	testAPIKey = models.APIKeyPrefix + "test-key"
+	testCookie = "session-token"
+	testCSRF   = "csrf-token"
+)
+
+// testAuthenticator verifies HS256 tokens with testSecret and knows one API
+// key and one session. cfg may add to the config.
+func testAuthenticator(t *testing.T, cfg config.AuthConfig) *Authenticator {
+	t.Helper()
+	cfg.JWTSecret = testSecret
+	a, err := NewAuthenticator(cfg)
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+
+	userID := 7
+	a.lookupAPIKey = func(ctx context.Context, hash string) (*models.APIKey, error) {
+		switch hash {
+		case models.HashToken(testAPIKey):
+			return &models.APIKey{Name: "ci", Role: "editor", UserID: &userID}, nil
+		case models.HashToken(models.APIKeyPrefix + "db-down"):
+			return nil, errors.New("error querying api key")
+		}
+		return nil, errors.New("api key not found")
+	}
+	a.lookupSession = func(ctx context.Context, hash string) (*models.Session, error) {
+		if hash == models.HashToken(testCookie) {
+			return &models.Session{UserID: 3, Email: "ada@example.com", Role: "viewer", CSRFToken: testCSRF}, nil
+		}
+		return nil, errors.New("session not found")
+	}
+	return a
+}
+
+// signHS256 signs claims with testSecret
+func signHS256(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// authenticate runs r through m and returns the status and the principal the
+// handler saw
+func authenticate(m func(http.Handler) http.Handler, r *http.Request) (int, *Principal) {
+	var principal *Principal
+	w := httptest.NewRecorder()
+	m(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = FromContext(r.Context())
+	})).ServeHTTP(w, r)
+	return w.Code, principal
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	a := testAuthenticator(t, config.AuthConfig{})
+
+	for _, set := range []func(*http.Request){
+		func(r *http.Request) { r.Header.Set(APIKeyHeader, testAPIKey) },
+		func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+testAPIKey) },
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		set(r)
+		code, p := authenticate(a.Require(), r)
+		if code != http.StatusOK || p == nil {
+			t.Fatalf("status %d, principal %v; want the key's principal", code, p)
+		}
+		if p.Subject != "ci" || p.Method != MethodAPIKey || p.Role != RoleEditor || p.UserID != 7 {
+			t.Errorf("principal = %+v", p)
+		}
+	}
+}
+
+func TestRequireRejectsBadCredentials(t *testing.T) {
+	a := testAuthenticator(t, config.AuthConfig{})
+	valid := jwt.MapClaims{"sub": "7", "exp": time.Now().Add(time.Hour).Unix()}
+
+	tests := []struct {
+		name          string
+		header, value string
+		want          int
+	}{
+		{"no credentials", "", "", http.StatusUnauthorized},
+		{"unknown api key", APIKeyHeader, models.APIKeyPrefix + "nope", http.StatusUnauthorized},
+		{"lookup failure", APIKeyHeader, models.APIKeyPrefix + "db-down", http.StatusInternalServerError},
+		{"basic auth", "Authorization", "Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+		{"garbage token", "Authorization", "Bearer not-a-jwt", http.StatusUnauthorized},
+		{"expired token", "Authorization", "Bearer " + signHS256(t, jwt.MapClaims{"sub": "7", "exp": time.Now().Add(-time.Minute).Unix()}), http.StatusUnauthorized},
+		{"token without exp", "Authorization", "Bearer " + signHS256(t, jwt.MapClaims{"sub": "7"}), http.StatusUnauthorized},
+		{"token without sub", "Authorization", "Bearer " + signHS256(t, jwt.MapClaims{"exp": valid["exp"]}), http.StatusUnauthorized},
+		{"unknown role", "Authorization", "Bearer " + signHS256(t, jwt.MapClaims{"sub": "7", "role": "owner", "exp": valid["exp"]}), http.StatusUnauthorized},
+	}
+
+	wrongSecret, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, valid).SignedString([]byte("other-secret"))
+	tests = append(tests, struct {
+		name          string
+		header, value string
+		want          int
+	}{"wrong secret", "Authorization", "Bearer " + wrongSecret, http.StatusUnauthorized})
+
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	tests = append(tests, struct {
+		name          string
+		header, value string
+		want          int
+	}{"alg none", "Authorization", "Bearer " + unsigned, http.StatusUnauthorized})
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+		w := httptest.NewRecorder()
+		a.Require()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("%s: handler ran", tt.name)
+		})).ServeHTTP(w, r)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: 401 without WWW-Authenticate", tt.name)
+		}
+	}
+}
+
+func TestRequireHS256Token(t *testing.T) {
+	a := testAuthenticator(t, config.AuthConfig{})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+signHS256(t, jwt.MapClaims{"sub": "12", "role": "admin", "exp": time.Now().Add(time.Hour).Unix()}))
+	code, p := authenticate(a.Require(), r)
+	if code != http.StatusOK || p == nil {
+		t.Fatalf("status %d, principal %v", code, p)
+	}
+	if p.Subject != "12" || p.Method != MethodJWT || p.Role != RoleAdmin || p.UserID != 12 {
+		t.Errorf("principal = %+v", p)
+	}
+
+	// Without a role claim the caller is a viewer, and a non-numeric subject has no user
+	r.Header.Set("Authorization", "Bearer "+signHS256(t, jwt.MapClaims{"sub": "ci-bot", "exp": time.Now().Add(time.Hour).Unix()}))
+	if _, p := authenticate(a.Require(), r); p == nil || p.Role != RoleViewer || p.UserID != 0 {
+		t.Errorf("principal = %+v, want a viewer with no user", p)
+	}
+}
+
+func TestRequireChecksIssuerAndAudience(t *testing.T) {
+	a := testAuthenticator(t, config.AuthConfig{JWTIssuer: "https://issuer.example", JWTAudience: "users-api"})
+	exp := time.Now().Add(time.Hour).Unix()
+
+	for _, tt := range []struct {
+		claims jwt.MapClaims
+		want   int
+	}{
+		{jwt.MapClaims{"sub": "7", "exp": exp, "iss": "https://issuer.example", "aud": "users-api"}, http.StatusOK},
+		{jwt.MapClaims{"sub": "7", "exp": exp, "iss": "https://other.example", "aud": "users-api"}, http.StatusUnauthorized},
+		{jwt.MapClaims{"sub": "7", "exp": exp, "iss": "https://issuer.example"}, http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+signHS256(t, tt.claims))
+		if code, _ := authenticate(a.Require(), r); code != tt.want {
+			t.Errorf("claims %v: status %d, want %d", tt.claims, code, tt.want)
+		}
+	}
+}
+
+func TestRequireRS256TokenFromJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewAuthenticator(config.AuthConfig{JWKSFile: path})
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+
+	sign := func(kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "7", "exp": time.Now().Add(time.Hour).Unix()})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	for kid, want := range map[string]int{"key-1": http.StatusOK, "": http.StatusOK, "key-2": http.StatusUnauthorized} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+sign(kid))
+		if code, _ := authenticate(a.Require(), r); code != want {
+			t.Errorf("kid %q: status %d, want %d", kid, code, want)
+		}
+	}
+
+	// HS256 is off without a secret, so a token signed with the public key is refused
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+signHS256(t, jwt.MapClaims{"sub": "7", "exp": time.Now().Add(time.Hour).Unix()}))
+	if code, _ := authenticate(a.Require(), r); code != http.StatusUnauthorized {
+		t.Errorf("HS256 token with only a JWKS: status %d, want 401", code)
+	}
+}
+
+func TestOptionalLetsAnonymousRequestsThrough(t *testing.T) {
+	a := testAuthenticator(t, config.AuthConfig{})
+
+	code, p := authenticate(a.Optional(), httptest.NewRequest("GET", "/", nil))
+	if code != http.StatusOK || p != nil {
+		t.Errorf("anonymous: status %d, principal %v; want 200 and none", code, p)
+	}
+
+	// Bad credentials are still rejected
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(APIKeyHeader, models.APIKeyPrefix+"nope")
+	if code, _ := authenticate(a.Optional(), r); code != http.StatusUnauthorized {
+		t.Errorf("bad key: status %d, want 401", code)
+	}
+}
+
+func TestSessionCookies(t *testing.T) {
+	a := testAuthenticator(t, config.AuthConfig{})
+	withCookie := func(method, token string) *http.Request {
+		r := httptest.NewRequest(method, "/", nil)
+		r.AddCookie(&http.Cookie{Name: SessionCookie, Value: token})
+		return r
+	}
+
+	code, p := authenticate(a.Require(), withCookie("GET", testCookie))
+	if code != http.StatusOK || p == nil {
+		t.Fatalf("status %d, principal %v", code, p)
+	}
+	if p.Subject != "ada@example.com" || p.Method != MethodSession || p.Role != RoleViewer || p.UserID != 3 {
+		t.Errorf("principal = %+v", p)
+	}
+
+	// Unsafe methods must echo the CSRF token
+	if code, _ := authenticate(a.Require(), withCookie("POST", testCookie)); code != http.StatusForbidden {
+		t.Errorf("POST without CSRF token: status %d, want 403", code)
+	}
+	r := withCookie("POST", testCookie)
+	r.Header.Set(CSRFHeader, "wrong")
+	if code, _ := authenticate(a.Require(), r); code != http.StatusForbidden {
+		t.Errorf("POST with wrong CSRF token: status %d, want 403", code)
+	}
+	r.Header.Set(CSRFHeader, testCSRF)
+	if code, _ := authenticate(a.Require(), r); code != http.StatusOK {
+		t.Errorf("POST with CSRF token: status %d, want 200", code)
+	}
+
+	// A stale cookie is ignored where credentials are optional
+	if code, _ := authenticate(a.Require(), withCookie("GET", "expired")); code != http.StatusUnauthorized {
+		t.Errorf("stale session on Require: status %d, want 401", code)
+	}
+	if code, p := authenticate(a.Optional(), withCookie("GET", "expired")); code != http.StatusOK || p != nil {
+		t.Errorf("stale session on Optional: status %d, principal %v; want anonymous", code, p)
+	}
+}
+
+func TestSetAndClearSessionCookies(t *testing.T) {
+	w := httptest.NewRecorder()
+	SetSessionCookies(w, "token", "csrf", time.Now().Add(time.Hour), true)
+
+	cookies := map[string]*http.Cookie{}
+	for _, c := range w.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+	session, csrf := cookies[SessionCookie], cookies[CSRFCookie]
+	if session == nil || !session.HttpOnly || !session.Secure || session.Value != "token" {
+		t.Errorf("session cookie = %+v, want HttpOnly and Secure", session)
+	}
+	// Browser code has to read the CSRF token to echo it
+	if csrf == nil || csrf.HttpOnly || csrf.SameSite != http.SameSiteStrictMode || csrf.Value != "csrf" {
+		t.Errorf("CSRF cookie = %+v, want readable and SameSite=Strict", csrf)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(session)
+	if got := SessionToken(r); got != "token" {
+		t.Errorf("SessionToken = %q", got)
+	}
+	if got := SessionToken(httptest.NewRequest("GET", "/", nil)); got != "" {
+		t.Errorf("SessionToken without a cookie = %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	ClearSessionCookies(w, true)
+	for _, c := range w.Result().Cookies() {
+		if c.MaxAge >= 0 || c.Value != "" {
+			t.Errorf("cookie %s not cleared: %+v", c.Name, c)
+		}
+	}
+}
+
+func TestAuthenticateCredentials(t *testing.T) {
+	a := testAuthenticator(t, config.AuthConfig{})
+	ctx := context.Background()
+
+	if p, err := a.AuthenticateCredentials(ctx, "", ""); p != nil || err != nil {
+		t.Errorf("no credentials = %v, %v; want nil, nil", p, err)
+	}
+	if p, err := a.AuthenticateCredentials(ctx, testAPIKey, ""); err != nil || p.Method != MethodAPIKey {
+		t.Errorf("API key = %v, %v", p, err)
+	}
+	if _, err := a.AuthenticateCredentials(ctx, "", "Bearer nope"); err == nil {
+		t.Error("an invalid token was accepted")
+	}
+}
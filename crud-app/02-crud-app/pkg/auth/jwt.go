@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"crud-app/pkg/config"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtVerifier validates HS256 and RS256 bearer tokens
+type jwtVerifier struct {
+	secret []byte                    // HS256 shared secret
+	keys   map[string]*rsa.PublicKey // RS256 public keys by key ID
+	parser *jwt.Parser
+}
+
+// newJWTVerifier builds a verifier from the auth config, loading the JWKS file if set
+func newJWTVerifier(cfg config.AuthConfig) (*jwtVerifier, error) {
+	v := &jwtVerifier{keys: map[string]*rsa.PublicKey{}}
+
+	var methods []string
+	if cfg.JWTSecret != "" {
+		v.secret = []byte(cfg.JWTSecret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if cfg.JWKSFile != "" {
+		keys, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = keys
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.JWTIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.JWTIssuer))
+	}
+	if cfg.JWTAudience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.JWTAudience))
+	}
+	v.parser = jwt.NewParser(opts...)
+
+	return v, nil
+}
+
+// verify parses and validates a token, returning the principal for its subject
+func (v *jwtVerifier) verify(tokenString string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(tokenString, claims, v.keyFunc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %v", err)
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, fmt.Errorf("invalid token: missing subject")
+	}
+
+	// The "role" claim defaults to viewer; a numeric subject is the caller's user ID
+	role := RoleViewer
+	if name, ok := claims["role"].(string); ok {
+		if role, err = ParseRole(name); err != nil {
+			return nil, fmt.Errorf("invalid token: %v", err)
+		}
+	}
+	userID, _ := strconv.Atoi(subject)
+
+	return &Principal{Subject: subject, Method: MethodJWT, Role: role, UserID: userID}, nil
+}
+
+// keyFunc picks the verification key for a token based on its algorithm and key ID
+func (v *jwtVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return v.secret, nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := v.keys[kid]; ok {
+			return key, nil
+		}
+		// Tokens without a kid are accepted when the JWKS holds a single key
+		if kid == "" && len(v.keys) == 1 {
+			for _, key := range v.keys {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+}
+
+// loadJWKS reads RSA public keys from a JSON Web Key Set file
+func loadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading jwks file: %v", err)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("error parsing jwks file: %v", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus for key %q: %v", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent for key %q: %v", k.Kid, err)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no RSA signing keys in %s", path)
+	}
+	return keys, nil
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPasswordRoundTrip(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Errorf("hash = %q, want argon2id in PHC format", hash)
+	}
+	if !VerifyPassword("correct horse", hash) {
+		t.Error("the right password did not verify")
+	}
+	if VerifyPassword("correct horse ", hash) {
+		t.Error("a wrong password verified")
+	}
+
+	// Every hash gets its own salt
+	again, _ := HashPassword("correct horse")
+	if again == hash {
+		t.Error("hashing twice gave the same hash")
+	}
+}
+
+func TestVerifyPasswordAcceptsBcrypt(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("legacy password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyPassword("legacy password", string(hash)) {
+		t.Error("a bcrypt hash did not verify")
+	}
+	if VerifyPassword("other password", string(hash)) {
+		t.Error("a wrong password verified against bcrypt")
+	}
+}
+
+func TestVerifyPasswordRejectsMalformedHashes(t *testing.T) {
+	hash, _ := HashPassword("password1")
+	parts := strings.Split(hash, "$")
+
+	for name, bad := range map[string]string{
+		"empty":         "",
+		"plain text":    "password1",
+		"wrong scheme":  strings.Replace(hash, "argon2id", "argon2i", 1),
+		"wrong version": strings.Replace(hash, "v=19", "v=16", 1),
+		"bad params":    strings.Replace(hash, parts[3], "m=x", 1),
+		"bad salt":      strings.Replace(hash, parts[4], "!!!", 1),
+		"missing key":   strings.Join(parts[:5], "$"),
+	} {
+		if VerifyPassword("password1", bad) {
+			t.Errorf("%s: %q verified", name, bad)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package auth
+
+import "fmt"
+
+// Role is a caller's access level. Each role includes the permissions of the roles below it.
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+// RoleRegistered is the role of accounts created through POST /auth/register.
+// It lets them edit their own user record, but not create other users.
+const RoleRegistered = RoleViewer
+
+// roleRank orders roles from least to most privileged
+var roleRank = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// ParseRole validates a role name
+func ParseRole(name string) (Role, error) {
+	role := Role(name)
+	if _, ok := roleRank[role]; !ok {
+		return "", fmt.Errorf("unknown role %q", name)
+	}
+	return role, nil
+}
+
+// AtLeast reports whether r grants at least the permissions of other.
+// Unknown roles grant nothing.
+func (r Role) AtLeast(other Role) bool {
+	rank, ok := roleRank[r]
+	return ok && rank >= roleRank[other]
+}
@@ -0,0 +1,36 @@
+package auth
+
+import "testing"
+
+func TestParseRole(t *testing.T) {
+	for _, name := range []string{"viewer", "editor", "admin"} {
+		if role, err := ParseRole(name); err != nil || string(role) != name {
+			t.Errorf("ParseRole(%q) = %q, %v", name, role, err)
+		}
+	}
+	for _, name := range []string{"", "Admin", "owner"} {
+		if _, err := ParseRole(name); err == nil {
+			t.Errorf("ParseRole(%q) accepted an unknown role", name)
+		}
+	}
+}
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		role, other Role
+		want        bool
+	}{
+		{RoleAdmin, RoleEditor, true},
+		{RoleAdmin, RoleAdmin, true},
+		{RoleEditor, RoleViewer, true},
+		{RoleEditor, RoleAdmin, false},
+		{RoleViewer, RoleEditor, false},
+		{Role("owner"), RoleViewer, false},
+		{Role(""), RoleViewer, false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.AtLeast(tt.other); got != tt.want {
+			t.Errorf("%q.AtLeast(%q) = %v, want %v", tt.role, tt.other, got, tt.want)
+		}
+	}
+}
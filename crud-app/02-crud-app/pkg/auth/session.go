@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"crud-app/pkg/models"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// SessionCookie holds the session token. It is HttpOnly.
+	SessionCookie = "session"
+	// CSRFCookie holds the session's CSRF token so browser code can read it
+	CSRFCookie = "csrf_token"
+	// CSRFHeader must echo the CSRF token on unsafe cookie-authenticated requests
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// SetSessionCookies sets the session and CSRF cookies after a successful login
+func SetSessionCookies(w http.ResponseWriter, token, csrfToken string, expiresAt time.Time, secure bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    csrfToken,
+		Path:     "/",
+		Expires:  expiresAt,
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// ClearSessionCookies expires the session and CSRF cookies
+func ClearSessionCookies(w http.ResponseWriter, secure bool) {
+	for _, name := range []string{SessionCookie, CSRFCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: name == SessionCookie,
+			Secure:   secure,
+		})
+	}
+}
+
+// SessionToken returns the session token cookie of a request, or ""
+func SessionToken(r *http.Request) string {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// authenticateSession looks up the session for a session cookie
+func (a *Authenticator) authenticateSession(ctx context.Context, token string) (*Principal, string, error) {
+	session, err := a.lookupSession(ctx, models.HashToken(token))
+	if err != nil {
+		if err.Error() == "session not found" {
+			return nil, "", errInvalidSession
+		}
+		return nil, "", ErrLookupFailed
+	}
+
+	principal := &Principal{
+		Subject: session.Email,
+		Method:  MethodSession,
+		Role:    Role(session.Role),
+		UserID:  session.UserID,
+	}
+	return principal, session.CSRFToken, nil
+}
+
+// checkCSRF requires unsafe requests to echo the session's CSRF token in the
+// X-CSRF-Token header, so other sites can't ride on the session cookie
+func checkCSRF(r *http.Request, csrfToken string) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	header := r.Header.Get(CSRFHeader)
+	if header == "" || subtle.ConstantTimeCompare([]byte(header), []byte(csrfToken)) != 1 {
+		return fmt.Errorf("CSRF token missing or invalid")
+	}
+	return nil
+}
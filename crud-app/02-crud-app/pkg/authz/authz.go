@@ -0,0 +1,68 @@
+package authz
+
+import (
+	"crud-app/pkg/auth"
+	"crud-app/pkg/middleware"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Policy decides which principals may call a route.
+//
+// A principal with at least Role is always allowed. If OwnerRole is set, a
+// principal with at least OwnerRole is also allowed when the route variable
+// OwnerParam matches their own user ID, so they can only touch their own record.
+type Policy struct {
+	Role       auth.Role
+	OwnerRole  auth.Role
+	OwnerParam string
+}
+
+// Policies for user routes. The REST routes, GraphQL mutations and gRPC
+// methods that make the same change share one, so they can't drift apart.
+var (
+	// Editors may create users
+	Editors = Policy{Role: auth.RoleEditor}
+	// Admins may do anything, including delete users
+	Admins = Policy{Role: auth.RoleAdmin}
+	// OwnerOrAdmin lets any signed in user change only their own user record
+	OwnerOrAdmin = Policy{Role: auth.RoleAdmin, OwnerRole: auth.RoleViewer, OwnerParam: "id"}
+)
+
+// Allows reports whether p may call a route with the given route variables
+func (pol Policy) Allows(p *auth.Principal, vars map[string]string) bool {
+	if p == nil {
+		return false
+	}
+	if p.Role.AtLeast(pol.Role) {
+		return true
+	}
+	if pol.OwnerRole == "" || !p.Role.AtLeast(pol.OwnerRole) || p.UserID == 0 {
+		return false
+	}
+
+	id, err := strconv.Atoi(vars[pol.OwnerParam])
+	return err == nil && id == p.UserID
+}
+
+// Require rejects requests that the policy doesn't allow, with 401 for
+// anonymous callers and 403 for authenticated ones. It must run after
+// authentication.
+func Require(pol Policy) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := auth.FromContext(r.Context())
+			if principal == nil {
+				middleware.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			if !pol.Allows(principal, mux.Vars(r)) {
+				middleware.WriteError(w, http.StatusForbidden, "Forbidden")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,35 @@
+// Package cache provides the read-through cache in front of the models
+// layer, with in-memory and Redis stores.
+package cache
+
+import (
+	"context"
+	"crud-app/pkg/config"
+	"fmt"
+	"time"
+)
+
+// Store holds cached values by key. Implementations must be safe for
+// concurrent use. Values must not be modified after they are stored.
+type Store interface {
+	// Get returns the value for key. ok is false if it isn't cached or has expired.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set stores value under key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes key, if present
+	Delete(ctx context.Context, key string) error
+}
+
+// New returns the store selected in the config, or nil if caching is disabled
+func New(cfg config.CacheConfig) (Store, error) {
+	switch cfg.Driver {
+	case "memory":
+		return NewMemoryStore(cfg.MaxEntries), nil
+	case "redis":
+		return NewRedisStore(cfg.RedisURL)
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown cache driver %q", cfg.Driver)
+	}
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(2)
+
+	s.Set(ctx, "a", []byte("1"), time.Minute)
+	s.Set(ctx, "b", []byte("2"), time.Minute)
+	s.Get(ctx, "a") // b is now the least recently used
+	s.Set(ctx, "c", []byte("3"), time.Minute)
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok, _ := s.Get(ctx, key); ok != want {
+			t.Errorf("Get(%q) cached = %v, want %v", key, ok, want)
+		}
+	}
+	if s.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", s.Len())
+	}
+}
+
+func TestMemoryStoreExpires(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := NewMemoryStore(10)
+	s.now = func() time.Time { return now }
+
+	s.Set(ctx, "a", []byte("1"), time.Minute)
+	now = now.Add(59 * time.Second)
+	if _, ok, _ := s.Get(ctx, "a"); !ok {
+		t.Fatal("value expired early")
+	}
+	now = now.Add(time.Second)
+	if _, ok, _ := s.Get(ctx, "a"); ok {
+		t.Fatal("value outlived its TTL")
+	}
+	if s.Len() != 0 {
+		t.Errorf("expired value was not dropped")
+	}
+}
+
+func TestReadThroughCollapsesConcurrentMisses(t *testing.T) {
+	c := NewReadThrough("test.collapse", NewMemoryStore(10), time.Minute)
+
+	release := make(chan struct{})
+	var loads atomic.Int32
+	load := func(ctx context.Context) ([]byte, error) {
+		loads.Add(1)
+		<-release
+		return []byte("value"), nil
+	}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := c.Get(context.Background(), "k", load)
+			if err != nil || string(value) != "value" {
+				t.Errorf("Get = %q, %v", value, err)
+			}
+		}()
+	}
+	// Wait until every caller has missed, then let the load finish
+	for c.Stats().Misses < callers {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if loads.Load() != 1 {
+		t.Errorf("loaded %d times, want 1", loads.Load())
+	}
+	if _, err := c.Get(context.Background(), "k", load); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.Stats(); stats != (Stats{Hits: 1, Misses: callers, Loads: 1}) {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestReadThroughInvalidate(t *testing.T) {
+	ctx := context.Background()
+	c := NewReadThrough("test.invalidate", NewMemoryStore(10), time.Minute)
+
+	version := "v1"
+	load := func(ctx context.Context) ([]byte, error) { return []byte(version), nil }
+
+	c.Get(ctx, "k", load)
+	version = "v2"
+	if value, _ := c.Get(ctx, "k", load); string(value) != "v1" {
+		t.Fatalf("Get = %q, want the cached v1", value)
+	}
+
+	c.Invalidate(ctx, "k")
+	if value, _ := c.Get(ctx, "k", load); string(value) != "v2" {
+		t.Fatalf("Get after Invalidate = %q, want v2", value)
+	}
+}
+
+func TestReadThroughDoesNotCacheStaleLoads(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(10)
+	c := NewReadThrough("test.stale", store, time.Minute)
+
+	// The row changes while it is being loaded
+	c.Get(ctx, "k", func(ctx context.Context) ([]byte, error) {
+		c.Invalidate(ctx, "k")
+		return []byte("old"), nil
+	})
+	if _, ok, _ := store.Get(ctx, "k"); ok {
+		t.Fatal("a load that raced an Invalidate was cached")
+	}
+}
+
+func TestReadThroughDoesNotCacheErrors(t *testing.T) {
+	ctx := context.Background()
+	c := NewReadThrough("test.errors", NewMemoryStore(10), time.Minute)
+
+	notFound := errors.New("user not found")
+	if _, err := c.Get(ctx, "k", func(ctx context.Context) ([]byte, error) { return nil, notFound }); err != notFound {
+		t.Fatalf("Get error = %v, want %v", err, notFound)
+	}
+	value, err := c.Get(ctx, "k", func(ctx context.Context) ([]byte, error) { return []byte("found"), nil })
+	if err != nil || string(value) != "found" {
+		t.Fatalf("Get = %q, %v", value, err)
+	}
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process LRU cache. Once it holds maxEntries values,
+// storing another evicts the least recently used. Expired values are dropped
+// when they are next read, or evicted like any other.
+type MemoryStore struct {
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Front is the most recently used
+}
+
+// memoryEntry is one value in a MemoryStore
+type memoryEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates a MemoryStore holding up to maxEntries values
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+	}
+}
+
+// Get returns the value for key and marks it as recently used
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := el.Value.(*memoryEntry)
+	if !s.now().Before(entry.expiresAt) {
+		s.remove(el)
+		return nil, false, nil
+	}
+
+	s.order.MoveToFront(el)
+	return entry.value, true, nil
+}
+
+// Set stores value under key for ttl, evicting the least recently used value if full
+func (s *MemoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt := s.now().Add(ttl)
+	if el, ok := s.entries[key]; ok {
+		entry := el.Value.(*memoryEntry)
+		entry.value, entry.expiresAt = value, expiresAt
+		s.order.MoveToFront(el)
+		return nil
+	}
+
+	s.entries[key] = s.order.PushFront(&memoryEntry{key: key, value: value, expiresAt: expiresAt})
+	for s.order.Len() > s.maxEntries {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
+
+// Delete removes key
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		s.remove(el)
+	}
+	return nil
+}
+
+// Len returns how many values are stored, including expired ones not yet dropped
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+func (s *MemoryStore) remove(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.entries, el.Value.(*memoryEntry).key)
+}
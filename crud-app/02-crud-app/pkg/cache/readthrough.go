@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// metrics publishes the stats of every ReadThrough under "cache" in /debug/vars
+var metrics = expvar.NewMap("cache")
+
+// Stats counts how a ReadThrough's lookups were served
+type Stats struct {
+	Hits   int64 `json:"hits"`   // Served from the store
+	Misses int64 `json:"misses"` // Not in the store
+	Loads  int64 `json:"loads"`  // Calls to the loader; concurrent misses share one
+	Errors int64 `json:"errors"` // Store failures, which fall back to the loader
+}
+
+// ReadThrough serves values from a Store, loading and storing them on a miss.
+// Concurrent misses for the same key share one load. Store failures are
+// logged and treated as misses, so a broken cache slows requests down rather
+// than failing them.
+type ReadThrough struct {
+	store Store
+	ttl   time.Duration
+	group singleflight.Group
+
+	// generation changes on every Invalidate, so a load that started before
+	// one doesn't store a value that may be stale
+	generation atomic.Uint64
+
+	hits, misses, loads, errors atomic.Int64
+}
+
+// NewReadThrough creates a ReadThrough that keeps values in store for ttl.
+// Its stats are published in /debug/vars as cache.<name>.
+func NewReadThrough(name string, store Store, ttl time.Duration) *ReadThrough {
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	c := &ReadThrough{store: store, ttl: ttl}
+	metrics.Set(name, expvar.Func(func() interface{} { return c.Stats() }))
+	return c
+}
+
+// Get returns the value for key, calling load if it isn't cached. Errors from
+// load are returned as they are and not cached.
+func (c *ReadThrough) Get(ctx context.Context, key string, load func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	value, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		c.errors.Add(1)
+		log.Printf("cache: %v", err)
+	}
+	if ok {
+		c.hits.Add(1)
+		return value, nil
+	}
+	c.misses.Add(1)
+
+	result, err, _ := c.group.Do(key, func() (interface{}, error) {
+		// Callers share this load, so one of them going away mustn't cancel it
+		loadCtx := context.WithoutCancel(ctx)
+		generation := c.generation.Load()
+
+		c.loads.Add(1)
+		value, err := load(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		if c.generation.Load() != generation {
+			return value, nil
+		}
+		if err := c.store.Set(loadCtx, key, value, c.ttl); err != nil {
+			c.errors.Add(1)
+			log.Printf("cache: %v", err)
+		}
+		// An Invalidate may have run between the check and the Set
+		if c.generation.Load() != generation {
+			c.store.Delete(loadCtx, key)
+		}
+		return value, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]byte), nil
+}
+
+// Invalidate removes key, so the next Get loads it again
+func (c *ReadThrough) Invalidate(ctx context.Context, key string) {
+	c.generation.Add(1)
+	c.group.Forget(key)
+	if err := c.store.Delete(ctx, key); err != nil {
+		c.errors.Add(1)
+		log.Printf("cache: %v", err)
+	}
+}
+
+// Stats returns the counts since the ReadThrough was created
+func (c *ReadThrough) Stats() Stats {
+	return Stats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Loads:  c.loads.Load(),
+		Errors: c.errors.Load(),
+	}
+}
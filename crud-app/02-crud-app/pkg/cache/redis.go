@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps values in Redis, or any server that speaks its protocol,
+// so every instance of the app shares one cache
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore connects to the server at url, e.g. redis://localhost:6379/0
+func NewRedisStore(url string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %v", err)
+	}
+	return &RedisStore{client: redis.NewClient(opts)}, nil
+}
+
+// Get returns the value for key
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading %s from Redis: %v", key, err)
+	}
+	return value, true, nil
+}
+
+// Set stores value under key for ttl
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := s.client.Set(ctx, key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("error writing %s to Redis: %v", key, err)
+	}
+	return nil
+}
+
+// Delete removes key
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, key).Err(); err != nil {
+		return fmt.Errorf("error deleting %s from Redis: %v", key, err)
+	}
+	return nil
+}
+
+// Close closes the connections to the server
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,204 @@
+// Package client is a typed Go client for the users API.
+//
+//	users := client.NewUsersClient("http://localhost:8787")
+//	user, err := users.Get(ctx, 1)
+//	if client.IsNotFound(err) { ... }
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Option configures a UsersClient
+type Option func(*UsersClient)
+
+// WithHTTPClient sets the http.Client used for requests
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *UsersClient) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries sets how many times idempotent calls are retried and the
+// initial backoff, which doubles after every attempt
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *UsersClient) {
+		c.maxRetries = maxRetries
+		c.backoff = backoff
+	}
+}
+
+// WithHeader adds a header to every request, e.g. for authentication
+func WithHeader(key, value string) Option {
+	return func(c *UsersClient) {
+		c.headers.Set(key, value)
+	}
+}
+
+// UsersClient calls the users API
+type UsersClient struct {
+	baseURL    string
+	httpClient *http.Client
+	headers    http.Header
+	maxRetries int
+	backoff    time.Duration
+}
+
+// NewUsersClient creates a client for the API at baseURL, e.g. http://localhost:8787
+func NewUsersClient(baseURL string, opts ...Option) *UsersClient {
+	c := &UsersClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		headers:    http.Header{},
+		maxRetries: 3,
+		backoff:    100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// do sends a request and decodes a JSON response into out (if non-nil).
+// Idempotent requests are retried on network errors and retryable statuses,
+// waiting at least as long as the server asks for in Retry-After.
+func (c *UsersClient) do(ctx context.Context, method, path string, body, out interface{}, idempotent bool) (*http.Response, error) {
+	return c.doWithHeader(ctx, method, path, nil, body, out, idempotent)
+}
+
+// doWithHeader is do with extra headers for this request only
+func (c *UsersClient) doWithHeader(ctx context.Context, method, path string, header http.Header, body, out interface{}, idempotent bool) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding request: %v", err)
+		}
+	}
+
+	attempts := 1
+	if idempotent {
+		attempts += c.maxRetries
+	}
+
+	var lastErr error
+	var retryAfter time.Duration
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, max(c.retryDelay(attempt), retryAfter)); err != nil {
+				return nil, err
+			}
+			retryAfter = 0
+		}
+
+		resp, err := c.send(ctx, method, path, header, payload)
+		if err != nil {
+			// Don't retry once the caller has given up
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode >= 400 {
+			apiErr := decodeError(resp)
+			apiErr.retried = attempt > 0
+			if retryable(resp.StatusCode) {
+				lastErr = apiErr
+				retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+				continue
+			}
+			return resp, apiErr
+		}
+
+		if out != nil {
+			err = json.NewDecoder(resp.Body).Decode(out)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return resp, fmt.Errorf("error decoding response: %v", err)
+		}
+		return resp, nil
+	}
+
+	return nil, lastErr
+}
+
+// send performs a single HTTP request
+func (c *UsersClient) send(ctx context.Context, method, path string, header http.Header, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.headers {
+		req.Header[key] = values
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// retryDelay returns the exponential backoff for an attempt, with jitter
+func (c *UsersClient) retryDelay(attempt int) time.Duration {
+	delay := c.backoff << (attempt - 1)
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as an HTTP date.
+// It returns 0 if the header is missing or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// retryable reports whether a response status is worth retrying
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
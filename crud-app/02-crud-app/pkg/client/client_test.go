@@ -0,0 +1,251 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testClient serves handler and returns a client for it that retries quickly
+func testClient(t *testing.T, handler http.HandlerFunc) *UsersClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return NewUsersClient(srv.URL+"/", WithRetries(3, time.Millisecond))
+}
+
+func TestRetriesIdempotentCalls(t *testing.T) {
+	var calls atomic.Int32
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"id":"1","name":"Ada"}`)
+	})
+
+	user, err := c.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Ada" || calls.Load() != 3 {
+		t.Errorf("got %+v after %d calls, want Ada after 3", user, calls.Load())
+	}
+}
+
+func TestGivesUpAfterMaxRetries(t *testing.T) {
+	var calls atomic.Int32
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	_, err := c.Get(context.Background(), 1)
+	if !hasStatus(err, http.StatusBadGateway) {
+		t.Errorf("error = %v, want a 502 APIError", err)
+	}
+	if calls.Load() != 4 {
+		t.Errorf("made %d calls, want 1 + 3 retries", calls.Load())
+	}
+}
+
+func TestDoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"Invalid user ID"}`)
+	})
+
+	_, err := c.Get(context.Background(), 1)
+	if !IsBadRequest(err) {
+		t.Fatalf("error = %v, want a 400", err)
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Message != "Invalid user ID" {
+		t.Errorf("Message = %q, want the decoded error", apiErr.Message)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("made %d calls, want 1", calls.Load())
+	}
+}
+
+func TestDecodeErrorFallsBackToBody(t *testing.T) {
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such route", http.StatusNotFound)
+	})
+
+	_, err := c.Get(context.Background(), 1)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !IsNotFound(err) {
+		t.Fatalf("error = %v, want a 404 APIError", err)
+	}
+	if apiErr.Message != "no such route\n" {
+		t.Errorf("Message = %q, want the plain text body", apiErr.Message)
+	}
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	// The backoff alone would retry within milliseconds
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := c.Get(ctx, 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want the deadline to pass while waiting", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("made %d calls before Retry-After, want 1", calls.Load())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":        0,
+		"3":       3 * time.Second,
+		"-1":      0,
+		"soon":    0,
+		"Mon, 01": 0,
+		time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat): 0,
+	}
+	for value, want := range tests {
+		if got := parseRetryAfter(value); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 58*time.Second || got > time.Minute {
+		t.Errorf("parseRetryAfter(%q) = %v, want about a minute", date, got)
+	}
+}
+
+func TestCreateReusesIdempotencyKey(t *testing.T) {
+	var keys []string
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if len(keys) == 1 {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":7}`)
+	})
+
+	id, err := c.Create(context.Background(), UserInput{Name: "Ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 7 {
+		t.Errorf("id = %d, want 7", id)
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("Idempotency-Keys = %q, want the same key on both attempts", keys)
+	}
+}
+
+func TestDeleteTreatsNotFoundOnRetryAsDeleted(t *testing.T) {
+	var calls atomic.Int32
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt deletes the user, but its response is lost
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		http.Error(w, `{"error":"user not found"}`, http.StatusNotFound)
+	})
+
+	if err := c.Delete(context.Background(), 1); err != nil {
+		t.Errorf("Delete error = %v, want nil", err)
+	}
+
+	first := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"user not found"}`, http.StatusNotFound)
+	})
+	if err := first.Delete(context.Background(), 1); !IsNotFound(err) {
+		t.Errorf("Delete of a missing user = %v, want a 404", err)
+	}
+}
+
+func TestAllFollowsCursors(t *testing.T) {
+	pages := map[string]struct {
+		body string
+		next string
+	}{
+		"":   {`[{"id":"1"},{"id":"2"}]`, "c1"},
+		"c1": {`[{"id":"3"},{"id":"4"}]`, "c2"},
+		"c2": {`[{"id":"5"}]`, ""},
+	}
+	var calls atomic.Int32
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Query().Get("limit") != "2" {
+			t.Errorf("limit = %q, want 2", r.URL.Query().Get("limit"))
+		}
+		page := pages[r.URL.Query().Get("cursor")]
+		if page.next != "" {
+			w.Header().Set("X-Next-Cursor", page.next)
+		}
+		fmt.Fprint(w, page.body)
+	})
+
+	var ids []string
+	for user, err := range c.All(context.Background(), 2) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.ID)
+	}
+	if fmt.Sprint(ids) != "[1 2 3 4 5]" {
+		t.Errorf("ids = %v, want [1 2 3 4 5]", ids)
+	}
+
+	// Stopping early doesn't fetch more pages
+	calls.Store(0)
+	for range c.All(context.Background(), 2) {
+		break
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("fetched %d pages after stopping on the first user, want 1", n)
+	}
+}
+
+func TestAllStopsAtFirstError(t *testing.T) {
+	var calls atomic.Int32
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("X-Next-Cursor", "c1")
+			fmt.Fprint(w, `[{"id":"1"}]`)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"Invalid cursor"}`)
+	})
+
+	var ids []string
+	var errs []error
+	for user, err := range c.All(context.Background(), 1) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ids = append(ids, user.ID)
+	}
+	if len(ids) != 1 || len(errs) != 1 || !IsBadRequest(errs[0]) {
+		t.Errorf("got users %v and errors %v, want one of each", ids, errs)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("made %d calls, want 2", n)
+	}
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// APIError is returned for any response with a 4xx or 5xx status
+type APIError struct {
+	StatusCode int
+	Message    string
+
+	retried bool // An earlier attempt may have reached the server
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("users api: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// IsNotFound reports whether err is an APIError with status 404
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsBadRequest reports whether err is an APIError with status 400
+func IsBadRequest(err error) bool {
+	return hasStatus(err, http.StatusBadRequest)
+}
+
+func hasStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// decodeError reads the {"error": "..."} body of a failed response.
+// Plain text bodies are used as the message as-is.
+func decodeError(resp *http.Response) *APIError {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	var payload struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil && payload.Error != "" {
+		apiErr.Message = payload.Error
+	} else {
+		apiErr.Message = string(body)
+	}
+	return apiErr
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// User is a user returned by the API
+type User struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Country string `json:"country"`
+}
+
+// UserInput holds the fields for Create and Update
+type UserInput struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Country string `json:"country"`
+}
+
+// UserPatch holds the fields for Patch; nil fields are left unchanged
+type UserPatch struct {
+	Name    *string `json:"name,omitempty"`
+	Address *string `json:"address,omitempty"`
+	Country *string `json:"country,omitempty"`
+}
+
+// ListOptions selects a page of users
+type ListOptions struct {
+	Limit  int    // Page size, 1-500. Defaults to the server's page size.
+	Cursor string // Cursor from a previous UserPage.NextCursor
+}
+
+// UserPage is one page of users
+type UserPage struct {
+	Users      []User
+	NextCursor string // Empty on the last page
+}
+
+// List fetches a single page of users
+func (c *UsersClient) List(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	query := url.Values{}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	query.Set("cursor", opts.Cursor)
+
+	var users []User
+	resp, err := c.do(ctx, http.MethodGet, "/users?"+query.Encode(), nil, &users, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserPage{Users: users, NextCursor: resp.Header.Get("X-Next-Cursor")}, nil
+}
+
+// All iterates over every user, following pagination cursors.
+// Iteration stops after the first error.
+func (c *UsersClient) All(ctx context.Context, pageSize int) iter.Seq2[User, error] {
+	return func(yield func(User, error) bool) {
+		opts := ListOptions{Limit: pageSize}
+		for {
+			page, err := c.List(ctx, opts)
+			if err != nil {
+				yield(User{}, err)
+				return
+			}
+
+			for _, user := range page.Users {
+				if !yield(user, nil) {
+					return
+				}
+			}
+
+			if page.NextCursor == "" {
+				return
+			}
+			opts.Cursor = page.NextCursor
+		}
+	}
+}
+
+// Get fetches a user by ID
+func (c *UsersClient) Get(ctx context.Context, id int) (*User, error) {
+	var user User
+	if _, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/users/%d", id), nil, &user, true); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Create creates a user and returns its ID. Every attempt carries the same
+// Idempotency-Key, so retries can't create duplicate users.
+func (c *UsersClient) Create(ctx context.Context, input UserInput) (int, error) {
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return 0, err
+	}
+	header := http.Header{}
+	header.Set("Idempotency-Key", key)
+
+	var result struct {
+		ID int `json:"id"`
+	}
+	if _, err := c.doWithHeader(ctx, http.MethodPost, "/users/add", header, input, &result, true); err != nil {
+		return 0, err
+	}
+	return result.ID, nil
+}
+
+// newIdempotencyKey returns a random key identifying one logical request
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating idempotency key: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Update replaces every field of a user
+func (c *UsersClient) Update(ctx context.Context, id int, input UserInput) error {
+	_, err := c.do(ctx, http.MethodPut, fmt.Sprintf("/users/update/%d", id), input, nil, true)
+	return err
+}
+
+// Patch updates only the fields set in patch. Setting fields is idempotent,
+// so it is retried like Update.
+func (c *UsersClient) Patch(ctx context.Context, id int, patch UserPatch) error {
+	_, err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/users/update/%d", id), patch, nil, true)
+	return err
+}
+
+// Delete deletes a user. A 404 on a retry means an earlier attempt deleted
+// the user before its response was lost, so it counts as success.
+func (c *UsersClient) Delete(ctx context.Context, id int) error {
+	_, err := c.do(ctx, http.MethodDelete, fmt.Sprintf("/users/delete/%d", id), nil, nil, true)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound && apiErr.retried {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,355 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Config holds application settings loaded from the environment
+type Config struct {
+	Debug     bool // Enables debug-only endpoints such as GET /_routes
+	HTTP      HTTPConfig
+	Auth      AuthConfig
+	Cache     CacheConfig
+	Database  DatabaseConfig
+	GraphQL   GraphQLConfig
+	GRPC      GRPCConfig
+	Mailer    MailerConfig
+	Outbox    OutboxConfig
+	RateLimit RateLimitConfig
+	Shutdown  ShutdownConfig
+	Stream    StreamConfig
+	Telemetry TelemetryConfig
+	Webhooks  WebhooksConfig
+}
+
+// AuthConfig holds authentication settings
+type AuthConfig struct {
+	ProtectReads bool   // Require credentials for GET routes too
+	JWTSecret    string // HS256 shared secret; empty disables HS256
+	JWKSFile     string // Local JWKS file with RS256 public keys; empty disables RS256
+	JWTIssuer    string // Expected "iss" claim, if set
+	JWTAudience  string // Expected "aud" claim, if set
+
+	SessionTTL          time.Duration
+	SessionCookieSecure bool          // Only send the session cookie over HTTPS
+	PasswordResetTTL    time.Duration // How long password reset tokens stay valid
+	PasswordResetURL    string        // Link sent in reset emails; the token is appended
+}
+
+// CacheConfig selects the read-through cache in front of user lookups
+type CacheConfig struct {
+	Driver     string        // "memory", "redis" or "none"
+	TTL        time.Duration // How long a user stays cached
+	MaxEntries int           // Users kept by the "memory" driver before the least recently used is evicted
+	RedisURL   string        // Server used by the "redis" driver, e.g. redis://localhost:6379/0
+}
+
+// DatabaseConfig holds connection pool and read replica settings. The primary's
+// address and credentials are the MYSQL_* variables read in models.InitDatabase.
+type DatabaseConfig struct {
+	Pool          PoolConfig    // Applied to the primary and to each replica
+	StatsInterval time.Duration // How often pool stats are checked for saturation; 0 disables the check
+
+	ReplicaDSNs          []string      // Replicas that serve user reads, e.g. user:pass@tcp(replica1:3306)/test_db?parseTime=true; empty sends reads to the primary
+	ReplicaCheckInterval time.Duration // How often replicas are pinged; those that don't answer are skipped until they do
+}
+
+// PoolConfig sizes a database connection pool
+type PoolConfig struct {
+	MaxOpenConns    int           // Connections open at once, in use or idle; 0 means no limit
+	MaxIdleConns    int           // Idle connections kept for reuse
+	ConnMaxLifetime time.Duration // Connections are closed after this long; 0 keeps them forever
+	ConnMaxIdleTime time.Duration // Idle connections are closed after this long; 0 keeps them until ConnMaxLifetime
+}
+
+// GraphQLConfig limits the queries accepted by POST /graphql
+type GraphQLConfig struct {
+	MaxDepth      int // Deepest allowed nesting of fields
+	MaxComplexity int // Highest allowed query cost; list fields multiply their children's cost by "first"
+}
+
+// GRPCConfig controls the gRPC UserService served next to the HTTP API
+type GRPCConfig struct {
+	Enabled    bool
+	Addr       string // Listen address, e.g. ":9090"
+	Reflection bool   // Register the reflection service so tools like grpcurl can list methods
+}
+
+// RateLimitConfig holds per-client token bucket limits for groups of routes
+type RateLimitConfig struct {
+	Enabled bool
+	Read    RateLimit // GET /users and /users/{id}
+	Write   RateLimit // Routes that modify users
+	Auth    RateLimit // Login, registration and password resets
+	// Credentials limits each IP address on routes that check credentials,
+	// before they are checked
+	Credentials RateLimit
+}
+
+// RateLimit is a refill rate in requests per second and a burst size
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// MailerConfig selects how outgoing email is delivered
+type MailerConfig struct {
+	Driver   string // "log" or "file"
+	From     string
+	FilePath string // Output file used by the "file" driver
+}
+
+// OutboxConfig controls delivery of user change events from the outbox table
+type OutboxConfig struct {
+	Sinks        []string      // Any of "log", "file", "webhook" and "nats"; empty disables delivery
+	PollInterval time.Duration // How often to check for new events
+	BatchSize    int           // Events claimed per poll
+	MaxAttempts  int           // Deliveries tried before an event is given up on
+	RetryBackoff time.Duration // Delay before the first retry; doubles on each attempt
+
+	FilePath          string // NDJSON file written by the "file" sink
+	WebhookURL        string // URL the "webhook" sink POSTs events to
+	NATSURL           string // Server the "nats" sink publishes to, e.g. nats://localhost:4222
+	NATSSubjectPrefix string // Events are published to <prefix>.<event type>
+}
+
+// ShutdownConfig bounds how long each part of the server gets to stop
+type ShutdownConfig struct {
+	ServerTimeout time.Duration // For the HTTP and gRPC servers to finish open requests
+	WorkerTimeout time.Duration // For background workers to finish the batch they are on
+}
+
+// StreamConfig controls the live user change feeds: GET /users/stream and GET /users/ws
+type StreamConfig struct {
+	BufferSize   int           // Recent events kept for clients resuming with Last-Event-ID
+	Heartbeat    time.Duration // Interval between keep-alive comments on idle streams
+	PollInterval time.Duration // How often to check the outbox for new events
+
+	WSMaxConnections int           // Open WebSocket connections allowed at once
+	WSPingInterval   time.Duration // How often WebSocket clients are pinged; they must answer within twice this
+}
+
+// WebhooksConfig controls delivery to webhook subscriptions
+type WebhooksConfig struct {
+	Enabled      bool
+	PollInterval time.Duration // How often to check for due deliveries
+	BatchSize    int           // Deliveries claimed per poll
+	Timeout      time.Duration // Timeout for each POST to a webhook
+	MaxAttempts  int           // Attempts before a delivery is given up on
+	RetryBackoff time.Duration // Delay before the first retry; doubles on each attempt
+	DisableAfter int           // Consecutive failures before a webhook is disabled
+}
+
+// HTTPConfig holds settings for the HTTP server and middleware
+type HTTPConfig struct {
+	CORSAllowedOrigins  []string
+	RequestTimeout      time.Duration // Timeout for public routes
+	AdminRequestTimeout time.Duration // Timeout for routes that modify data
+	IdempotencyKeyTTL   time.Duration // How long responses to Idempotency-Key requests are kept
+	IdempotencyLockTTL  time.Duration // How long a request holds its Idempotency-Key before a retry may take it over
+	CacheMaxAge         time.Duration // max-age sent on cacheable GET /users responses; 0 makes clients revalidate every time
+}
+
+// TelemetryConfig holds tracing settings
+type TelemetryConfig struct {
+	ServiceName  string // Service name reported on every span
+	Exporter     string // One of "otlp", "stdout", "file" or "none"
+	OTLPEndpoint string // OTLP/HTTP endpoint, e.g. http://localhost:4318
+	FilePath     string // Output file used by the "file" exporter
+	SampleRatio  float64
+}
+
+// Load reads the .env file (if present) and builds a Config from the environment
+func Load() *Config {
+	if err := godotenv.Load(); err != nil {
+		fmt.Println("Warning: .env file not found")
+	}
+
+	return &Config{
+		Debug: getEnvBool("DEBUG", false),
+		HTTP: HTTPConfig{
+			CORSAllowedOrigins:  getEnvList("CORS_ALLOWED_ORIGINS", []string{"*"}),
+			RequestTimeout:      getEnvDuration("HTTP_REQUEST_TIMEOUT", 10*time.Second),
+			AdminRequestTimeout: getEnvDuration("HTTP_ADMIN_REQUEST_TIMEOUT", 30*time.Second),
+			IdempotencyKeyTTL:   getEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+			IdempotencyLockTTL:  getEnvDuration("IDEMPOTENCY_LOCK_TTL", time.Minute),
+			CacheMaxAge:         getEnvDuration("HTTP_CACHE_MAX_AGE", 0),
+		},
+		Auth: AuthConfig{
+			ProtectReads: getEnvBool("AUTH_PROTECT_READS", false),
+			JWTSecret:    os.Getenv("JWT_HS256_SECRET"),
+			JWKSFile:     os.Getenv("JWT_JWKS_FILE"),
+			JWTIssuer:    os.Getenv("JWT_ISSUER"),
+			JWTAudience:  os.Getenv("JWT_AUDIENCE"),
+
+			SessionTTL:          getEnvDuration("SESSION_TTL", 24*time.Hour),
+			SessionCookieSecure: getEnvBool("SESSION_COOKIE_SECURE", true),
+			PasswordResetTTL:    getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+			PasswordResetURL:    getEnv("PASSWORD_RESET_URL", "http://localhost:8787/reset-password?token="),
+		},
+		Cache: CacheConfig{
+			Driver:     getEnv("CACHE_DRIVER", "memory"),
+			TTL:        getEnvDuration("CACHE_TTL", time.Minute),
+			MaxEntries: getEnvInt("CACHE_MAX_ENTRIES", 10000),
+			RedisURL:   getEnv("CACHE_REDIS_URL", "redis://localhost:6379/0"),
+		},
+		Database: DatabaseConfig{
+			Pool: PoolConfig{
+				MaxOpenConns:    getEnvInt("MYSQL_MAX_OPEN_CONNS", 25),
+				MaxIdleConns:    getEnvInt("MYSQL_MAX_IDLE_CONNS", 5),
+				ConnMaxLifetime: getEnvDuration("MYSQL_CONN_MAX_LIFETIME", 5*time.Minute),
+				ConnMaxIdleTime: getEnvDuration("MYSQL_CONN_MAX_IDLE_TIME", time.Minute),
+			},
+			StatsInterval: getEnvDuration("MYSQL_POOL_STATS_INTERVAL", time.Minute),
+
+			ReplicaDSNs:          getEnvList("MYSQL_REPLICA_DSNS", nil),
+			ReplicaCheckInterval: getEnvDuration("MYSQL_REPLICA_CHECK_INTERVAL", 5*time.Second),
+		},
+		GraphQL: GraphQLConfig{
+			MaxDepth:      getEnvInt("GRAPHQL_MAX_DEPTH", 10),
+			MaxComplexity: getEnvInt("GRAPHQL_MAX_COMPLEXITY", 5000),
+		},
+		GRPC: GRPCConfig{
+			Enabled:    getEnvBool("GRPC_ENABLED", true),
+			Addr:       getEnv("GRPC_ADDR", ":9090"),
+			Reflection: getEnvBool("GRPC_REFLECTION", true),
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:     getEnvBool("RATE_LIMIT_ENABLED", true),
+			Read:        getEnvRateLimit("RATE_LIMIT_READ", RateLimit{Rate: 20, Burst: 40}),
+			Write:       getEnvRateLimit("RATE_LIMIT_WRITE", RateLimit{Rate: 5, Burst: 10}),
+			Auth:        getEnvRateLimit("RATE_LIMIT_AUTH", RateLimit{Rate: 0.2, Burst: 5}),
+			Credentials: getEnvRateLimit("RATE_LIMIT_CREDENTIALS", RateLimit{Rate: 20, Burst: 40}),
+		},
+		Mailer: MailerConfig{
+			Driver:   getEnv("MAILER", "log"),
+			From:     getEnv("MAILER_FROM", "no-reply@localhost"),
+			FilePath: getEnv("MAILER_FILE", "mail.log"),
+		},
+		Outbox: OutboxConfig{
+			Sinks:        getEnvList("OUTBOX_SINKS", []string{"log"}),
+			PollInterval: getEnvDuration("OUTBOX_POLL_INTERVAL", time.Second),
+			BatchSize:    getEnvInt("OUTBOX_BATCH_SIZE", 100),
+			MaxAttempts:  getEnvInt("OUTBOX_MAX_ATTEMPTS", 20),
+			RetryBackoff: getEnvDuration("OUTBOX_RETRY_BACKOFF", time.Second),
+
+			FilePath:          getEnv("OUTBOX_FILE", "events.ndjson"),
+			WebhookURL:        os.Getenv("OUTBOX_WEBHOOK_URL"),
+			NATSURL:           getEnv("OUTBOX_NATS_URL", "nats://localhost:4222"),
+			NATSSubjectPrefix: getEnv("OUTBOX_NATS_SUBJECT_PREFIX", "events"),
+		},
+		Shutdown: ShutdownConfig{
+			ServerTimeout: getEnvDuration("SHUTDOWN_SERVER_TIMEOUT", 30*time.Second),
+			WorkerTimeout: getEnvDuration("SHUTDOWN_WORKER_TIMEOUT", 10*time.Second),
+		},
+		Stream: StreamConfig{
+			BufferSize:   getEnvInt("STREAM_BUFFER_SIZE", 1000),
+			Heartbeat:    getEnvDuration("STREAM_HEARTBEAT", 15*time.Second),
+			PollInterval: getEnvDuration("STREAM_POLL_INTERVAL", time.Second),
+
+			WSMaxConnections: getEnvInt("WS_MAX_CONNECTIONS", 1000),
+			WSPingInterval:   getEnvDuration("WS_PING_INTERVAL", 30*time.Second),
+		},
+		Webhooks: WebhooksConfig{
+			Enabled:      getEnvBool("WEBHOOKS_ENABLED", true),
+			PollInterval: getEnvDuration("WEBHOOKS_POLL_INTERVAL", time.Second),
+			BatchSize:    getEnvInt("WEBHOOKS_BATCH_SIZE", 50),
+			Timeout:      getEnvDuration("WEBHOOKS_TIMEOUT", 10*time.Second),
+			MaxAttempts:  getEnvInt("WEBHOOKS_MAX_ATTEMPTS", 10),
+			RetryBackoff: getEnvDuration("WEBHOOKS_RETRY_BACKOFF", 30*time.Second),
+			DisableAfter: getEnvInt("WEBHOOKS_DISABLE_AFTER", 20),
+		},
+		Telemetry: TelemetryConfig{
+			ServiceName:  getEnv("OTEL_SERVICE_NAME", "crud-app"),
+			Exporter:     getEnv("OTEL_TRACES_EXPORTER", "none"),
+			OTLPEndpoint: getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318"),
+			FilePath:     getEnv("OTEL_TRACES_FILE", "traces.json"),
+			SampleRatio:  getEnvFloat("OTEL_TRACES_SAMPLE_RATIO", 1),
+		},
+	}
+}
+
+// getEnv returns the value of key, or defaultValue if it is unset or empty
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvInt returns the integer value of key, or defaultValue if it is unset or invalid
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvFloat returns the float value of key, or defaultValue if it is unset or invalid
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvBool returns the boolean value of key, or defaultValue if it is unset or invalid
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvDuration returns the duration value of key, or defaultValue if it is unset or invalid
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvList returns the comma separated values of key, or defaultValue if it is unset
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvRateLimit parses a "rate,burst" value such as "20,40", or returns
+// defaultValue if key is unset or invalid
+func getEnvRateLimit(key string, defaultValue RateLimit) RateLimit {
+	rate, burst, ok := strings.Cut(os.Getenv(key), ",")
+	if !ok {
+		return defaultValue
+	}
+
+	var limit RateLimit
+	var err error
+	if limit.Rate, err = strconv.ParseFloat(strings.TrimSpace(rate), 64); err != nil || limit.Rate <= 0 {
+		return defaultValue
+	}
+	if limit.Burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil || limit.Burst < 1 {
+		return defaultValue
+	}
+	return limit
+}
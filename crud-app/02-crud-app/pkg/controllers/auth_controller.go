@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"context"
+	"crud-app/pkg/auth"
+	"crud-app/pkg/config"
+	"crud-app/pkg/mailer"
+	"crud-app/pkg/models"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dummyPasswordHash is verified against when an email is unknown, so login
+// takes about as long whether or not the account exists
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := auth.HashPassword("dummy-password")
+	return hash
+})
+
+// AuthController handles account registration, login and password resets
+type AuthController struct {
+	mailer mailer.Mailer
+	cfg    config.AuthConfig
+}
+
+// NewAuthController creates a new AuthController
+func NewAuthController(m mailer.Mailer, cfg config.AuthConfig) *AuthController {
+	return &AuthController{mailer: m, cfg: cfg}
+}
+
+// registerRequest is the body of POST /auth/register
+type registerRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Address  string `json:"address"`
+	Country  string `json:"country"`
+}
+
+// Register handles POST /auth/register
+func (ac *AuthController) Register(w http.ResponseWriter, r *http.Request) {
+	var req registerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	// Basic validation
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	if req.Name == "" || !strings.Contains(req.Email, "@") {
+		respondError(w, r, http.StatusBadRequest, "Name and a valid email are required")
+		return
+	}
+	if len(req.Password) < auth.MinPasswordLength {
+		respondError(w, r, http.StatusBadRequest, fmt.Sprintf("Password must be at least %d characters", auth.MinPasswordLength))
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error creating account: %v", err))
+		return
+	}
+
+	user := models.User{Name: req.Name, Address: req.Address, Country: req.Country}
+	id, err := models.CreateAccount(r.Context(), user, req.Email, hash, string(auth.RoleRegistered))
+	if err != nil {
+		if err.Error() == "email already registered" {
+			respondError(w, r, http.StatusConflict, "Email already registered")
+			return
+		}
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error creating account: %v", err))
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "Account created successfully",
+		"id":      id,
+	}
+	respond(w, r, http.StatusCreated, response)
+}
+
+// loginRequest is the body of POST /auth/login
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// Login handles POST /auth/login by starting a session
+func (ac *AuthController) Login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	account, err := models.GetAccountByEmail(r.Context(), strings.ToLower(strings.TrimSpace(req.Email)))
+	if err != nil && err.Error() != "account not found" {
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error logging in: %v", err))
+		return
+	}
+	if account == nil {
+		auth.VerifyPassword(req.Password, dummyPasswordHash())
+		respondError(w, r, http.StatusUnauthorized, "Invalid email or password")
+		return
+	}
+	if !auth.VerifyPassword(req.Password, account.PasswordHash) {
+		respondError(w, r, http.StatusUnauthorized, "Invalid email or password")
+		return
+	}
+
+	token, err := models.NewToken("")
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error logging in: %v", err))
+		return
+	}
+	csrfToken, err := models.NewToken("")
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error logging in: %v", err))
+		return
+	}
+
+	expiresAt := time.Now().Add(ac.cfg.SessionTTL)
+	err = models.CreateSession(r.Context(), models.HashToken(token), account.ID, csrfToken, expiresAt)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error logging in: %v", err))
+		return
+	}
+
+	auth.SetSessionCookies(w, token, csrfToken, expiresAt, ac.cfg.SessionCookieSecure)
+	response := map[string]interface{}{
+		"message":    "Logged in successfully",
+		"user_id":    account.ID,
+		"csrf_token": csrfToken,
+		"expires_at": expiresAt.UTC(),
+	}
+	respond(w, r, http.StatusOK, response)
+}
+
+// Logout handles POST /auth/logout by ending the current session
+func (ac *AuthController) Logout(w http.ResponseWriter, r *http.Request) {
+	if token := auth.SessionToken(r); token != "" {
+		if err := models.DeleteSession(r.Context(), models.HashToken(token)); err != nil {
+			respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error logging out: %v", err))
+			return
+		}
+	}
+
+	auth.ClearSessionCookies(w, ac.cfg.SessionCookieSecure)
+	respond(w, r, http.StatusOK, map[string]string{"message": "Logged out successfully"})
+}
+
+// RequestPasswordReset handles POST /auth/password-reset.
+// It always responds 202 so callers can't probe which emails are registered.
+func (ac *AuthController) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	if err := ac.sendPasswordReset(r, strings.ToLower(strings.TrimSpace(req.Email))); err != nil {
+		log.Printf("Error sending password reset: %v", err)
+	}
+
+	response := map[string]string{
+		"message": "If the email is registered, a password reset link has been sent",
+	}
+	respond(w, r, http.StatusAccepted, response)
+}
+
+// sendPasswordReset creates a reset token for the account and mails the link
+func (ac *AuthController) sendPasswordReset(r *http.Request, email string) error {
+	account, err := models.GetAccountByEmail(r.Context(), email)
+	if err != nil {
+		if err.Error() == "account not found" {
+			return nil
+		}
+		return err
+	}
+
+	token, err := models.NewToken("")
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(ac.cfg.PasswordResetTTL)
+	if err := models.CreatePasswordReset(r.Context(), models.HashToken(token), account.ID, expiresAt); err != nil {
+		return err
+	}
+
+	return ac.mailer.Send(r.Context(), mailer.Message{
+		To:      account.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this link to reset your password. It expires in %s.\n\n%s%s\n",
+			account.Name, ac.cfg.PasswordResetTTL, ac.cfg.PasswordResetURL, token),
+	})
+}
+
+// ConfirmPasswordReset handles POST /auth/password-reset/confirm
+func (ac *AuthController) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	if len(req.Password) < auth.MinPasswordLength {
+		respondError(w, r, http.StatusBadRequest, fmt.Sprintf("Password must be at least %d characters", auth.MinPasswordLength))
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error resetting password: %v", err))
+		return
+	}
+
+	// All or nothing, so a failure part way through doesn't use up the token
+	// without changing the password, or leave old sessions logged in
+	err = models.WithTx(r.Context(), func(ctx context.Context, tx *sql.Tx) error {
+		userID, err := models.ConsumePasswordReset(ctx, models.HashToken(req.Token))
+		if err != nil {
+			return err
+		}
+		if err := models.UpdatePasswordHash(ctx, userID, hash); err != nil {
+			return err
+		}
+		// Log out everywhere, in case the old password was compromised
+		return models.DeleteUserSessions(ctx, userID)
+	})
+	if err != nil {
+		if err.Error() == "password reset not found" {
+			respondError(w, r, http.StatusBadRequest, "Invalid or expired reset token")
+			return
+		}
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error resetting password: %v", err))
+		return
+	}
+
+	respond(w, r, http.StatusOK, map[string]string{"message": "Password reset successfully"})
+}
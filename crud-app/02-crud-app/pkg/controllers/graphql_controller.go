@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"crud-app/pkg/config"
+	"crud-app/pkg/middleware"
+	"crud-app/pkg/render"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/location"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// maxGraphQLBodySize is the largest GraphQL request body accepted
+const maxGraphQLBodySize = 1 << 20
+
+// GraphQLController serves GraphQL queries and mutations over the users model
+type GraphQLController struct {
+	schema        graphql.Schema
+	maxDepth      int
+	maxComplexity int
+	mutations     middleware.Middleware // Wraps running mutations, e.g. to rate-limit them; may be nil
+}
+
+// NewGraphQLController creates a new GraphQLController. Operations deeper or
+// more complex than the configured limits are rejected before they run.
+func NewGraphQLController(cfg config.GraphQLConfig) (*GraphQLController, error) {
+	schema, err := newUserSchema()
+	if err != nil {
+		return nil, fmt.Errorf("error building schema: %v", err)
+	}
+	if cfg.MaxDepth <= 0 {
+		cfg.MaxDepth = 10
+	}
+	if cfg.MaxComplexity <= 0 {
+		cfg.MaxComplexity = 5000
+	}
+	return &GraphQLController{schema: schema, maxDepth: cfg.MaxDepth, maxComplexity: cfg.MaxComplexity}, nil
+}
+
+// WrapMutations runs every mutation through m once it has been parsed and
+// validated, so mutations can be rate-limited like the REST routes that
+// modify users while queries keep the read limit
+func (gc *GraphQLController) WrapMutations(m middleware.Middleware) {
+	gc.mutations = m
+}
+
+// graphQLRequest is the body of a GraphQL request
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Serve handles GET and POST /graphql. GET takes the query, operationName and
+// variables query parameters and only runs queries; mutations must be POSTed.
+// Requests that fail to parse, validate or stay within the limits get a 400
+// and no data; errors from resolvers come back alongside the data with a 200.
+func (gc *GraphQLController) Serve(w http.ResponseWriter, r *http.Request) {
+	var req graphQLRequest
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if v := query.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				respondGraphQLErrors(w, http.StatusBadRequest, []gqlerrors.FormattedError{requestError("Invalid variables", codeBadUserInput)})
+				return
+			}
+		}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBodySize)).Decode(&req); err != nil {
+		respondGraphQLErrors(w, http.StatusBadRequest, []gqlerrors.FormattedError{requestError("Invalid JSON body", codeBadUserInput)})
+		return
+	}
+	if req.Query == "" {
+		respondGraphQLErrors(w, http.StatusBadRequest, []gqlerrors.FormattedError{requestError("query is required", codeBadUserInput)})
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		respondGraphQLErrors(w, http.StatusBadRequest, gqlerrors.FormatErrors(err))
+		return
+	}
+	if result := graphql.ValidateDocument(&gc.schema, doc, nil); !result.IsValid {
+		respondGraphQLErrors(w, http.StatusBadRequest, result.Errors)
+		return
+	}
+
+	op, err := findOperation(doc, req.OperationName)
+	if err != nil {
+		respondGraphQLErrors(w, http.StatusBadRequest, gqlerrors.FormatErrors(err))
+		return
+	}
+	if r.Method == http.MethodGet && op.Operation != ast.OperationTypeQuery {
+		w.Header().Set("Allow", "POST")
+		respondGraphQLErrors(w, http.StatusMethodNotAllowed, []gqlerrors.FormattedError{
+			requestError(fmt.Sprintf("%s operations must use POST", op.Operation), codeBadUserInput),
+		})
+		return
+	}
+
+	cost := measureOperation(doc, op, req.Variables)
+	if cost.depth > gc.maxDepth {
+		respondGraphQLErrors(w, http.StatusBadRequest, []gqlerrors.FormattedError{
+			requestError(fmt.Sprintf("Query depth %d exceeds the limit of %d", cost.depth, gc.maxDepth), "QUERY_TOO_DEEP"),
+		})
+		return
+	}
+	if cost.introspectionDepth > maxIntrospectionDepth {
+		respondGraphQLErrors(w, http.StatusBadRequest, []gqlerrors.FormattedError{
+			requestError(fmt.Sprintf("Introspection depth %d exceeds the limit of %d", cost.introspectionDepth, maxIntrospectionDepth), "QUERY_TOO_DEEP"),
+		})
+		return
+	}
+	if cost.complexity > gc.maxComplexity {
+		respondGraphQLErrors(w, http.StatusBadRequest, []gqlerrors.FormattedError{
+			requestError(fmt.Sprintf("Query complexity %d exceeds the limit of %d", cost.complexity, gc.maxComplexity), "QUERY_TOO_COMPLEX"),
+		})
+		return
+	}
+
+	var execute http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := graphql.Execute(graphql.ExecuteParams{
+			Schema:        gc.schema,
+			AST:           doc,
+			OperationName: req.OperationName,
+			Args:          req.Variables,
+			Context:       r.Context(),
+		})
+		render.JSON(w, http.StatusOK, result)
+	})
+	if op.Operation == ast.OperationTypeMutation && gc.mutations != nil {
+		execute = gc.mutations(execute)
+	}
+	execute.ServeHTTP(w, r)
+}
+
+// findOperation returns the operation named name, or the only operation in
+// doc if name is empty
+func findOperation(doc *ast.Document, name string) (*ast.OperationDefinition, error) {
+	var found *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			if found != nil {
+				return nil, fmt.Errorf("operationName is required when the query contains several operations")
+			}
+			found = op
+		} else if op.Name != nil && op.Name.Value == name {
+			return op, nil
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("unknown operation %q", name)
+	}
+	return found, nil
+}
+
+// requestError builds an error for a request rejected before it ran
+func requestError(message, code string) gqlerrors.FormattedError {
+	return gqlerrors.FormattedError{
+		Message:    message,
+		Locations:  []location.SourceLocation{},
+		Extensions: map[string]interface{}{"code": code},
+	}
+}
+
+// respondGraphQLErrors writes a GraphQL response carrying only errors.
+// GraphQL responses are always JSON, whatever the Accept header says.
+func respondGraphQLErrors(w http.ResponseWriter, status int, errs []gqlerrors.FormattedError) {
+	render.JSON(w, status, map[string]interface{}{"errors": errs})
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// pagedFields are the fields that return a page of up to "first" items
+var pagedFields = map[string]bool{"users": true}
+
+// maxIntrospectionDepth limits the depth of __schema and __type selections.
+// They are checked against this instead of the configured MaxDepth because
+// the introspection query tools send nests ofType about ten levels deep.
+const maxIntrospectionDepth = 15
+
+// operationCost is how deep and how expensive a GraphQL operation is
+type operationCost struct {
+	depth              int // Deepest selection outside introspection
+	introspectionDepth int // Deepest __schema or __type selection
+	complexity         int
+}
+
+// queryCost measures how deep and how expensive a GraphQL operation is
+// before it runs. The document must already have passed validation, so
+// fragments exist and don't form cycles.
+type queryCost struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+// measureOperation returns the cost of op.
+//
+// Each field costs 1 plus the cost of its selections. Paged fields return a
+// list, so their selections are counted once per item. Only __typename is
+// free; introspection fields cost the same as any other field, but their
+// depth is measured separately.
+func measureOperation(doc *ast.Document, op *ast.OperationDefinition, variables map[string]interface{}) operationCost {
+	qc := queryCost{fragments: map[string]*ast.FragmentDefinition{}, variables: variables}
+	for _, def := range doc.Definitions {
+		if fragment, ok := def.(*ast.FragmentDefinition); ok {
+			qc.fragments[fragment.Name.Value] = fragment
+		}
+	}
+	return qc.measure(op.SelectionSet)
+}
+
+// measure returns the cost of a selection set
+func (qc queryCost) measure(set *ast.SelectionSet) operationCost {
+	var cost operationCost
+	if set == nil {
+		return cost
+	}
+
+	for _, selection := range set.Selections {
+		var sub operationCost
+		switch sel := selection.(type) {
+		case *ast.Field:
+			if sel.Name.Value == "__typename" {
+				continue
+			}
+			sub = qc.measure(sel.SelectionSet)
+			sub.depth++
+			sub.complexity = 1 + qc.listSize(sel)*sub.complexity
+
+			// Everything below __schema and __type is introspection
+			if sel.Name.Value == "__schema" || sel.Name.Value == "__type" {
+				sub.introspectionDepth = sub.depth
+				sub.depth = 0
+			}
+		case *ast.InlineFragment:
+			sub = qc.measure(sel.SelectionSet)
+		case *ast.FragmentSpread:
+			if fragment, ok := qc.fragments[sel.Name.Value]; ok {
+				sub = qc.measure(fragment.SelectionSet)
+			}
+		}
+		cost.depth = max(cost.depth, sub.depth)
+		cost.introspectionDepth = max(cost.introspectionDepth, sub.introspectionDepth)
+		cost.complexity += sub.complexity
+	}
+	return cost
+}
+
+// listSize returns how many items field may return: its "first" argument,
+// or the default page size if that is omitted. Other fields count as 1.
+func (qc queryCost) listSize(field *ast.Field) int {
+	if !pagedFields[field.Name.Value] {
+		return 1
+	}
+
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+
+		// Larger values are rejected by the resolver anyway
+		switch value := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(value.Value); err == nil && n > 0 {
+				return min(n, maxPageSize)
+			}
+		case *ast.Variable:
+			switch n := qc.variables[value.Name.Value].(type) {
+			case float64: // JSON numbers
+				if n > 0 {
+					return int(min(n, maxPageSize))
+				}
+			case int:
+				if n > 0 {
+					return min(n, maxPageSize)
+				}
+			}
+		}
+	}
+	return defaultPageSize
+}
@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"crud-app/pkg/auth"
+	"crud-app/pkg/authz"
+	"crud-app/pkg/models"
+	"fmt"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+)
+
+// Error codes returned in the extensions of GraphQL errors
+const (
+	codeBadUserInput    = "BAD_USER_INPUT"
+	codeUnauthenticated = "UNAUTHENTICATED"
+	codeForbidden       = "FORBIDDEN"
+	codeNotFound        = "NOT_FOUND"
+	codeInternal        = "INTERNAL_SERVER_ERROR"
+)
+
+// graphQLError is a resolver error with a machine-readable code in its extensions
+type graphQLError struct {
+	message string
+	code    string
+}
+
+func (e *graphQLError) Error() string {
+	return e.message
+}
+
+// Extensions implements gqlerrors.ExtendedError
+func (e *graphQLError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+// userConnection is one page of users
+type userConnection struct {
+	Nodes    []models.User `json:"nodes"`
+	PageInfo pageInfo      `json:"pageInfo"`
+}
+
+// pageInfo tells clients how to fetch the next page
+type pageInfo struct {
+	EndCursor   *string `json:"endCursor"`
+	HasNextPage bool    `json:"hasNextPage"`
+}
+
+// newUserSchema builds the GraphQL schema over the users model
+func newUserSchema() (graphql.Schema, error) {
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "User",
+		Description: "A user record",
+		Fields: graphql.Fields{
+			"id":      &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"name":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"address": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"country": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+
+	pageInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"endCursor": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Pass as after to fetch the next page",
+			},
+			"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		},
+	})
+
+	userConnectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "UserConnection",
+		Fields: graphql.Fields{
+			"nodes":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType)))},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+		},
+	})
+
+	userFilterType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "UserFilter",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"country":      &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"nameContains": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+
+	createUserInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "CreateUserInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":    &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"address": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"country": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+
+	updateUserInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "UpdateUserInput",
+		Description: "Fields to change; omitted fields are left as they are",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":    &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"address": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"country": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"user": &graphql.Field{
+				Type:        userType,
+				Description: "Look up a user by ID; null if there is none",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: resolveUser,
+			},
+			"users": &graphql.Field{
+				Type:        graphql.NewNonNull(userConnectionType),
+				Description: "List users in ID order",
+				Args: graphql.FieldConfigArgument{
+					"first":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize},
+					"after":  &graphql.ArgumentConfig{Type: graphql.String},
+					"filter": &graphql.ArgumentConfig{Type: userFilterType},
+				},
+				Resolve: resolveUsers,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createUser": &graphql.Field{
+				Type:        graphql.NewNonNull(userType),
+				Description: "Requires the editor role",
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createUserInputType)},
+				},
+				Resolve: resolveCreateUser,
+			},
+			"updateUser": &graphql.Field{
+				Type:        graphql.NewNonNull(userType),
+				Description: "Requires the admin role, except for your own user",
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(updateUserInputType)},
+				},
+				Resolve: resolveUpdateUser,
+			},
+			"deleteUser": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.ID),
+				Description: "Requires the admin role. Returns the deleted user's ID.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: resolveDeleteUser,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// resolveUser resolves Query.user
+func resolveUser(p graphql.ResolveParams) (interface{}, error) {
+	id, err := parseUserID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := models.GetUserByID(p.Context, id)
+	if err != nil {
+		if err.Error() == "user not found" {
+			return nil, nil
+		}
+		return nil, &graphQLError{fmt.Sprintf("Error fetching user: %v", err), codeInternal}
+	}
+	return user, nil
+}
+
+// resolveUsers resolves Query.users. One extra user is fetched to tell
+// whether there is a next page.
+func resolveUsers(p graphql.ResolveParams) (interface{}, error) {
+	first, _ := p.Args["first"].(int)
+	if first < 1 || first > maxPageSize {
+		return nil, &graphQLError{fmt.Sprintf("first must be between 1 and %d", maxPageSize), codeBadUserInput}
+	}
+
+	var afterID int
+	if after, ok := p.Args["after"].(string); ok && after != "" {
+		var err error
+		afterID, err = decodeCursor(after)
+		if err != nil {
+			return nil, &graphQLError{"invalid cursor", codeBadUserInput}
+		}
+	}
+
+	var filter models.UserFilter
+	if f, ok := p.Args["filter"].(map[string]interface{}); ok {
+		filter.Country, _ = f["country"].(string)
+		filter.NameContains, _ = f["nameContains"].(string)
+	}
+
+	users, err := models.FindUsers(p.Context, filter, afterID, first+1)
+	if err != nil {
+		return nil, &graphQLError{fmt.Sprintf("Error fetching users: %v", err), codeInternal}
+	}
+
+	conn := userConnection{Nodes: users}
+	if len(users) > first {
+		conn.Nodes = users[:first]
+		conn.PageInfo.HasNextPage = true
+	}
+	if len(conn.Nodes) > 0 {
+		lastID, _ := strconv.Atoi(conn.Nodes[len(conn.Nodes)-1].ID)
+		cursor := encodeCursor(lastID)
+		conn.PageInfo.EndCursor = &cursor
+	}
+	if conn.Nodes == nil {
+		conn.Nodes = []models.User{}
+	}
+	return conn, nil
+}
+
+// resolveCreateUser resolves Mutation.createUser
+func resolveCreateUser(p graphql.ResolveParams) (interface{}, error) {
+	if err := authorize(p, authz.Editors, ""); err != nil {
+		return nil, err
+	}
+
+	input, _ := p.Args["input"].(map[string]interface{})
+	var user models.User
+	user.Name, _ = input["name"].(string)
+	user.Address, _ = input["address"].(string)
+	user.Country, _ = input["country"].(string)
+
+	// Basic validation
+	if user.Name == "" || user.Address == "" || user.Country == "" {
+		return nil, &graphQLError{"Name, address, and country are required", codeBadUserInput}
+	}
+
+	id, err := models.CreateUser(p.Context, user)
+	if err != nil {
+		return nil, &graphQLError{fmt.Sprintf("Error creating user: %v", err), codeInternal}
+	}
+
+	user.ID = strconv.Itoa(id)
+	return user, nil
+}
+
+// resolveUpdateUser resolves Mutation.updateUser, changing only the given fields
+func resolveUpdateUser(p graphql.ResolveParams) (interface{}, error) {
+	rawID, _ := p.Args["id"].(string)
+	if err := authorize(p, authz.OwnerOrAdmin, rawID); err != nil {
+		return nil, err
+	}
+	id, err := parseUserID(rawID)
+	if err != nil {
+		return nil, err
+	}
+
+	input, _ := p.Args["input"].(map[string]interface{})
+	var patch models.UserPatch
+	for field, dest := range map[string]**string{"name": &patch.Name, "address": &patch.Address, "country": &patch.Country} {
+		if value, ok := input[field].(string); ok {
+			*dest = &value
+		}
+	}
+
+	// Basic validation
+	if patch.Name == nil && patch.Address == nil && patch.Country == nil {
+		return nil, &graphQLError{"At least one of name, address or country is required", codeBadUserInput}
+	}
+	for _, field := range []*string{patch.Name, patch.Address, patch.Country} {
+		if field != nil && *field == "" {
+			return nil, &graphQLError{"Name, address, and country cannot be empty", codeBadUserInput}
+		}
+	}
+
+	if err := models.PatchUser(p.Context, id, patch); err != nil {
+		if err.Error() == "user not found" {
+			return nil, &graphQLError{"User not found", codeNotFound}
+		}
+		return nil, &graphQLError{fmt.Sprintf("Error updating user: %v", err), codeInternal}
+	}
+
+	user, err := models.GetUserByID(p.Context, id)
+	if err != nil {
+		if err.Error() == "user not found" {
+			return nil, &graphQLError{"User not found", codeNotFound}
+		}
+		return nil, &graphQLError{fmt.Sprintf("Error fetching user: %v", err), codeInternal}
+	}
+	return user, nil
+}
+
+// resolveDeleteUser resolves Mutation.deleteUser
+func resolveDeleteUser(p graphql.ResolveParams) (interface{}, error) {
+	if err := authorize(p, authz.Admins, ""); err != nil {
+		return nil, err
+	}
+	id, err := parseUserID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := models.DeleteUser(p.Context, id); err != nil {
+		if err.Error() == "user not found" {
+			return nil, &graphQLError{"User not found", codeNotFound}
+		}
+		return nil, &graphQLError{fmt.Sprintf("Error deleting user: %v", err), codeInternal}
+	}
+	return strconv.Itoa(id), nil
+}
+
+// authorize checks the caller against pol. userID is the user the mutation
+// touches, for policies that let users change their own record.
+func authorize(p graphql.ResolveParams, pol authz.Policy, userID string) error {
+	principal := auth.FromContext(p.Context)
+	if principal == nil {
+		return &graphQLError{"Unauthorized", codeUnauthenticated}
+	}
+	if !pol.Allows(principal, map[string]string{"id": userID}) {
+		return &graphQLError{"Forbidden", codeForbidden}
+	}
+	return nil
+}
+
+// parseUserID converts an ID argument to a user ID
+func parseUserID(v interface{}) (int, error) {
+	s, _ := v.(string)
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, &graphQLError{"Invalid user ID", codeBadUserInput}
+	}
+	return id, nil
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"crud-app/pkg/auth"
+	"crud-app/pkg/config"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// graphQLResult is the decoded body of a GraphQL response
+type graphQLResult struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func serveGraphQL(t *testing.T, cfg config.GraphQLConfig, r *http.Request) (int, graphQLResult) {
+	gc, err := NewGraphQLController(cfg)
+	if err != nil {
+		t.Fatalf("NewGraphQLController: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	gc.Serve(w, r)
+
+	var result graphQLResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, result
+}
+
+func postGraphQL(query string, variables map[string]interface{}) *http.Request {
+	body, _ := json.Marshal(graphQLRequest{Query: query, Variables: variables})
+	return httptest.NewRequest("POST", "/graphql", strings.NewReader(string(body)))
+}
+
+func TestMeasureOperation(t *testing.T) {
+	for _, tc := range []struct {
+		query     string
+		variables map[string]interface{}
+		want      operationCost
+	}{
+		{`{ user(id: "1") { id name } }`, nil, operationCost{2, 0, 3}},
+		{`{ users { nodes { id } } }`, nil, operationCost{3, 0, 1 + defaultPageSize*2}},
+		{`{ users(first: 10) { nodes { id name } pageInfo { hasNextPage } } }`, nil, operationCost{3, 0, 1 + 10*5}},
+		{`query($n: Int) { users(first: $n) { nodes { id } } }`, map[string]interface{}{"n": float64(20)}, operationCost{3, 0, 1 + 20*2}},
+		{`{ users(first: 100000) { nodes { id } } }`, nil, operationCost{3, 0, 1 + maxPageSize*2}},
+		{`{ ...Q } fragment Q on Query { users(first: 1) { nodes { ... on User { id } } } }`, nil, operationCost{3, 0, 3}},
+		// __schema { types { name fields { name type { name } } } } costs 7
+		{`{ __schema { types { name fields { name type { name } } } } user(id: "1") { __typename id } }`, nil, operationCost{2, 5, 2 + 7}},
+		{`{ __type(name: "User") { ...T } } fragment T on __Type { ofType { ofType { name } } }`, nil, operationCost{0, 4, 4}},
+	} {
+		doc, err := parser.Parse(parser.ParseParams{Source: tc.query})
+		if err != nil {
+			t.Fatalf("parsing %q: %v", tc.query, err)
+		}
+		var op *ast.OperationDefinition
+		for _, def := range doc.Definitions {
+			if o, ok := def.(*ast.OperationDefinition); ok {
+				op = o
+			}
+		}
+
+		if got := measureOperation(doc, op, tc.variables); got != tc.want {
+			t.Errorf("%s: cost %+v, want %+v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestGraphQLRejectsBeforeRunning(t *testing.T) {
+	shallow := config.GraphQLConfig{MaxDepth: 2, MaxComplexity: 1000}
+	cheap := config.GraphQLConfig{MaxDepth: 10, MaxComplexity: 200}
+	for _, tc := range []struct {
+		name     string
+		cfg      config.GraphQLConfig
+		query    string
+		wantCode string
+	}{
+		{"syntax error", shallow, `{ users { `, ""},
+		{"unknown field", shallow, `{ users { nodes { email } } }`, ""},
+		{"too deep", shallow, `{ users(first: 1) { nodes { id } } }`, "QUERY_TOO_DEEP"},
+		{"too deep via fragment", shallow, `{ ...Q } fragment Q on Query { users(first: 1) { nodes { id } } }`, "QUERY_TOO_DEEP"},
+		{"too complex", cheap, `{ users { nodes { id name address country } } }`, "QUERY_TOO_COMPLEX"},
+		{"introspection too deep", shallow, `{ __type(name: "User") { ` + strings.Repeat("ofType { ", maxIntrospectionDepth) + "name" + strings.Repeat(" }", maxIntrospectionDepth) + " } }", "QUERY_TOO_DEEP"},
+		{"introspection too complex", config.GraphQLConfig{MaxDepth: 10, MaxComplexity: 5}, `{ __schema { types { name fields { name type { name } } } } }`, "QUERY_TOO_COMPLEX"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			code, result := serveGraphQL(t, tc.cfg, postGraphQL(tc.query, nil))
+			if code != http.StatusBadRequest || len(result.Errors) == 0 || result.Data != nil {
+				t.Fatalf("status %d, %d errors, data %v; want 400 with errors only", code, len(result.Errors), result.Data)
+			}
+			if tc.wantCode != "" && result.Errors[0].Extensions["code"] != tc.wantCode {
+				t.Errorf("error %q has code %v, want %s", result.Errors[0].Message, result.Errors[0].Extensions["code"], tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestGraphQLMutationPolicies(t *testing.T) {
+	editor := &auth.Principal{Subject: "7", Method: auth.MethodJWT, Role: auth.RoleEditor, UserID: 7}
+
+	for _, tc := range []struct {
+		name      string
+		principal *auth.Principal
+		query     string
+		wantCode  string
+	}{
+		{"anonymous create", nil, `mutation { createUser(input: {name: "a", address: "b", country: "c"}) { id } }`, codeUnauthenticated},
+		{"editor update other", editor, `mutation { updateUser(id: "8", input: {name: "a"}) { id } }`, codeForbidden},
+		{"editor update own", editor, `mutation { updateUser(id: "7", input: {}) { id } }`, codeBadUserInput},
+		{"editor delete", editor, `mutation { deleteUser(id: "7") }`, codeForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := postGraphQL(tc.query, nil)
+			if tc.principal != nil {
+				r = r.WithContext(auth.WithPrincipal(r.Context(), tc.principal))
+			}
+
+			code, result := serveGraphQL(t, config.GraphQLConfig{}, r)
+			if code != http.StatusOK || len(result.Errors) != 1 {
+				t.Fatalf("status %d, %d errors; want 200 with one error", code, len(result.Errors))
+			}
+			if got := result.Errors[0].Extensions["code"]; got != tc.wantCode {
+				t.Errorf("error %q has code %v, want %s", result.Errors[0].Message, got, tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestGraphQLGetRejectsMutations(t *testing.T) {
+	query := url.Values{"query": {`mutation { deleteUser(id: "1") }`}}
+	code, result := serveGraphQL(t, config.GraphQLConfig{}, httptest.NewRequest("GET", "/graphql?"+query.Encode(), nil))
+	if code != http.StatusMethodNotAllowed || len(result.Errors) != 1 {
+		t.Errorf("status %d, %d errors; want 405 with one error", code, len(result.Errors))
+	}
+}
+
+func TestGraphQLWrapsOnlyMutations(t *testing.T) {
+	gc, err := NewGraphQLController(config.GraphQLConfig{})
+	if err != nil {
+		t.Fatalf("NewGraphQLController: %v", err)
+	}
+	wrapped := 0
+	gc.WrapMutations(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wrapped++
+			w.WriteHeader(http.StatusTooManyRequests)
+		})
+	})
+
+	w := httptest.NewRecorder()
+	gc.Serve(w, postGraphQL(`{ __typename }`, nil))
+	if w.Code != http.StatusOK || wrapped != 0 {
+		t.Errorf("query: status %d, wrapped %d times; want 200 and not wrapped", w.Code, wrapped)
+	}
+
+	w = httptest.NewRecorder()
+	gc.Serve(w, postGraphQL(`mutation { deleteUser(id: "1") }`, nil))
+	if w.Code != http.StatusTooManyRequests || wrapped != 1 {
+		t.Errorf("mutation: status %d, wrapped %d times; want the wrapper's 429", w.Code, wrapped)
+	}
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"crud-app/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRespondCacheable(t *testing.T) {
+	uc := NewUserController(0, false)
+	user := models.User{ID: "7", Name: "Ann", Address: "1 High St", Country: "UK"}
+	modified := time.Date(2026, 3, 1, 12, 0, 0, 500e6, time.UTC)
+
+	serve := func(header, value string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/users/7", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		uc.respondCacheable(w, r, user, modified)
+		return w
+	}
+
+	first := serve("", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || etag[:2] != "W/" {
+		t.Fatalf("got %d with ETag %q, want 200 with a weak ETag", first.Code, etag)
+	}
+	if got := first.Header().Get("Last-Modified"); got != "Sun, 01 Mar 2026 12:00:00 GMT" {
+		t.Errorf("Last-Modified = %q", got)
+	}
+	if got := first.Header().Get("Cache-Control"); got != "public, no-cache" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+
+	tests := []struct {
+		header, value string
+		status        int
+	}{
+		{"If-None-Match", etag, http.StatusNotModified},
+		{"If-None-Match", etag[2:], http.StatusNotModified}, // Weak comparison ignores W/
+		{"If-None-Match", `"other", ` + etag, http.StatusNotModified},
+		{"If-None-Match", "*", http.StatusNotModified},
+		{"If-None-Match", `W/"other"`, http.StatusOK},
+		{"If-Modified-Since", "Sun, 01 Mar 2026 12:00:00 GMT", http.StatusNotModified},
+		{"If-Modified-Since", "Sun, 01 Mar 2026 11:59:59 GMT", http.StatusOK},
+		{"If-Modified-Since", "yesterday", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := serve(tt.header, tt.value)
+		if w.Code != tt.status {
+			t.Errorf("%s: %s got %d, want %d", tt.header, tt.value, w.Code, tt.status)
+		}
+		if w.Code == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("ETag") != etag) {
+			t.Errorf("%s: %s: 304 has body %q and ETag %q", tt.header, tt.value, w.Body.String(), w.Header().Get("ETag"))
+		}
+	}
+
+	// If-None-Match wins over If-Modified-Since
+	r := httptest.NewRequest("GET", "/users/7", nil)
+	r.Header.Set("If-None-Match", `W/"other"`)
+	r.Header.Set("If-Modified-Since", "Sun, 01 Mar 2026 12:00:00 GMT")
+	w := httptest.NewRecorder()
+	uc.respondCacheable(w, r, user, modified)
+	if w.Code != http.StatusOK {
+		t.Errorf("mismatched If-None-Match with a current If-Modified-Since got %d, want 200", w.Code)
+	}
+
+	// The ETag follows the data
+	user.Name = "Bob"
+	if w := serve("If-None-Match", etag); w.Code != http.StatusOK {
+		t.Errorf("changed user got %d, want 200", w.Code)
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	tests := []struct {
+		maxAge       time.Duration
+		protectReads bool
+		want         string
+	}{
+		{0, false, "public, no-cache"},
+		{time.Minute, false, "public, max-age=60"},
+		{time.Minute, true, "private, max-age=60"},
+	}
+	for _, tt := range tests {
+		if got := cacheControl(tt.maxAge, tt.protectReads); got != tt.want {
+			t.Errorf("cacheControl(%v, %v) = %q, want %q", tt.maxAge, tt.protectReads, got, tt.want)
+		}
+	}
+}
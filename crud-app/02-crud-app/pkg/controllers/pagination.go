@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// NextCursorHeader carries the cursor for the next page of a list response
+	NextCursorHeader = "X-Next-Cursor"
+
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// page holds the pagination parameters parsed from a list request
+type page struct {
+	afterID int
+	limit   int
+}
+
+// parsePage reads the limit and cursor query parameters. ok is false if the
+// request asked for no pagination at all.
+func parsePage(r *http.Request) (p page, ok bool, err error) {
+	query := r.URL.Query()
+	if !query.Has("limit") && !query.Has("cursor") {
+		return page{}, false, nil
+	}
+
+	p.limit = defaultPageSize
+	if v := query.Get("limit"); v != "" {
+		p.limit, err = strconv.Atoi(v)
+		if err != nil || p.limit < 1 || p.limit > maxPageSize {
+			return page{}, true, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		p.afterID, err = decodeCursor(v)
+		if err != nil {
+			return page{}, true, fmt.Errorf("invalid cursor")
+		}
+	}
+
+	return p, true, nil
+}
+
+// setNextPage sets the X-Next-Cursor and Link headers pointing at the page after lastID
+func setNextPage(w http.ResponseWriter, r *http.Request, lastID int, limit int) {
+	cursor := encodeCursor(lastID)
+
+	next := url.URL{Path: r.URL.Path}
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("cursor", cursor)
+	next.RawQuery = query.Encode()
+
+	w.Header().Set(NextCursorHeader, cursor)
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.String()))
+}
+
+// encodeCursor turns a user ID into an opaque cursor
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("id:" + strconv.Itoa(id)))
+}
+
+// decodeCursor reverses encodeCursor
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	id, ok := strings.CutPrefix(string(raw), "id:")
+	if !ok {
+		return 0, fmt.Errorf("malformed cursor")
+	}
+	return strconv.Atoi(id)
+}
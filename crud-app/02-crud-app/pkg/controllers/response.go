@@ -0,0 +1,22 @@
+package controllers
+
+import (
+	"crud-app/pkg/render"
+	"net/http"
+)
+
+// ErrorResponse is the body returned for every error
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// respond writes v with the given status code, in the format the request's
+// Accept header asks for
+func respond(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	render.Respond(w, r, status, v)
+}
+
+// respondError writes an error body with the given status code
+func respondError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	respond(w, r, status, ErrorResponse{Error: message})
+}
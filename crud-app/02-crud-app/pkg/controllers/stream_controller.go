@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"crud-app/pkg/outbox"
+	"crud-app/pkg/stream"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StreamController pushes user change events to clients over Server-Sent Events
+type StreamController struct {
+	broker    *stream.Broker
+	heartbeat time.Duration
+}
+
+// NewStreamController creates a new StreamController. A comment line is sent
+// every heartbeat so proxies don't close idle streams.
+func NewStreamController(broker *stream.Broker, heartbeat time.Duration) *StreamController {
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
+	}
+	return &StreamController{broker: broker, heartbeat: heartbeat}
+}
+
+// StreamUsers handles GET /users/stream. Each event's SSE id is its event ID,
+// so a reconnecting client resumes from Last-Event-ID. If the events it missed
+// are no longer buffered, it gets a "reset" event and should refetch GET /users.
+func (sc *StreamController) StreamUsers(w http.ResponseWriter, r *http.Request) {
+	// EventSource sends Last-Event-ID when it reconnects; the query parameter
+	// lets a fresh page resume from an ID it stored itself
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var lastEventID int64
+	if lastID != "" {
+		var err error
+		lastEventID, err = strconv.ParseInt(lastID, 10, 64)
+		if err != nil || lastEventID < 0 {
+			respondError(w, r, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+	}
+
+	sub, backlog, complete := sc.broker.Subscribe(lastEventID)
+	defer sc.broker.Unsubscribe(sub)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx buffering the stream
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if !complete {
+		fmt.Fprintf(w, "event: reset\ndata: {\"last_event_id\":%d}\n\n", lastEventID)
+	}
+	for _, event := range backlog {
+		writeEvent(w, event)
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(sc.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			// Closed when the server shuts down or this client fell too far behind;
+			// either way the client reconnects and resumes
+			if !ok {
+				return
+			}
+			writeEvent(w, event)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes one SSE message
+func writeEvent(w io.Writer, event outbox.Event) {
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"bufio"
+	"crud-app/pkg/outbox"
+	"crud-app/pkg/stream"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseMessage is one Server-Sent Events message
+type sseMessage struct {
+	id, event string
+}
+
+// openStream starts GET /users/stream against broker with lastEventID, if
+// set, and returns the messages it sends. The channel is closed when the
+// stream ends.
+func openStream(t *testing.T, broker *stream.Broker, lastEventID string) <-chan sseMessage {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(NewStreamController(broker, time.Hour).StreamUsers))
+	t.Cleanup(srv.Close)
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+
+	messages := make(chan sseMessage, 64)
+	go func() {
+		defer close(messages)
+		var msg sseMessage
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if msg.event != "" {
+					messages <- msg
+				}
+				msg = sseMessage{}
+			case strings.HasPrefix(line, "id: "):
+				msg.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				msg.event = strings.TrimPrefix(line, "event: ")
+			}
+		}
+	}()
+	return messages
+}
+
+// next returns the next message, failing if none arrives
+func next(t *testing.T, messages <-chan sseMessage) sseMessage {
+	t.Helper()
+	select {
+	case msg, ok := <-messages:
+		if !ok {
+			t.Fatal("stream ended")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return sseMessage{}
+}
+
+// publish sends events with the given IDs through broker
+func publish(broker *stream.Broker, ids ...int64) {
+	for _, id := range ids {
+		broker.Publish(outbox.Event{ID: id, Type: "user.updated"})
+	}
+}
+
+func TestStreamUsersReplaysBacklog(t *testing.T) {
+	broker := stream.NewBroker(10)
+	publish(broker, 1, 2, 3)
+
+	messages := openStream(t, broker, "1")
+	for _, want := range []string{"2", "3"} {
+		if msg := next(t, messages); msg.id != want || msg.event != "user.updated" {
+			t.Errorf("got %+v, want event %s", msg, want)
+		}
+	}
+
+	// Live events follow the backlog
+	publish(broker, 4)
+	if msg := next(t, messages); msg.id != "4" {
+		t.Errorf("got %+v, want event 4", msg)
+	}
+}
+
+func TestStreamUsersSendsResetWhenBacklogIsGone(t *testing.T) {
+	broker := stream.NewBroker(2)
+	publish(broker, 1, 2, 3, 4) // Only 3 and 4 are kept
+
+	messages := openStream(t, broker, "1")
+	if msg := next(t, messages); msg.event != "reset" {
+		t.Fatalf("got %+v, want a reset event first", msg)
+	}
+	for _, want := range []string{"3", "4"} {
+		if msg := next(t, messages); msg.id != want {
+			t.Errorf("got %+v, want event %s", msg, want)
+		}
+	}
+}
+
+func TestStreamUsersResumesAfterLateEvent(t *testing.T) {
+	broker := stream.NewBroker(10)
+	// 2 committed after 3, so it was published after it
+	publish(broker, 1, 3, 2, 4)
+
+	messages := openStream(t, broker, "2")
+	if msg := next(t, messages); msg.id != "4" {
+		t.Errorf("got %+v, want only event 4 after the client's last event", msg)
+	}
+}
+
+func TestStreamUsersEndsWhenBrokerCloses(t *testing.T) {
+	broker := stream.NewBroker(10)
+	messages := openStream(t, broker, "")
+
+	publish(broker, 1)
+	next(t, messages)
+	broker.Close()
+
+	select {
+	case msg, ok := <-messages:
+		if ok {
+			t.Errorf("got %+v after the broker closed", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream stayed open after the broker closed")
+	}
+}
+
+func TestStreamUsersRejectsInvalidLastEventID(t *testing.T) {
+	req := httptest.NewRequest("GET", "/users/stream", nil)
+	req.Header.Set("Last-Event-ID", "abc")
+	w := httptest.NewRecorder()
+	NewStreamController(stream.NewBroker(10), time.Hour).StreamUsers(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,378 @@
+package controllers
+
+import (
+	"bufio"
+	"crud-app/pkg/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// importBatchSize is how many rows each import transaction inserts
+	importBatchSize = 500
+	// maxImportSize is the largest import body accepted
+	maxImportSize = 64 << 20
+	// maxImportErrors caps how many line errors an import reports
+	maxImportErrors = 100
+	// maxFieldLength matches the width of the users columns
+	maxFieldLength = 255
+)
+
+// ExportUsers handles GET /users/export?format=csv|ndjson|json. Rows are
+// written as they are read from the database, so exports of any size use
+// little memory. The default format is CSV.
+func (uc *UserController) ExportUsers(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	var enc userEncoder
+	switch format {
+	case "csv":
+		enc = &csvEncoder{w: csv.NewWriter(w)}
+	case "ndjson":
+		enc = &ndjsonEncoder{enc: json.NewEncoder(w)}
+	case "json":
+		enc = &jsonArrayEncoder{w: w}
+	default:
+		respondError(w, r, http.StatusBadRequest, "format must be csv, ndjson or json")
+		return
+	}
+
+	// Headers go out with the first row, so a query that fails straight away
+	// still gets a proper error response
+	started := false
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Type", enc.contentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="users.%s"`, format))
+		w.WriteHeader(http.StatusOK)
+		return enc.begin()
+	}
+
+	err := models.EachUser(r.Context(), func(u models.User) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return enc.write(u)
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = enc.end()
+	}
+	if err == nil {
+		return
+	}
+
+	if !started {
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error exporting users: %v", err))
+		return
+	}
+	// Part of the export was already sent; drop the connection so the client
+	// sees a failed download rather than a truncated file
+	log.Printf("error exporting users: %v", err)
+	panic(http.ErrAbortHandler)
+}
+
+// userEncoder writes an export in one format
+type userEncoder interface {
+	contentType() string
+	begin() error
+	write(user models.User) error
+	end() error
+}
+
+// csvEncoder writes a header row, then one row per user
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) contentType() string { return "text/csv; charset=utf-8" }
+
+func (e *csvEncoder) begin() error {
+	return e.w.Write([]string{"id", "name", "address", "country"})
+}
+
+func (e *csvEncoder) write(u models.User) error {
+	return e.w.Write([]string{u.ID, u.Name, u.Address, u.Country})
+}
+
+func (e *csvEncoder) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonEncoder writes one JSON object per line
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) contentType() string          { return "application/x-ndjson" }
+func (e *ndjsonEncoder) begin() error                 { return nil }
+func (e *ndjsonEncoder) write(user models.User) error { return e.enc.Encode(user) }
+func (e *ndjsonEncoder) end() error                   { return nil }
+
+// jsonArrayEncoder writes a JSON array, one user at a time
+type jsonArrayEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonArrayEncoder) contentType() string { return "application/json" }
+
+func (e *jsonArrayEncoder) begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonArrayEncoder) write(user models.User) error {
+	sep := ",\n"
+	if e.count == 0 {
+		sep = "\n"
+	}
+	e.count++
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.w, "%s%s", sep, data)
+	return err
+}
+
+func (e *jsonArrayEncoder) end() error {
+	end := "\n]\n"
+	if e.count == 0 {
+		end = "]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+// lineError reports a rejected import row
+type lineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// importResponse summarises an import
+type importResponse struct {
+	Imported int         `json:"imported"`
+	Failed   int         `json:"failed"`
+	Errors   []lineError `json:"errors"`          // The first maxImportErrors rejected rows
+	Error    string      `json:"error,omitempty"` // Why the import stopped early, if it did
+}
+
+// importer validates rows and inserts them in batches
+type importer struct {
+	r     *http.Request
+	batch []models.User
+	resp  importResponse
+}
+
+// add validates a row and queues it for insertion
+func (im *importer) add(line int, user models.User) error {
+	if err := validateImportRow(user); err != nil {
+		im.reject(line, err.Error())
+		return nil
+	}
+
+	im.batch = append(im.batch, user)
+	if len(im.batch) == importBatchSize {
+		return im.flush()
+	}
+	return nil
+}
+
+// reject records a row that won't be imported
+func (im *importer) reject(line int, message string) {
+	im.resp.Failed++
+	if len(im.resp.Errors) < maxImportErrors {
+		im.resp.Errors = append(im.resp.Errors, lineError{Line: line, Error: message})
+	}
+}
+
+// flush inserts the queued rows in one transaction
+func (im *importer) flush() error {
+	if len(im.batch) == 0 {
+		return nil
+	}
+	ids, err := models.CreateUsers(im.r.Context(), im.batch)
+	if err != nil {
+		return err
+	}
+	im.resp.Imported += len(ids)
+	im.batch = im.batch[:0]
+	return nil
+}
+
+// ImportUsers handles POST /users/import. The body is CSV (text/csv) with a
+// header row naming the name, address and country columns, or NDJSON
+// (application/x-ndjson) with one user object per line; other columns and
+// fields, such as id, are ignored. Invalid rows are skipped and reported by
+// line number. Valid rows are inserted in transactions of importBatchSize, so
+// if the database fails partway the earlier batches stay imported.
+func (uc *UserController) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+	im := &importer{r: r, resp: importResponse{Errors: []lineError{}}}
+
+	var err error
+	switch mediaType {
+	case "text/csv":
+		err = importCSV(body, im)
+	case "application/x-ndjson", "application/jsonl":
+		err = importNDJSON(body, im)
+	default:
+		respondError(w, r, http.StatusUnsupportedMediaType, "Content-Type must be text/csv or application/x-ndjson")
+		return
+	}
+	if err == nil {
+		err = im.flush()
+	}
+
+	var badInput *badImportError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		respond(w, r, http.StatusOK, im.resp)
+	case errors.As(err, &badInput):
+		im.resp.Error = err.Error()
+		respond(w, r, http.StatusBadRequest, im.resp)
+	case errors.As(err, &tooLarge):
+		im.resp.Error = fmt.Sprintf("Import is larger than %d bytes", tooLarge.Limit)
+		respond(w, r, http.StatusRequestEntityTooLarge, im.resp)
+	default:
+		im.resp.Error = fmt.Sprintf("Error importing users: %v", err)
+		respond(w, r, http.StatusInternalServerError, im.resp)
+	}
+}
+
+// badImportError means the import as a whole is malformed, e.g. a CSV
+// header is missing a column
+type badImportError struct {
+	message string
+}
+
+func (e *badImportError) Error() string {
+	return e.message
+}
+
+// importCSV reads users from CSV with a header row
+func importCSV(body io.Reader, im *importer) error {
+	cr := csv.NewReader(body)
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return &badImportError{"CSV is empty; expected a header row"}
+	}
+	if err != nil {
+		return csvError(err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"name", "address", "country"} {
+		if _, ok := columns[name]; !ok {
+			return &badImportError{fmt.Sprintf("CSV header is missing the %s column", name)}
+		}
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			// Rows with the wrong number of fields are returned too, but can't be trusted
+			im.reject(parseErr.StartLine, parseErr.Err.Error())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := cr.FieldPos(0)
+
+		user := models.User{
+			Name:    record[columns["name"]],
+			Address: record[columns["address"]],
+			Country: record[columns["country"]],
+		}
+		if err := im.add(line, user); err != nil {
+			return err
+		}
+	}
+}
+
+// csvError turns a CSV syntax error in the header into a badImportError
+func csvError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &badImportError{fmt.Sprintf("invalid CSV header: %v", parseErr.Err)}
+	}
+	return err
+}
+
+// importNDJSON reads users from newline-delimited JSON. Blank lines are skipped.
+func importNDJSON(body io.Reader, im *importer) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var row struct {
+			Name    string `json:"name"`
+			Address string `json:"address"`
+			Country string `json:"country"`
+		}
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			im.reject(line, "invalid JSON")
+			continue
+		}
+
+		if err := im.add(line, models.User{Name: row.Name, Address: row.Address, Country: row.Country}); err != nil {
+			return err
+		}
+	}
+
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		return &badImportError{fmt.Sprintf("line %d is longer than 1 MiB", line+1)}
+	}
+	return scanner.Err()
+}
+
+// validateImportRow applies the same rules as POST /users/add, plus the
+// column width
+func validateImportRow(user models.User) error {
+	if user.Name == "" || user.Address == "" || user.Country == "" {
+		return fmt.Errorf("name, address, and country are required")
+	}
+	for _, field := range []string{user.Name, user.Address, user.Country} {
+		if utf8.RuneCountInString(field) > maxFieldLength {
+			return fmt.Errorf("fields must be at most %d characters", maxFieldLength)
+		}
+	}
+	return nil
+}
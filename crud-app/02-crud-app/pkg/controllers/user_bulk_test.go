@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImportCSV(t *testing.T) {
+	body := "ID,Name,Address,Country,Notes\n" +
+		"1,Ann,1 High St,UK,x\n" +
+		"2,,2 High St,UK,x\n" +
+		"3,\"Bob\nSmith\",3 High St,FR,x\n" +
+		"4,Cy,4 High St\n" +
+		"5,Di,5 High St,DE,x\n"
+
+	im := &importer{}
+	if err := importCSV(strings.NewReader(body), im); err != nil {
+		t.Fatalf("importCSV: %v", err)
+	}
+
+	if len(im.batch) != 3 {
+		t.Fatalf("queued %d rows, want 3: %+v", len(im.batch), im.batch)
+	}
+	if got := im.batch[1].Name; got != "Bob\nSmith" {
+		t.Errorf("multi-line name = %q", got)
+	}
+	if im.batch[0].ID != "" {
+		t.Errorf("id column was imported: %q", im.batch[0].ID)
+	}
+
+	wantLines := []int{3, 6}
+	if im.resp.Failed != len(wantLines) || len(im.resp.Errors) != len(wantLines) {
+		t.Fatalf("errors = %+v, want lines %v", im.resp.Errors, wantLines)
+	}
+	for i, line := range wantLines {
+		if im.resp.Errors[i].Line != line {
+			t.Errorf("error %d on line %d, want %d", i, im.resp.Errors[i].Line, line)
+		}
+	}
+}
+
+func TestImportCSVHeader(t *testing.T) {
+	for _, body := range []string{"", "name,address\nAnn,1 High St\n"} {
+		err := importCSV(strings.NewReader(body), &importer{})
+		if _, ok := err.(*badImportError); !ok {
+			t.Errorf("importCSV(%q) = %v, want a badImportError", body, err)
+		}
+	}
+}
+
+func TestImportNDJSON(t *testing.T) {
+	body := `{"id": "9", "name": "Ann", "address": "1 High St", "country": "UK"}` + "\n" +
+		"\n" +
+		`{"name": "Bob"` + "\n" +
+		`{"name": "` + strings.Repeat("x", maxFieldLength+1) + `", "address": "a", "country": "b"}` + "\n" +
+		`{"name": "Cy", "address": "3 High St", "country": "FR"}`
+
+	im := &importer{}
+	if err := importNDJSON(strings.NewReader(body), im); err != nil {
+		t.Fatalf("importNDJSON: %v", err)
+	}
+
+	if len(im.batch) != 2 || im.batch[0].ID != "" || im.batch[1].Name != "Cy" {
+		t.Errorf("queued %+v", im.batch)
+	}
+	if len(im.resp.Errors) != 2 || im.resp.Errors[0].Line != 3 || im.resp.Errors[1].Line != 4 {
+		t.Errorf("errors = %+v, want lines 3 and 4", im.resp.Errors)
+	}
+}
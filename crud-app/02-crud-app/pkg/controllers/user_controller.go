@@ -7,26 +7,72 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // UserController handles user-related HTTP requests
-type UserController struct{}
+type UserController struct {
+	cacheControl string // Cache-Control header for GET /users and /users/{id}
+}
 
-// NewUserController creates a new UserController
-func NewUserController() *UserController {
-	return &UserController{}
+// NewUserController creates a new UserController. Reads may be cached for
+// cacheMaxAge, by shared caches too unless protectReads is set.
+func NewUserController(cacheMaxAge time.Duration, protectReads bool) *UserController {
+	return &UserController{cacheControl: cacheControl(cacheMaxAge, protectReads)}
 }
 
 // GetUsers handles GET /users
+// Passing limit and/or cursor switches to paginated mode, with the next
+// page's cursor returned in the X-Next-Cursor header
 func (uc *UserController) GetUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := models.GetAllUsers()
+	p, paginated, err := parsePage(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !paginated {
+		users, err := models.GetAllUsers(r.Context())
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error fetching users: %v", err))
+			return
+		}
+
+		uc.respondUserList(w, r, users)
+		return
+	}
+
+	users, err := models.ListUsers(r.Context(), p.afterID, p.limit)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error fetching users: %v", err))
+		return
+	}
+
+	// A full page means there may be more users after the last one
+	if len(users) == p.limit {
+		lastID, _ := strconv.Atoi(users[len(users)-1].ID)
+		setNextPage(w, r, lastID, p.limit)
+	}
+
+	if users == nil {
+		users = []models.User{}
+	}
+	uc.respondUserList(w, r, users)
+}
+
+// respondUserList writes a list of users with caching headers. The list last
+// changed when one of its users did, or when a user was deleted.
+func (uc *UserController) respondUserList(w http.ResponseWriter, r *http.Request, users []models.User) {
+	lastModified, err := models.LastUserDeletion(r.Context())
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error fetching users: %v", err), http.StatusInternalServerError)
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error fetching users: %v", err))
 		return
 	}
+	for _, user := range users {
+		lastModified = latest(lastModified, user.UpdatedAt)
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+	uc.respondCacheable(w, r, users, lastModified)
 }
 
 // GetUser handles GET /users/{id}
@@ -35,63 +81,60 @@ func (uc *UserController) GetUser(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/users/")
 	id, err := strconv.Atoi(path)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		respondError(w, r, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
-	user, err := models.GetUserByID(id)
+	user, err := models.GetUserByID(r.Context(), id)
 	if err != nil {
 		if err.Error() == "user not found" {
-			http.Error(w, "User not found", http.StatusNotFound)
+			respondError(w, r, http.StatusNotFound, "User not found")
 			return
 		}
-		http.Error(w, fmt.Sprintf("Error fetching user: %v", err), http.StatusInternalServerError)
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error fetching user: %v", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	uc.respondCacheable(w, r, user, user.UpdatedAt)
 }
 
 // CreateUser handles POST /users/add
 func (uc *UserController) CreateUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	var user models.User
 	err := json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
-		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		respondError(w, r, http.StatusBadRequest, "Invalid JSON body")
 		return
 	}
 
 	// Basic validation
 	if user.Name == "" || user.Address == "" || user.Country == "" {
-		http.Error(w, "Name, address, and country are required", http.StatusBadRequest)
+		respondError(w, r, http.StatusBadRequest, "Name, address, and country are required")
 		return
 	}
 
-	id, err := models.CreateUser(user)
+	id, err := models.CreateUser(r.Context(), user)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error creating user: %v", err), http.StatusInternalServerError)
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error creating user: %v", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
 	response := map[string]interface{}{
 		"message": "User created successfully",
 		"id":      id,
 	}
-	json.NewEncoder(w).Encode(response)
+	respond(w, r, http.StatusCreated, response)
 }
 
 // UpdateUser handles PUT /users/update/{id}
 func (uc *UserController) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -99,44 +142,88 @@ func (uc *UserController) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/users/update/")
 	id, err := strconv.Atoi(path)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		respondError(w, r, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
 	var user models.User
 	err = json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
-		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		respondError(w, r, http.StatusBadRequest, "Invalid JSON body")
 		return
 	}
 
 	// Basic validation
 	if user.Name == "" || user.Address == "" || user.Country == "" {
-		http.Error(w, "Name, address, and country are required", http.StatusBadRequest)
+		respondError(w, r, http.StatusBadRequest, "Name, address, and country are required")
 		return
 	}
 
-	err = models.UpdateUser(id, user)
+	err = models.UpdateUser(r.Context(), id, user)
+	if err != nil {
+		if err.Error() == "user not found" {
+			respondError(w, r, http.StatusNotFound, "User not found")
+			return
+		}
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error updating user: %v", err))
+		return
+	}
+
+	response := map[string]string{
+		"message": fmt.Sprintf("User with id %d updated successfully", id),
+	}
+	respond(w, r, http.StatusOK, response)
+}
+
+// PatchUser handles PATCH /users/update/{id}
+func (uc *UserController) PatchUser(w http.ResponseWriter, r *http.Request) {
+	// Extract ID from URL path
+	path := strings.TrimPrefix(r.URL.Path, "/users/update/")
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var patch models.UserPatch
+	err = json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	// Basic validation
+	if patch.Name == nil && patch.Address == nil && patch.Country == nil {
+		respondError(w, r, http.StatusBadRequest, "At least one of name, address or country is required")
+		return
+	}
+	for _, field := range []*string{patch.Name, patch.Address, patch.Country} {
+		if field != nil && *field == "" {
+			respondError(w, r, http.StatusBadRequest, "Name, address, and country cannot be empty")
+			return
+		}
+	}
+
+	err = models.PatchUser(r.Context(), id, patch)
 	if err != nil {
 		if err.Error() == "user not found" {
-			http.Error(w, "User not found", http.StatusNotFound)
+			respondError(w, r, http.StatusNotFound, "User not found")
 			return
 		}
-		http.Error(w, fmt.Sprintf("Error updating user: %v", err), http.StatusInternalServerError)
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error updating user: %v", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
 	response := map[string]string{
 		"message": fmt.Sprintf("User with id %d updated successfully", id),
 	}
-	json.NewEncoder(w).Encode(response)
+	respond(w, r, http.StatusOK, response)
 }
 
 // DeleteUser handles DELETE /users/delete/{id}
 func (uc *UserController) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -144,23 +231,22 @@ func (uc *UserController) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/users/delete/")
 	id, err := strconv.Atoi(path)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		respondError(w, r, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
-	err = models.DeleteUser(id)
+	err = models.DeleteUser(r.Context(), id)
 	if err != nil {
 		if err.Error() == "user not found" {
-			http.Error(w, "User not found", http.StatusNotFound)
+			respondError(w, r, http.StatusNotFound, "User not found")
 			return
 		}
-		http.Error(w, fmt.Sprintf("Error deleting user: %v", err), http.StatusInternalServerError)
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error deleting user: %v", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
 	response := map[string]string{
 		"message": fmt.Sprintf("User with id %d deleted successfully", id),
 	}
-	json.NewEncoder(w).Encode(response)
+	respond(w, r, http.StatusOK, response)
 }
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"crud-app/pkg/models"
+	"crud-app/pkg/webhooks"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// WebhookController handles webhook subscriptions and their delivery logs
+type WebhookController struct{}
+
+// NewWebhookController creates a new WebhookController
+func NewWebhookController() *WebhookController {
+	return &WebhookController{}
+}
+
+// webhookRequest is the body of POST /webhooks
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"` // Defaults to every event type
+}
+
+// createWebhookResponse includes the signing secret, which is only shown once
+type createWebhookResponse struct {
+	*models.Webhook
+	Secret string `json:"secret"`
+}
+
+// CreateWebhook handles POST /webhooks
+func (wc *WebhookController) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	// Basic validation
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		respondError(w, r, http.StatusBadRequest, "A valid http or https url is required")
+		return
+	}
+	if len(req.Events) == 0 {
+		req.Events = slices.Clone(webhooks.Events)
+	}
+	for _, event := range req.Events {
+		if !slices.Contains(webhooks.Events, event) {
+			respondError(w, r, http.StatusBadRequest, fmt.Sprintf("Unknown event %q", event))
+			return
+		}
+	}
+	slices.Sort(req.Events)
+	req.Events = slices.Compact(req.Events)
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error creating webhook: %v", err))
+		return
+	}
+
+	webhook, err := models.CreateWebhook(r.Context(), u.String(), secret, req.Events)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error creating webhook: %v", err))
+		return
+	}
+
+	respond(w, r, http.StatusCreated, createWebhookResponse{Webhook: webhook, Secret: secret})
+}
+
+// GetWebhooks handles GET /webhooks
+func (wc *WebhookController) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := models.GetAllWebhooks(r.Context())
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error fetching webhooks: %v", err))
+		return
+	}
+
+	respond(w, r, http.StatusOK, hooks)
+}
+
+// GetWebhook handles GET /webhooks/{id}
+func (wc *WebhookController) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	webhook, err := models.GetWebhookByID(r.Context(), id)
+	if err != nil {
+		if err.Error() == "webhook not found" {
+			respondError(w, r, http.StatusNotFound, "Webhook not found")
+			return
+		}
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error fetching webhook: %v", err))
+		return
+	}
+
+	respond(w, r, http.StatusOK, webhook)
+}
+
+// DeleteWebhook handles DELETE /webhooks/{id}
+func (wc *WebhookController) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	err = models.DeleteWebhook(r.Context(), id)
+	if err != nil {
+		if err.Error() == "webhook not found" {
+			respondError(w, r, http.StatusNotFound, "Webhook not found")
+			return
+		}
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error deleting webhook: %v", err))
+		return
+	}
+
+	response := map[string]string{
+		"message": fmt.Sprintf("Webhook with id %d deleted successfully", id),
+	}
+	respond(w, r, http.StatusOK, response)
+}
+
+// EnableWebhook handles POST /webhooks/{id}/enable, re-activating a webhook
+// that was disabled after repeated failures
+func (wc *WebhookController) EnableWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	err = models.EnableWebhook(r.Context(), id)
+	if err != nil {
+		if err.Error() == "webhook not found" {
+			respondError(w, r, http.StatusNotFound, "Webhook not found")
+			return
+		}
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error enabling webhook: %v", err))
+		return
+	}
+
+	response := map[string]string{
+		"message": fmt.Sprintf("Webhook with id %d enabled", id),
+	}
+	respond(w, r, http.StatusOK, response)
+}
+
+// GetWebhookDeliveries handles GET /webhooks/{id}/deliveries, newest first
+func (wc *WebhookController) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	limit := defaultPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			respondError(w, r, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+			return
+		}
+	}
+
+	if _, err := models.GetWebhookByID(r.Context(), id); err != nil {
+		if err.Error() == "webhook not found" {
+			respondError(w, r, http.StatusNotFound, "Webhook not found")
+			return
+		}
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error fetching webhook: %v", err))
+		return
+	}
+
+	deliveries, err := models.GetWebhookDeliveries(r.Context(), id, limit)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error fetching deliveries: %v", err))
+		return
+	}
+
+	respond(w, r, http.StatusOK, deliveries)
+}
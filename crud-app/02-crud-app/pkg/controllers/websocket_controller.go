@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"crud-app/pkg/config"
+	"crud-app/pkg/middleware"
+	"crud-app/pkg/outbox"
+	"crud-app/pkg/stream"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsWriteTimeout bounds each write to a WebSocket client
+	wsWriteTimeout = 10 * time.Second
+	// wsMaxMessageSize is the largest message a client may send
+	wsMaxMessageSize = 4096
+	// wsMaxFilters caps how many user IDs plus countries a connection can watch
+	wsMaxFilters = 1000
+)
+
+// WebSocketController pushes user change events to WebSocket clients that
+// subscribe to specific user IDs or countries
+type WebSocketController struct {
+	broker       *stream.Broker
+	upgrader     websocket.Upgrader
+	maxConns     int64
+	conns        atomic.Int64
+	pingInterval time.Duration
+}
+
+// NewWebSocketController creates a new WebSocketController. Upgrades are only
+// accepted from browsers on allowedOrigins, as for CORS.
+func NewWebSocketController(broker *stream.Broker, cfg config.StreamConfig, allowedOrigins []string) *WebSocketController {
+	if cfg.WSPingInterval <= 0 {
+		cfg.WSPingInterval = 30 * time.Second
+	}
+	if cfg.WSMaxConnections <= 0 {
+		cfg.WSMaxConnections = 1000
+	}
+	return &WebSocketController{
+		broker: broker,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin: func(r *http.Request) bool {
+				// Non-browser clients don't send an Origin
+				origin := r.Header.Get("Origin")
+				return origin == "" || middleware.OriginAllowed(allowedOrigins, origin)
+			},
+		},
+		maxConns:     int64(cfg.WSMaxConnections),
+		pingInterval: cfg.WSPingInterval,
+	}
+}
+
+// wsRequest is a message from a WebSocket client
+type wsRequest struct {
+	Action    string   `json:"action"` // "subscribe" or "unsubscribe"
+	UserIDs   []int    `json:"user_ids"`
+	Countries []string `json:"countries"`
+}
+
+// wsResponse is a message to a WebSocket client
+type wsResponse struct {
+	Type      string        `json:"type"` // "event", "subscriptions" or "error"
+	Event     *outbox.Event `json:"event,omitempty"`
+	UserIDs   []int         `json:"user_ids,omitempty"`
+	Countries []string      `json:"countries,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// StreamUsers handles GET /users/ws. After connecting, clients send
+// {"action": "subscribe", "user_ids": [1, 2], "countries": ["UK"]} and get
+// every change to those users, or to users in those countries, as
+// {"type": "event", "event": {...}}. Clients that fall too far behind are
+// disconnected and should reconnect.
+func (wc *WebSocketController) StreamUsers(w http.ResponseWriter, r *http.Request) {
+	if wc.conns.Add(1) > wc.maxConns {
+		wc.conns.Add(-1)
+		w.Header().Set("Retry-After", "5")
+		respondError(w, r, http.StatusServiceUnavailable, "Too many WebSocket connections")
+		return
+	}
+	defer wc.conns.Add(-1)
+
+	// Upgrade writes its own error response on failure
+	conn, err := wc.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sub, _, _ := wc.broker.Subscribe(0)
+	defer wc.broker.Unsubscribe(sub)
+
+	// A client that stops answering pings hits the read deadline
+	pongWait := 2 * wc.pingInterval
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	filter := &wsFilter{userIDs: map[int]bool{}, countries: map[string]bool{}}
+	replies := make(chan wsResponse, 8)
+	done := make(chan struct{})
+	defer close(done)
+
+	// Only this goroutine reads, and only the loop below writes
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			var reply wsResponse
+			var req wsRequest
+			if err := json.Unmarshal(msg, &req); err != nil {
+				reply = wsResponse{Type: "error", Error: "Invalid JSON message"}
+			} else {
+				reply = filter.apply(req)
+			}
+
+			select {
+			case replies <- reply:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wc.pingInterval)
+	defer ping.Stop()
+
+	for {
+		var err error
+		select {
+		case <-readerDone:
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				closeCode, reason := websocket.CloseGoingAway, "Server shutting down"
+				if sub.Lagged() {
+					closeCode, reason = websocket.ClosePolicyViolation, "Client too slow"
+				}
+				msg := websocket.FormatCloseMessage(closeCode, reason)
+				conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteTimeout))
+				return
+			}
+			if !filter.matches(event) {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			err = conn.WriteJSON(wsResponse{Type: "event", Event: &event})
+		case reply := <-replies:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			err = conn.WriteJSON(reply)
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// wsFilter holds what a connection is subscribed to
+type wsFilter struct {
+	mu        sync.Mutex
+	userIDs   map[int]bool
+	countries map[string]bool // Upper case, so matching ignores case
+}
+
+// apply handles a subscribe or unsubscribe request and returns the reply
+func (f *wsFilter) apply(req wsRequest) wsResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch req.Action {
+	case "subscribe":
+		if len(f.userIDs)+len(f.countries)+len(req.UserIDs)+len(req.Countries) > wsMaxFilters {
+			return wsResponse{Type: "error", Error: fmt.Sprintf("At most %d user IDs and countries can be watched", wsMaxFilters)}
+		}
+		for _, id := range req.UserIDs {
+			f.userIDs[id] = true
+		}
+		for _, country := range req.Countries {
+			f.countries[strings.ToUpper(strings.TrimSpace(country))] = true
+		}
+	case "unsubscribe":
+		for _, id := range req.UserIDs {
+			delete(f.userIDs, id)
+		}
+		for _, country := range req.Countries {
+			delete(f.countries, strings.ToUpper(strings.TrimSpace(country)))
+		}
+	default:
+		return wsResponse{Type: "error", Error: `action must be "subscribe" or "unsubscribe"`}
+	}
+
+	reply := wsResponse{Type: "subscriptions", UserIDs: []int{}, Countries: []string{}}
+	for id := range f.userIDs {
+		reply.UserIDs = append(reply.UserIDs, id)
+	}
+	for country := range f.countries {
+		reply.Countries = append(reply.Countries, country)
+	}
+	slices.Sort(reply.UserIDs)
+	slices.Sort(reply.Countries)
+	return reply
+}
+
+// matches reports whether event concerns a watched user or country. For
+// updates, the country is the user's country after the change.
+func (f *wsFilter) matches(event outbox.Event) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.userIDs[event.UserID] {
+		return true
+	}
+	if len(f.countries) == 0 {
+		return false
+	}
+
+	var user struct {
+		Country string `json:"country"`
+	}
+	if err := json.Unmarshal(event.Data, &user); err != nil {
+		return false
+	}
+	return f.countries[strings.ToUpper(strings.TrimSpace(user.Country))]
+}
@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"crud-app/pkg/config"
+	"crud-app/pkg/outbox"
+	"crud-app/pkg/stream"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newWSServer serves GET /users/ws from a WebSocketController on broker
+func newWSServer(t *testing.T, broker *stream.Broker, cfg config.StreamConfig) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(NewWebSocketController(broker, cfg, nil).StreamUsers))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// dialWS connects to url, failing the test if the upgrade is refused
+func dialWS(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readWS returns the next message on conn, failing if none arrives
+func readWS(t *testing.T, conn *websocket.Conn) wsResponse {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var resp wsResponse
+	if err := conn.ReadJSON(&resp); err != nil {
+		t.Fatalf("reading message: %v", err)
+	}
+	return resp
+}
+
+// subscribeWS sends req and waits for the reply. Once it arrives the
+// connection is subscribed to the broker.
+func subscribeWS(t *testing.T, conn *websocket.Conn, req wsRequest) wsResponse {
+	t.Helper()
+	if err := conn.WriteJSON(req); err != nil {
+		t.Fatalf("sending %s: %v", req.Action, err)
+	}
+	return readWS(t, conn)
+}
+
+// readUntilClosed discards messages until conn is closed and returns the error
+func readUntilClosed(t *testing.T, conn *websocket.Conn) error {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return err
+		}
+	}
+}
+
+// userEvent is an event for userID whose data has the user's new country
+func userEvent(id int64, eventType string, userID int, country string) outbox.Event {
+	data, _ := json.Marshal(map[string]string{"country": country})
+	return outbox.Event{ID: id, Type: eventType, UserID: userID, Data: data}
+}
+
+func TestWSFilterApply(t *testing.T) {
+	filter := &wsFilter{userIDs: map[int]bool{}, countries: map[string]bool{}}
+
+	got := filter.apply(wsRequest{Action: "subscribe", UserIDs: []int{3, 1}, Countries: []string{" uk ", "FR"}})
+	if got.Type != "subscriptions" || !slices.Equal(got.UserIDs, []int{1, 3}) || !slices.Equal(got.Countries, []string{"FR", "UK"}) {
+		t.Errorf("after subscribe got %+v", got)
+	}
+
+	got = filter.apply(wsRequest{Action: "unsubscribe", UserIDs: []int{3}, Countries: []string{"fr"}})
+	if got.Type != "subscriptions" || !slices.Equal(got.UserIDs, []int{1}) || !slices.Equal(got.Countries, []string{"UK"}) {
+		t.Errorf("after unsubscribe got %+v", got)
+	}
+
+	if got = filter.apply(wsRequest{Action: "watch", UserIDs: []int{4}}); got.Type != "error" {
+		t.Errorf("unknown action got %+v, want an error", got)
+	}
+	if filter.userIDs[4] {
+		t.Error("unknown action changed the subscriptions")
+	}
+}
+
+func TestWSFilterMatches(t *testing.T) {
+	filter := &wsFilter{userIDs: map[int]bool{}, countries: map[string]bool{}}
+	filter.apply(wsRequest{Action: "subscribe", UserIDs: []int{1}, Countries: []string{"UK"}})
+
+	tests := []struct {
+		name  string
+		event outbox.Event
+		want  bool
+	}{
+		{"watched user", userEvent(1, "user.updated", 1, "FR"), true},
+		{"user in watched country", userEvent(2, "user.created", 2, "uk"), true},
+		{"user moved into watched country", userEvent(3, "user.updated", 3, "UK"), true},
+		{"user moved out of watched country", userEvent(4, "user.updated", 4, "FR"), false},
+		{"invalid data", outbox.Event{ID: 5, UserID: 5, Data: json.RawMessage(`not json`)}, false},
+	}
+	for _, tc := range tests {
+		if got := filter.matches(tc.event); got != tc.want {
+			t.Errorf("%s: matches = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// Without countries, only the watched users match
+	filter.apply(wsRequest{Action: "unsubscribe", Countries: []string{"UK"}})
+	if filter.matches(userEvent(6, "user.created", 2, "UK")) {
+		t.Error("matched a country after unsubscribing from it")
+	}
+}
+
+func TestWSFilterCapsSubscriptions(t *testing.T) {
+	filter := &wsFilter{userIDs: map[int]bool{}, countries: map[string]bool{}}
+
+	ids := make([]int, wsMaxFilters)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	if got := filter.apply(wsRequest{Action: "subscribe", UserIDs: ids}); got.Type != "subscriptions" {
+		t.Fatalf("subscribing to %d users got %+v", wsMaxFilters, got)
+	}
+
+	got := filter.apply(wsRequest{Action: "subscribe", Countries: []string{"UK"}})
+	if got.Type != "error" {
+		t.Errorf("subscribing past the cap got %+v, want an error", got)
+	}
+	if filter.countries["UK"] {
+		t.Error("subscription past the cap was kept")
+	}
+}
+
+func TestStreamUsersWSSendsMatchingEvents(t *testing.T) {
+	broker := stream.NewBroker(10)
+	conn := dialWS(t, newWSServer(t, broker, config.StreamConfig{}))
+
+	got := subscribeWS(t, conn, wsRequest{Action: "subscribe", Countries: []string{"uk"}})
+	if got.Type != "subscriptions" || !slices.Equal(got.Countries, []string{"UK"}) {
+		t.Fatalf("subscribe got %+v", got)
+	}
+
+	// User 5 is skipped while in France and sent once updated to the UK
+	broker.Publish(userEvent(1, "user.created", 5, "FR"))
+	broker.Publish(userEvent(2, "user.updated", 5, "UK"))
+
+	if got := readWS(t, conn); got.Type != "event" || got.Event == nil || got.Event.ID != 2 {
+		t.Errorf("got %+v, want event 2", got)
+	}
+}
+
+func TestStreamUsersWSRejectsInvalidJSON(t *testing.T) {
+	conn := dialWS(t, newWSServer(t, stream.NewBroker(10), config.StreamConfig{}))
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("not json")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readWS(t, conn); got.Type != "error" {
+		t.Errorf("got %+v, want an error", got)
+	}
+}
+
+func TestStreamUsersWSLimitsConnections(t *testing.T) {
+	url := newWSServer(t, stream.NewBroker(10), config.StreamConfig{WSMaxConnections: 1})
+	dialWS(t, url)
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		t.Fatal("second connection was accepted")
+	}
+	if resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("second connection: %v, want a 503 response", err)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "5" {
+		t.Errorf("Retry-After = %q, want 5", got)
+	}
+}
+
+func TestStreamUsersWSClosesSlowClients(t *testing.T) {
+	broker := stream.NewBroker(0)
+	conn := dialWS(t, newWSServer(t, broker, config.StreamConfig{}))
+	subscribeWS(t, conn, wsRequest{Action: "subscribe", UserIDs: []int{1}})
+
+	// Large events fill the socket buffers while the client isn't reading,
+	// so the handler blocks on a write and the broker drops it
+	event := userEvent(0, "user.updated", 1, strings.Repeat("x", 1<<18))
+	for id := int64(1); id <= 200; id++ {
+		event.ID = id
+		broker.Publish(event)
+	}
+
+	err := readUntilClosed(t, conn)
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("got %v, want close code %d", err, websocket.ClosePolicyViolation)
+	}
+}
+
+func TestStreamUsersWSClosesWhenBrokerCloses(t *testing.T) {
+	broker := stream.NewBroker(10)
+	conn := dialWS(t, newWSServer(t, broker, config.StreamConfig{}))
+	subscribeWS(t, conn, wsRequest{Action: "subscribe", UserIDs: []int{1}})
+
+	broker.Close()
+
+	err := readUntilClosed(t, conn)
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("got %v, want close code %d", err, websocket.CloseGoingAway)
+	}
+}
+
+func TestStreamUsersWSKeepsAliveClientsThatAnswerPings(t *testing.T) {
+	interval := 20 * time.Millisecond
+	conn := dialWS(t, newWSServer(t, stream.NewBroker(10), config.StreamConfig{WSPingInterval: interval}))
+
+	pings := make(chan struct{}, 100)
+	conn.SetPingHandler(func(data string) error {
+		pings <- struct{}{}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	// Pings are only handled while reading, so read until enough have passed
+	// that an unanswered connection would have hit its deadline
+	messages := make(chan wsResponse, 1)
+	go func() {
+		var resp wsResponse
+		if conn.ReadJSON(&resp) == nil {
+			messages <- resp
+		}
+		close(messages)
+	}()
+	for i := 0; i < 5; i++ {
+		select {
+		case <-pings:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a ping")
+		}
+	}
+
+	if err := conn.WriteJSON(wsRequest{Action: "subscribe", UserIDs: []int{1}}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got, ok := <-messages:
+		if !ok || got.Type != "subscriptions" {
+			t.Errorf("got %+v, want the subscriptions after answering pings", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a reply")
+	}
+}
+
+func TestStreamUsersWSDropsClientsThatIgnorePings(t *testing.T) {
+	conn := dialWS(t, newWSServer(t, stream.NewBroker(10), config.StreamConfig{WSPingInterval: 20 * time.Millisecond}))
+	conn.SetPingHandler(func(string) error { return nil })
+
+	// The server closes the connection once its read deadline passes
+	var netErr net.Error
+	if err := readUntilClosed(t, conn); errors.As(err, &netErr) && netErr.Timeout() {
+		t.Errorf("connection stayed open without pongs: %v", err)
+	}
+}
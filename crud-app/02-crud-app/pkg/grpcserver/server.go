@@ -0,0 +1,186 @@
+// Package grpcserver serves the users API over gRPC, next to the HTTP API.
+package grpcserver
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=crud-app --go-grpc_out=../.. --go-grpc_opt=module=crud-app users/v1/users.proto
+
+import (
+	"context"
+	"crud-app/pkg/auth"
+	"crud-app/pkg/config"
+	"crud-app/pkg/pb/usersv1"
+	"fmt"
+	"log"
+	"net"
+	"runtime/debug"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// Server is the gRPC server with the UserService, health checking and,
+// optionally, reflection registered
+type Server struct {
+	grpc   *grpc.Server
+	health *health.Server
+}
+
+// New creates a Server. Every call is traced, logged and authenticated from
+// its metadata the same way HTTP requests are.
+func New(cfg *config.Config) (*Server, error) {
+	authenticator, err := auth.NewAuthenticator(cfg.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up authentication: %v", err)
+	}
+
+	// Interceptors run in this order
+	srv := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(logUnary, recoverUnary, authUnary(authenticator)),
+		grpc.ChainStreamInterceptor(logStream, recoverStream, authStream(authenticator)),
+	)
+
+	usersv1.RegisterUserServiceServer(srv, &userService{protectReads: cfg.Auth.ProtectReads})
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(srv, healthServer)
+	healthServer.SetServingStatus(usersv1.UserService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+
+	if cfg.GRPC.Reflection {
+		reflection.Register(srv)
+	}
+
+	return &Server{grpc: srv, health: healthServer}, nil
+}
+
+// Serve accepts connections on lis until Shutdown is called
+func (s *Server) Serve(lis net.Listener) error {
+	return s.grpc.Serve(lis)
+}
+
+// Shutdown reports NOT_SERVING to health checks, then waits for open calls to
+// finish. Calls still running when ctx ends, such as long List streams, are cancelled.
+func (s *Server) Shutdown(ctx context.Context) {
+	s.health.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpc.Stop()
+	}
+}
+
+// logUnary logs each call with its status code and duration
+func logUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logCall(ctx, info.FullMethod, err, start)
+	return resp, err
+}
+
+// logStream logs each stream with its status code and duration
+func logStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	logCall(ss.Context(), info.FullMethod, err, start)
+	return err
+}
+
+func logCall(ctx context.Context, method string, err error, start time.Time) {
+	addr := "-"
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+	}
+	log.Printf("%s gRPC %s %s %s", addr, method, status.Code(err), time.Since(start))
+}
+
+// recoverUnary turns a panic into an Internal error instead of crashing the server
+func recoverUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Printf("panic serving gRPC %s: %v\n%s", info.FullMethod, rec, debug.Stack())
+			err = status.Error(codes.Internal, "Internal server error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// recoverStream turns a panic into an Internal error instead of crashing the server
+func recoverStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Printf("panic serving gRPC %s: %v\n%s", info.FullMethod, rec, debug.Stack())
+			err = status.Error(codes.Internal, "Internal server error")
+		}
+	}()
+	return handler(srv, ss)
+}
+
+// authUnary adds the caller's principal, if any, to the context
+func authUnary(a *auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// authStream adds the caller's principal, if any, to the stream's context
+func authStream(a *auth.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), a)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate checks the x-api-key and authorization metadata. Calls without
+// credentials carry on anonymously; invalid credentials are rejected.
+func authenticate(ctx context.Context, a *auth.Authenticator) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	principal, err := a.AuthenticateCredentials(ctx, first("x-api-key"), first("authorization"))
+	if err == auth.ErrLookupFailed {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized: "+err.Error())
+	}
+	if principal == nil {
+		return ctx, nil
+	}
+	return auth.WithPrincipal(ctx, principal), nil
+}
+
+// authedStream overrides a stream's context with one carrying the principal
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,140 @@
+package grpcserver
+
+import (
+	"context"
+	"crud-app/pkg/config"
+	"crud-app/pkg/pb/usersv1"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const testJWTSecret = "grpc-test-secret"
+
+// startServer serves a Server over an in-memory listener and returns a client connection
+func startServer(t *testing.T) *grpc.ClientConn {
+	cfg := &config.Config{Auth: config.AuthConfig{JWTSecret: testJWTSecret}}
+	cfg.GRPC.Reflection = true
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func withToken(t *testing.T, subject, role string) context.Context {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  subject,
+		"role": role,
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	})
+	signed, err := token.SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+signed)
+}
+
+func TestHealthAndReflection(t *testing.T) {
+	conn := startServer(t)
+
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(),
+		&healthpb.HealthCheckRequest{Service: usersv1.UserService_ServiceDesc.ServiceName})
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("health check = %v, %v; want SERVING", resp, err)
+	}
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatalf("ServerReflectionInfo: %v", err)
+	}
+	stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	info, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("reflection Recv: %v", err)
+	}
+	found := false
+	for _, svc := range info.GetListServicesResponse().GetService() {
+		found = found || svc.Name == usersv1.UserService_ServiceDesc.ServiceName
+	}
+	if !found {
+		t.Errorf("reflection does not list %s", usersv1.UserService_ServiceDesc.ServiceName)
+	}
+}
+
+// TestWritePolicies checks the calls that are rejected before reaching the database
+func TestWritePolicies(t *testing.T) {
+	client := usersv1.NewUserServiceClient(startServer(t))
+	name := "x"
+
+	for _, tc := range []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"anonymous create", func() error {
+			_, err := client.Create(context.Background(), &usersv1.CreateUserRequest{Name: "a", Address: "b", Country: "c"})
+			return err
+		}, codes.Unauthenticated},
+		{"invalid token", func() error {
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer nope")
+			_, err := client.Get(ctx, &usersv1.GetUserRequest{Id: 1})
+			return err
+		}, codes.Unauthenticated},
+		{"viewer create", func() error {
+			_, err := client.Create(withToken(t, "7", "viewer"), &usersv1.CreateUserRequest{})
+			return err
+		}, codes.PermissionDenied},
+		{"editor create without fields", func() error {
+			_, err := client.Create(withToken(t, "7", "editor"), &usersv1.CreateUserRequest{})
+			return err
+		}, codes.InvalidArgument},
+		{"editor update other", func() error {
+			_, err := client.Update(withToken(t, "7", "editor"), &usersv1.UpdateUserRequest{Id: 8, Name: &name})
+			return err
+		}, codes.PermissionDenied},
+		{"editor update own without fields", func() error {
+			_, err := client.Update(withToken(t, "7", "editor"), &usersv1.UpdateUserRequest{Id: 7})
+			return err
+		}, codes.InvalidArgument},
+		{"editor delete", func() error {
+			_, err := client.Delete(withToken(t, "7", "editor"), &usersv1.DeleteUserRequest{Id: 7})
+			return err
+		}, codes.PermissionDenied},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := status.Code(tc.call()); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package grpcserver
+
+import (
+	"context"
+	"crud-app/pkg/auth"
+	"crud-app/pkg/authz"
+	"crud-app/pkg/models"
+	"crud-app/pkg/pb/usersv1"
+	"fmt"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// listBatchSize is how many users List reads from the database at a time
+const listBatchSize = 500
+
+// userService implements usersv1.UserServiceServer on top of the models layer
+type userService struct {
+	usersv1.UnimplementedUserServiceServer
+	protectReads bool // Require credentials for Get and List too
+}
+
+// Get returns one user
+func (s *userService) Get(ctx context.Context, req *usersv1.GetUserRequest) (*usersv1.User, error) {
+	if err := s.authorizeRead(ctx); err != nil {
+		return nil, err
+	}
+
+	user, err := models.GetUserByID(ctx, int(req.GetId()))
+	if err != nil {
+		return nil, modelError(err, "fetching")
+	}
+	return toProto(*user), nil
+}
+
+// List streams the matching users in ID order, a batch at a time
+func (s *userService) List(req *usersv1.ListUsersRequest, stream grpc.ServerStreamingServer[usersv1.User]) error {
+	ctx := stream.Context()
+	if err := s.authorizeRead(ctx); err != nil {
+		return err
+	}
+	if req.GetLimit() < 0 || req.GetAfterId() < 0 {
+		return status.Error(codes.InvalidArgument, "limit and after_id cannot be negative")
+	}
+
+	filter := models.UserFilter{Country: req.GetCountry(), NameContains: req.GetNameContains()}
+	afterID := int(req.GetAfterId())
+	remaining := int(req.GetLimit())
+	for {
+		batch := listBatchSize
+		if req.GetLimit() > 0 {
+			batch = min(batch, remaining)
+		}
+
+		users, err := models.FindUsers(ctx, filter, afterID, batch)
+		if err != nil {
+			return status.Error(codes.Internal, fmt.Sprintf("Error fetching users: %v", err))
+		}
+		for _, user := range users {
+			if err := stream.Send(toProto(user)); err != nil {
+				return err
+			}
+		}
+
+		remaining -= len(users)
+		if len(users) < batch || (req.GetLimit() > 0 && remaining == 0) {
+			return nil
+		}
+		afterID, _ = strconv.Atoi(users[len(users)-1].ID)
+	}
+}
+
+// Create adds a user
+func (s *userService) Create(ctx context.Context, req *usersv1.CreateUserRequest) (*usersv1.User, error) {
+	if err := authorize(ctx, authz.Editors, 0); err != nil {
+		return nil, err
+	}
+
+	user := models.User{Name: req.GetName(), Address: req.GetAddress(), Country: req.GetCountry()}
+
+	// Basic validation
+	if user.Name == "" || user.Address == "" || user.Country == "" {
+		return nil, status.Error(codes.InvalidArgument, "Name, address, and country are required")
+	}
+
+	id, err := models.CreateUser(ctx, user)
+	if err != nil {
+		return nil, modelError(err, "creating")
+	}
+
+	user.ID = strconv.Itoa(id)
+	return toProto(user), nil
+}
+
+// Update changes the fields that are set in the request
+func (s *userService) Update(ctx context.Context, req *usersv1.UpdateUserRequest) (*usersv1.User, error) {
+	if err := authorize(ctx, authz.OwnerOrAdmin, req.GetId()); err != nil {
+		return nil, err
+	}
+
+	patch := models.UserPatch{Name: req.Name, Address: req.Address, Country: req.Country}
+
+	// Basic validation
+	if patch.Name == nil && patch.Address == nil && patch.Country == nil {
+		return nil, status.Error(codes.InvalidArgument, "At least one of name, address or country is required")
+	}
+	for _, field := range []*string{patch.Name, patch.Address, patch.Country} {
+		if field != nil && *field == "" {
+			return nil, status.Error(codes.InvalidArgument, "Name, address, and country cannot be empty")
+		}
+	}
+
+	id := int(req.GetId())
+	if err := models.PatchUser(ctx, id, patch); err != nil {
+		return nil, modelError(err, "updating")
+	}
+
+	user, err := models.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, modelError(err, "fetching")
+	}
+	return toProto(*user), nil
+}
+
+// Delete removes a user
+func (s *userService) Delete(ctx context.Context, req *usersv1.DeleteUserRequest) (*usersv1.DeleteUserResponse, error) {
+	if err := authorize(ctx, authz.Admins, 0); err != nil {
+		return nil, err
+	}
+
+	if err := models.DeleteUser(ctx, int(req.GetId())); err != nil {
+		return nil, modelError(err, "deleting")
+	}
+	return &usersv1.DeleteUserResponse{}, nil
+}
+
+// authorizeRead rejects anonymous reads when reads are protected
+func (s *userService) authorizeRead(ctx context.Context) error {
+	if s.protectReads && auth.FromContext(ctx) == nil {
+		return status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	return nil
+}
+
+// authorize checks the caller against pol. userID is the user the call
+// touches, for policies that let users change their own record.
+func authorize(ctx context.Context, pol authz.Policy, userID int64) error {
+	principal := auth.FromContext(ctx)
+	if principal == nil {
+		return status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	if !pol.Allows(principal, map[string]string{"id": strconv.FormatInt(userID, 10)}) {
+		return status.Error(codes.PermissionDenied, "Forbidden")
+	}
+	return nil
+}
+
+// modelError maps a models error to a gRPC status, as the REST controllers
+// map them to HTTP statuses
+func modelError(err error, action string) error {
+	if err.Error() == "user not found" {
+		return status.Error(codes.NotFound, "User not found")
+	}
+	return status.Error(codes.Internal, fmt.Sprintf("Error %s user: %v", action, err))
+}
+
+// toProto converts a models.User to its protobuf message
+func toProto(user models.User) *usersv1.User {
+	id, _ := strconv.ParseInt(user.ID, 10, 64)
+	return &usersv1.User{Id: id, Name: user.Name, Address: user.Address, Country: user.Country}
+}
@@ -0,0 +1,182 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crud-app/pkg/auth"
+	"crud-app/pkg/middleware"
+	"crud-app/pkg/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// Header carries the client-chosen key that identifies a request across retries
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set to "true" on responses replayed from an earlier request
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+	maxBodySize  = 1 << 20
+)
+
+// Store keeps idempotency keys and the responses stored for them
+type Store interface {
+	Reserve(ctx context.Context, keyHash, requestHash string, expiresAt, lockedUntil time.Time) (*models.IdempotentResponse, error)
+	Save(ctx context.Context, keyHash string, status int, contentType string, body []byte) error
+	Release(ctx context.Context, keyHash string) error
+}
+
+// dbStore keeps keys in the idempotency_keys table
+type dbStore struct{}
+
+func (dbStore) Reserve(ctx context.Context, keyHash, requestHash string, expiresAt, lockedUntil time.Time) (*models.IdempotentResponse, error) {
+	return models.ReserveIdempotencyKey(ctx, keyHash, requestHash, expiresAt, lockedUntil)
+}
+
+func (dbStore) Save(ctx context.Context, keyHash string, status int, contentType string, body []byte) error {
+	return models.SaveIdempotentResponse(ctx, keyHash, status, contentType, body)
+}
+
+func (dbStore) Release(ctx context.Context, keyHash string) error {
+	return models.DeleteIdempotencyKey(ctx, keyHash)
+}
+
+// Middleware makes the routes it wraps safe to retry. The first response to a
+// request carrying an Idempotency-Key is stored for ttl and replayed for
+// retries with the same key and payload. Reusing a key with a different
+// payload is rejected with 422, and retrying while the first request is still
+// running with 409. If the first request never finishes, e.g. because the
+// process died, a retry may take the key over after lockTimeout. Requests
+// without the header run as normal. It must run after authentication, since
+// keys are scoped to the caller.
+func Middleware(ttl, lockTimeout time.Duration) middleware.Middleware {
+	return newMiddleware(dbStore{}, ttl, lockTimeout)
+}
+
+func newMiddleware(store Store, ttl, lockTimeout time.Duration) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(Header)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxKeyLength {
+				middleware.WriteError(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+			if err != nil {
+				middleware.WriteError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			keyHash := hash(scope(r), key)
+			requestHash := hash(r.Method, r.URL.Path, string(body))
+
+			now := time.Now()
+			existing, err := store.Reserve(r.Context(), keyHash, requestHash, now.Add(ttl), now.Add(lockTimeout))
+			if err != nil {
+				log.Printf("idempotency key error: %v", err)
+				middleware.WriteError(w, http.StatusInternalServerError, "Error checking Idempotency-Key")
+				return
+			}
+
+			if existing != nil {
+				switch {
+				case existing.RequestHash != requestHash:
+					middleware.WriteError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request")
+				case !existing.Completed:
+					middleware.WriteError(w, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+				default:
+					if existing.ContentType != "" {
+						w.Header().Set("Content-Type", existing.ContentType)
+					}
+					w.Header().Set(ReplayedHeader, "true")
+					w.WriteHeader(existing.StatusCode)
+					w.Write(existing.Body)
+				}
+				return
+			}
+
+			// Keep going if the client has gone away or the request timed out,
+			// so a retry still sees how the first attempt ended
+			ctx := context.WithoutCancel(r.Context())
+			release := func() {
+				if err := store.Release(ctx, keyHash); err != nil {
+					log.Printf("idempotency key error: %v", err)
+				}
+			}
+
+			// A panic leaves no response to store, so free the key for a retry
+			// before passing the panic on to the recovery middleware
+			defer func() {
+				if p := recover(); p != nil {
+					release()
+					panic(p)
+				}
+			}()
+
+			rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			// Server errors aren't stored, so the client can retry them
+			if rec.status >= http.StatusInternalServerError {
+				release()
+				return
+			}
+
+			contentType := rec.Header().Get("Content-Type")
+			if err := store.Save(ctx, keyHash, rec.status, contentType, rec.body.Bytes()); err != nil {
+				log.Printf("idempotency key error: %v", err)
+			}
+		})
+	}
+}
+
+// scope identifies the caller, so different clients can't see each other's responses
+func scope(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		return p.Method + ":" + p.Subject
+	}
+	return "anonymous"
+}
+
+// hash returns the hex SHA-256 of parts joined by newlines
+func hash(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		io.WriteString(h, part)
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recorder passes a response through while keeping a copy of its status and body
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
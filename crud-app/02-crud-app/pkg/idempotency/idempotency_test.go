@@ -0,0 +1,182 @@
+package idempotency
+
+import (
+	"context"
+	"crud-app/pkg/middleware"
+	"crud-app/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore keeps keys in a map, the way the idempotency_keys table would
+type memoryStore struct {
+	mu          sync.Mutex
+	keys        map[string]*models.IdempotentResponse
+	lockedUntil map[string]time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{keys: map[string]*models.IdempotentResponse{}, lockedUntil: map[string]time.Time{}}
+}
+
+func (s *memoryStore) Reserve(ctx context.Context, keyHash, requestHash string, expiresAt, lockedUntil time.Time) (*models.IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.keys[keyHash]; ok {
+		copied := *existing
+		return &copied, nil
+	}
+	s.keys[keyHash] = &models.IdempotentResponse{RequestHash: requestHash}
+	s.lockedUntil[keyHash] = lockedUntil
+	return nil, nil
+}
+
+func (s *memoryStore) Save(ctx context.Context, keyHash string, status int, contentType string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[keyHash] = &models.IdempotentResponse{
+		RequestHash: s.keys[keyHash].RequestHash,
+		Completed:   true,
+		StatusCode:  status,
+		ContentType: contentType,
+		Body:        body,
+	}
+	return nil
+}
+
+func (s *memoryStore) Release(ctx context.Context, keyHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, keyHash)
+	return nil
+}
+
+func (s *memoryStore) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.keys)
+}
+
+// serve sends a POST with key and body through h
+func serve(h http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/users/add", strings.NewReader(body))
+	req.Header.Set(Header, key)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddlewareReplaysCompletedResponse(t *testing.T) {
+	calls := 0
+	h := newMiddleware(newMemoryStore(), time.Hour, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	}))
+
+	first := serve(h, "abc", `{"name":"a"}`)
+	second := serve(h, "abc", `{"name":"a"}`)
+
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %q, want %d %q", second.Code, second.Body, first.Code, first.Body)
+	}
+	if second.Header().Get(ReplayedHeader) != "true" || first.Header().Get(ReplayedHeader) != "" {
+		t.Error("only the replayed response should carry " + ReplayedHeader)
+	}
+	if got := second.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("replayed Content-Type = %q", got)
+	}
+}
+
+func TestMiddlewareRejectsDifferentPayload(t *testing.T) {
+	h := newMiddleware(newMemoryStore(), time.Hour, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	serve(h, "abc", `{"name":"a"}`)
+	if w := serve(h, "abc", `{"name":"b"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestMiddlewareRejectsRequestInProgress(t *testing.T) {
+	store := newMemoryStore()
+	h := newMiddleware(store, time.Hour, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A retry arriving while the first request is still running
+		retry := serve(newMiddleware(store, time.Hour, time.Minute)(http.NotFoundHandler()), "abc", "")
+		if retry.Code != http.StatusConflict {
+			t.Errorf("retry status = %d, want %d", retry.Code, http.StatusConflict)
+		}
+	}))
+	serve(h, "abc", "")
+
+	if !store.keys[hash("anonymous", "abc")].Completed {
+		t.Error("response was not stored")
+	}
+}
+
+func TestMiddlewareReleasesKeyOnServerError(t *testing.T) {
+	store := newMemoryStore()
+	calls := 0
+	h := newMiddleware(store, time.Hour, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		middleware.WriteError(w, http.StatusServiceUnavailable, "try again")
+	}))
+
+	serve(h, "abc", "")
+	if store.len() != 0 {
+		t.Fatal("key still reserved after a 5xx")
+	}
+	serve(h, "abc", "")
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want the retry to run it again", calls)
+	}
+}
+
+func TestMiddlewareReleasesKeyOnPanic(t *testing.T) {
+	store := newMemoryStore()
+	h := middleware.Recover()(newMiddleware(store, time.Hour, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+
+	if w := serve(h, "abc", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want the panic to reach Recover", w.Code)
+	}
+	if store.len() != 0 {
+		t.Error("key still reserved after a panic")
+	}
+}
+
+func TestMiddlewareLocksKeyForLockTimeout(t *testing.T) {
+	store := newMemoryStore()
+	h := newMiddleware(store, time.Hour, time.Minute)(http.NotFoundHandler())
+
+	before := time.Now()
+	serve(h, "abc", "")
+	lockedUntil := store.lockedUntil[hash("anonymous", "abc")]
+	if lockedUntil.Before(before.Add(time.Minute)) || lockedUntil.After(time.Now().Add(time.Minute)) {
+		t.Errorf("locked until %v, want a minute from now", lockedUntil)
+	}
+}
+
+func TestMiddlewareSkipsRequestsWithoutKey(t *testing.T) {
+	store := newMemoryStore()
+	h := newMiddleware(store, time.Hour, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	if w := serve(h, "", ""); w.Code != http.StatusCreated {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if store.len() != 0 {
+		t.Error("a request without a key was stored")
+	}
+}
@@ -0,0 +1,174 @@
+// Package lifecycle starts and stops the parts of the server in dependency order.
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// DefaultStopTimeout is used for components that don't set StopTimeout
+const DefaultStopTimeout = 10 * time.Second
+
+// Component is one part of the server, such as the database, a background
+// worker or a listener. Every field but Name is optional.
+type Component struct {
+	Name string
+
+	// Start prepares the component, e.g. opens a connection or binds a
+	// listener. It runs before later components are started, so they can
+	// rely on it.
+	Start func(ctx context.Context) error
+
+	// Run does the component's work in its own goroutine once it has
+	// started, until its ctx is cancelled. Returning an error before then
+	// shuts the whole server down, and the error is returned from
+	// Manager.Run. Returning nil early just means there is nothing to do.
+	Run func(ctx context.Context) error
+
+	// Stop releases the component, e.g. closes a connection or drains a
+	// server. It is called before Run's ctx is cancelled, and its own ctx
+	// ends after StopTimeout.
+	Stop func(ctx context.Context) error
+
+	// StopTimeout bounds how long Stop, and waiting for Run to return, may take
+	StopTimeout time.Duration
+}
+
+// Manager runs components. They are started in the order they were added
+// and stopped in reverse, so each can depend on the ones added before it.
+type Manager struct {
+	components []Component
+}
+
+// New creates an empty Manager
+func New() *Manager {
+	return &Manager{}
+}
+
+// Add registers c after the components already added
+func (m *Manager) Add(c Component) {
+	m.components = append(m.components, c)
+}
+
+// running is a started component
+type running struct {
+	Component
+	cancel context.CancelFunc // Cancels Run's context; nil without Run
+	done   chan struct{}      // Closed when Run returns; nil without Run
+}
+
+// Run starts every component, then waits until ctx is cancelled or a
+// component's Run fails, and stops the started components in reverse order.
+// It returns the error that caused the shutdown, if any. If a component
+// fails to start, the ones before it are stopped and the rest never start.
+func (m *Manager) Run(ctx context.Context) error {
+	failed := make(chan error, len(m.components))
+
+	var started []*running
+	var err error
+	for _, c := range m.components {
+		if c.Start != nil {
+			if startErr := c.Start(ctx); startErr != nil {
+				err = fmt.Errorf("error starting %s: %v", c.Name, startErr)
+				break
+			}
+		}
+
+		r := &running{Component: c}
+		if c.Run != nil {
+			// Runs are cancelled one at a time while stopping, not all at once with ctx
+			var runCtx context.Context
+			runCtx, r.cancel = context.WithCancel(context.WithoutCancel(ctx))
+			r.done = make(chan struct{})
+			go func() {
+				defer close(r.done)
+				runErr := c.Run(runCtx)
+				switch {
+				case runErr == nil:
+				case runCtx.Err() == nil:
+					failed <- fmt.Errorf("%s: %v", c.Name, runErr)
+				default:
+					log.Printf("Error stopping %s: %v", c.Name, runErr)
+				}
+			}()
+		}
+		started = append(started, r)
+	}
+
+	if err == nil {
+		select {
+		case <-ctx.Done():
+		case err = <-failed:
+			log.Printf("Shutting down after an error: %v", err)
+		}
+	}
+
+	for i := len(started) - 1; i >= 0; i-- {
+		stop(started[i])
+	}
+	return err
+}
+
+// stop stops r, giving up after its StopTimeout
+func stop(r *running) {
+	timeout := r.StopTimeout
+	if timeout <= 0 {
+		timeout = DefaultStopTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	fmt.Printf("Stopping %s...\n", r.Name)
+	if r.Stop != nil {
+		if err := r.Stop(ctx); err != nil {
+			log.Printf("Error stopping %s: %v", r.Name, err)
+		}
+	}
+	if r.cancel != nil {
+		r.cancel()
+	}
+	if r.done != nil {
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			log.Printf("%s did not stop within %v", r.Name, timeout)
+		}
+	}
+}
+
+// SignalContext returns a context that is cancelled on the first of signals,
+// starting a graceful shutdown. A second signal calls force, which should
+// exit straight away. Call stop once shutdown has finished.
+func SignalContext(parent context.Context, force func(), signals ...os.Signal) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(parent)
+	received := make(chan os.Signal, 2)
+	signal.Notify(received, signals...)
+
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-received:
+			fmt.Printf("Received %v, shutting down (send it again to force exit)...\n", sig)
+			cancel()
+		case <-stopped:
+			return
+		}
+
+		select {
+		case sig := <-received:
+			fmt.Printf("Received %v again, forcing exit\n", sig)
+			force()
+		case <-stopped:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(received)
+		close(stopped)
+		cancel()
+	}
+}
@@ -0,0 +1,169 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// recorder logs component events in the order they happen
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+// component records its start, run and stop under name
+func (r *recorder) component(name string) Component {
+	return Component{
+		Name:  name,
+		Start: func(ctx context.Context) error { r.add("start " + name); return nil },
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			r.add("run " + name + " done")
+			return nil
+		},
+		Stop: func(ctx context.Context) error { r.add("stop " + name); return nil },
+	}
+}
+
+func TestManagerStopsInReverseOrder(t *testing.T) {
+	rec := &recorder{}
+	m := New()
+	m.Add(rec.component("database"))
+	m.Add(rec.component("worker"))
+	m.Add(rec.component("server"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"start database", "start worker", "start server",
+		"stop server", "run server done",
+		"stop worker", "run worker done",
+		"stop database", "run database done",
+	}
+	if !reflect.DeepEqual(rec.events, want) {
+		t.Errorf("events = %q, want %q", rec.events, want)
+	}
+}
+
+func TestManagerStopsStartedComponentsWhenStartFails(t *testing.T) {
+	rec := &recorder{}
+	m := New()
+	m.Add(rec.component("database"))
+	m.Add(Component{Name: "cache", Start: func(ctx context.Context) error { return errors.New("connection refused") }})
+	m.Add(rec.component("server"))
+
+	err := m.Run(context.Background())
+	if err == nil || err.Error() != "error starting cache: connection refused" {
+		t.Fatalf("Run error = %v", err)
+	}
+
+	want := []string{"start database", "stop database", "run database done"}
+	if !reflect.DeepEqual(rec.events, want) {
+		t.Errorf("events = %q, want %q", rec.events, want)
+	}
+}
+
+func TestManagerShutsDownWhenRunFails(t *testing.T) {
+	rec := &recorder{}
+	m := New()
+	m.Add(rec.component("database"))
+	m.Add(Component{Name: "server", Run: func(ctx context.Context) error { return errors.New("address already in use") }})
+
+	done := make(chan error)
+	go func() { done <- m.Run(context.Background()) }()
+
+	select {
+	case err := <-done:
+		if err == nil || err.Error() != "server: address already in use" {
+			t.Fatalf("Run error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after a component failed")
+	}
+	if want := []string{"start database", "stop database", "run database done"}; !reflect.DeepEqual(rec.events, want) {
+		t.Errorf("events = %q, want %q", rec.events, want)
+	}
+}
+
+func TestManagerIgnoresRunsThatFinishEarly(t *testing.T) {
+	m := New()
+	m.Add(Component{Name: "idle", Run: func(ctx context.Context) error { return nil }})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := m.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() == nil {
+		t.Error("Run returned before ctx was cancelled")
+	}
+}
+
+func TestManagerGivesUpAfterStopTimeout(t *testing.T) {
+	rec := &recorder{}
+	stuck := make(chan struct{})
+	defer close(stuck)
+
+	m := New()
+	m.Add(rec.component("database"))
+	m.Add(Component{
+		Name:        "worker",
+		Run:         func(ctx context.Context) error { <-stuck; return nil },
+		StopTimeout: 10 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if err := m.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run took %v with a stuck component", elapsed)
+	}
+	if got := strings.Join(rec.events, ", "); !strings.Contains(got, "stop database") {
+		t.Errorf("a stuck component kept the rest from stopping: %s", got)
+	}
+}
+
+func TestSignalContextForcesExitOnSecondSignal(t *testing.T) {
+	forced := make(chan struct{})
+	ctx, stop := SignalContext(context.Background(), func() { close(forced) }, syscall.SIGUSR1)
+	defer stop()
+
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("first signal did not cancel the context")
+	}
+	select {
+	case <-forced:
+		t.Fatal("first signal forced exit")
+	default:
+	}
+
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	select {
+	case <-forced:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second signal did not force exit")
+	}
+}
@@ -0,0 +1,77 @@
+package mailer
+
+import (
+	"context"
+	"crud-app/pkg/config"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer selected in the config
+func New(cfg config.MailerConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "log":
+		return &LogMailer{From: cfg.From}, nil
+	case "file":
+		return &FileMailer{From: cfg.From, Path: cfg.FilePath}, nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", cfg.Driver)
+	}
+}
+
+// LogMailer writes emails to the application log instead of sending them
+type LogMailer struct {
+	From string
+}
+
+// Send logs the message
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("mail from=%s to=%s subject=%q\n%s", m.From, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer appends emails to a local file, for reading during development
+type FileMailer struct {
+	From string
+	Path string
+
+	mu sync.Mutex
+}
+
+// Send appends the message to the file
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening mail file: %v", err)
+	}
+	defer file.Close()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Date: %s\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "From: %s\nTo: %s\nSubject: %s\n\n%s\n", m.From, msg.To, msg.Subject, msg.Body)
+	b.WriteString(strings.Repeat("-", 72) + "\n")
+
+	if _, err := file.WriteString(b.String()); err != nil {
+		return fmt.Errorf("error writing mail file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+var body = strings.Repeat(`{"id":"1","name":"Ada"}`, 100)
+
+func serveCompressed(acceptEncoding, method string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/", nil)
+	r.Header.Set("Accept-Encoding", acceptEncoding)
+	w := httptest.NewRecorder()
+	Compress()(handler).ServeHTTP(w, r)
+	return w
+}
+
+func writeBody(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Length", "2300")
+	io.WriteString(w, body)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                        "",
+		"identity":                "",
+		"gzip":                    "gzip",
+		"gzip, deflate, br":       "br",
+		"GZIP;q=0.9, br;q=0.5":    "gzip",
+		"br;q=0, gzip;q=0":        "",
+		"gzip;q=0.8, br;q=0.8":    "br",
+		"deflate, gzip;q=invalid": "gzip",
+	}
+	for header, want := range tests {
+		if got := negotiateEncoding(header); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCompressGzip(t *testing.T) {
+	w := serveCompressed("gzip", "GET", writeBody)
+
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Content-Length") != "" {
+		t.Fatalf("headers = %v, want gzip without a Content-Length", w.Header())
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Vary = %q", w.Header().Get("Vary"))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != body {
+		t.Errorf("decoded %d bytes, want the original body", len(got))
+	}
+}
+
+func TestCompressBrotli(t *testing.T) {
+	w := serveCompressed("gzip, br", "GET", writeBody)
+
+	if w.Header().Get("Content-Encoding") != "br" {
+		t.Fatalf("Content-Encoding = %q, want br", w.Header().Get("Content-Encoding"))
+	}
+	if got, _ := io.ReadAll(brotli.NewReader(w.Body)); string(got) != body {
+		t.Errorf("decoded %d bytes, want the original body", len(got))
+	}
+}
+
+func TestCompressLeavesSomeResponsesAlone(t *testing.T) {
+	tests := map[string]struct {
+		method  string
+		handler http.HandlerFunc
+	}{
+		"HEAD": {"HEAD", writeBody},
+		"204":  {"GET", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }},
+		"304":  {"GET", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotModified) }},
+		"encoded": {"GET", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "identity")
+			writeBody(w, r)
+		}},
+		"no match": {"GET", writeBody},
+	}
+	for name, tt := range tests {
+		accept := "gzip"
+		if name == "no match" {
+			accept = "deflate"
+		}
+		w := serveCompressed(accept, tt.method, tt.handler)
+
+		if enc := w.Header().Get("Content-Encoding"); enc == "gzip" {
+			t.Errorf("%s: response was compressed", name)
+		}
+		if w.Code == http.StatusOK && w.Body.String() != body && tt.method != "HEAD" {
+			t.Errorf("%s: body changed", name)
+		}
+	}
+}
+
+func TestCompressFlushSendsCompressedData(t *testing.T) {
+	w := serveCompressed("gzip", "GET", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+		if w.(*compressWriter).ResponseWriter.(*httptest.ResponseRecorder).Body.Len() == 0 {
+			t.Error("nothing reached the client after Flush")
+		}
+	})
+	if !w.Flushed {
+		t.Error("the flush did not reach the client")
+	}
+}
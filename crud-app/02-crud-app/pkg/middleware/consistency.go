@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"crud-app/pkg/models"
+	"net/http"
+	"strings"
+)
+
+// ConsistencyHeader lets a client ask for reads from the primary database,
+// e.g. right after it changed a user, when the replicas may not have caught up
+const ConsistencyHeader = "X-Consistency"
+
+// ReadYourWrites sends a request's reads to the primary once it has written,
+// or from the start if it sends "X-Consistency: strong". Other reads may be
+// served by a replica.
+func ReadYourWrites() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := models.ReadYourWrites(r.Context())
+			if strings.EqualFold(r.Header.Get(ConsistencyHeader), "strong") {
+				ctx = models.UsePrimary(r.Context())
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
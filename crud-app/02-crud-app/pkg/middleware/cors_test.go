@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testCORS = CORSOptions{
+	AllowedOrigins: []string{"https://app.example"},
+	AllowedMethods: []string{"GET", "POST"},
+	AllowedHeaders: []string{"Authorization", "Content-Type"},
+	ExposedHeaders: []string{"X-Request-ID"},
+	MaxAge:         10 * time.Minute,
+}
+
+func serveCORS(opts CORSOptions, r *http.Request) (*httptest.ResponseRecorder, bool) {
+	reached := false
+	w := httptest.NewRecorder()
+	CORS(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	})).ServeHTTP(w, r)
+	return w, reached
+}
+
+func TestCORSAllowedOrigin(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://APP.example")
+	w, reached := serveCORS(testCORS, r)
+
+	if !reached {
+		t.Error("handler did not run")
+	}
+	h := w.Header()
+	if h.Get("Access-Control-Allow-Origin") != "https://APP.example" || h.Get("Access-Control-Expose-Headers") != "X-Request-ID" || h.Get("Vary") != "Origin" {
+		t.Errorf("headers = %v", h)
+	}
+	if h.Get("Access-Control-Allow-Methods") != "" {
+		t.Error("preflight headers sent on a simple request")
+	}
+}
+
+func TestCORSIgnoresOtherOrigins(t *testing.T) {
+	for _, origin := range []string{"", "https://evil.example"} {
+		r := httptest.NewRequest("OPTIONS", "/", nil)
+		r.Header.Set("Access-Control-Request-Method", "POST")
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		w, reached := serveCORS(testCORS, r)
+
+		if !reached || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("origin %q: reached %v, headers %v; want no CORS headers", origin, reached, w.Header())
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	r := httptest.NewRequest("OPTIONS", "/", nil)
+	r.Header.Set("Origin", "https://other.example")
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	opts := testCORS
+	opts.AllowedOrigins = []string{"*"}
+	w, reached := serveCORS(opts, r)
+
+	if reached {
+		t.Error("preflight reached the handler")
+	}
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want 204", w.Code)
+	}
+	h := w.Header()
+	if h.Get("Access-Control-Allow-Origin") != "https://other.example" ||
+		h.Get("Access-Control-Allow-Methods") != "GET, POST" ||
+		h.Get("Access-Control-Allow-Headers") != "Authorization, Content-Type" ||
+		h.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("headers = %v", h)
+	}
+}
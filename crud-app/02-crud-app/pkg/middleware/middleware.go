@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Middleware wraps an http.Handler with additional behaviour.
+// It is an alias so middlewares can be passed straight to mux.Router.Use.
+type Middleware = func(http.Handler) http.Handler
+
+// Chain is an ordered middleware stack. The first middleware is the outermost.
+type Chain []Middleware
+
+// New creates a Chain from the given middlewares
+func New(middlewares ...Middleware) Chain {
+	return Chain(middlewares)
+}
+
+// Append returns a new Chain with the given middlewares added to the end
+func (c Chain) Append(middlewares ...Middleware) Chain {
+	chain := make(Chain, 0, len(c)+len(middlewares))
+	chain = append(chain, c...)
+	return append(chain, middlewares...)
+}
+
+// Then wraps h with every middleware in the chain
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		h = c[i](h)
+	}
+	return h
+}
+
+// ThenFunc wraps a handler function with every middleware in the chain
+func (c Chain) ThenFunc(f http.HandlerFunc) http.Handler {
+	return c.Then(f)
+}
+
+// WriteError writes a {"error": message} JSON body with the given status code.
+// Middlewares use it so their errors match the controllers' error shape.
+func WriteError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// tag returns a middleware that appends name to order on the way in
+func tag(order *[]string, name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*order = append(*order, name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestChainRunsMiddlewaresInOrder(t *testing.T) {
+	var order []string
+	base := New(tag(&order, "a"), tag(&order, "b"))
+	h := base.Append(tag(&order, "c")).ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	})
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if got := strings.Join(order, ","); got != "a,b,c,handler" {
+		t.Errorf("order = %s, want a,b,c,handler", got)
+	}
+}
+
+func TestChainAppendDoesNotModifyTheOriginal(t *testing.T) {
+	var order []string
+	base := make(Chain, 0, 4)
+	base = append(base, tag(&order, "base"))
+
+	one := base.Append(tag(&order, "one"))
+	two := base.Append(tag(&order, "two"))
+	if len(base) != 1 {
+		t.Fatalf("base has %d middlewares, want 1", len(base))
+	}
+
+	one.ThenFunc(func(http.ResponseWriter, *http.Request) {}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	two.ThenFunc(func(http.ResponseWriter, *http.Request) {}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if got := strings.Join(order, ","); got != "base,one,base,two" {
+		t.Errorf("order = %s, want base,one,base,two", got)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteError(w, http.StatusTeapot, `short "and" stout`)
+
+	if w.Code != http.StatusTeapot || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("got %d with Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if got := w.Body.String(); got != `{"error":"short \"and\" stout"}`+"\n" {
+		t.Errorf("body = %s", got)
+	}
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"crud-app/pkg/render"
+	"net/http"
+)
+
+// Negotiate responds with 406 Not Acceptable before the handler runs if the
+// request's Accept header rules out every format the API can write, so a
+// write isn't made only for its response to be refused
+func Negotiate() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !render.Acceptable(r) {
+				w.Header().Add("Vary", "Accept")
+				render.NotAcceptable(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
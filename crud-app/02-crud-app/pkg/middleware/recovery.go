@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recover catches panics from downstream handlers, logs the stack trace and
+// responds with a 500 JSON error instead of dropping the connection
+func Recover() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					// Let the server abort the response as it normally would
+					if rec == http.ErrAbortHandler {
+						panic(rec)
+					}
+					log.Printf("panic serving %s %s [%s]: %v\n%s",
+						r.Method, r.URL.Path, GetRequestID(r.Context()), rec, debug.Stack())
+					WriteError(w, http.StatusInternalServerError, "Internal server error")
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
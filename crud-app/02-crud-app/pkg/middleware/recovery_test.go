@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecoverRespondsWith500(t *testing.T) {
+	w := httptest.NewRecorder()
+	Recover()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("got %d with Content-Type %q, want a 500 JSON error", w.Code, w.Header().Get("Content-Type"))
+	}
+	if got := w.Body.String(); got != "{\"error\":\"Internal server error\"}\n" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestRecoverLetsAbortsThrough(t *testing.T) {
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", rec)
+		}
+	}()
+	Recover()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
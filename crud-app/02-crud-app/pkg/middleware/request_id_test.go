@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var generatedID = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+func serveRequestID(incoming string) (response, seen string) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if incoming != "" {
+		r.Header.Set(RequestIDHeader, incoming)
+	}
+	w := httptest.NewRecorder()
+	RequestID()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = GetRequestID(r.Context())
+	})).ServeHTTP(w, r)
+	return w.Header().Get(RequestIDHeader), seen
+}
+
+func TestRequestIDGeneratesIDs(t *testing.T) {
+	first, seen := serveRequestID("")
+	if !generatedID.MatchString(first) || seen != first {
+		t.Errorf("response ID %q, handler saw %q; want the same 32 hex digits", first, seen)
+	}
+	if second, _ := serveRequestID(""); second == first {
+		t.Error("two requests got the same ID")
+	}
+}
+
+func TestRequestIDReusesIncomingIDs(t *testing.T) {
+	if got, seen := serveRequestID("req-123"); got != "req-123" || seen != "req-123" {
+		t.Errorf("got %q and %q, want the incoming ID", got, seen)
+	}
+
+	long := strings.Repeat("x", 129)
+	if got, _ := serveRequestID(long); !generatedID.MatchString(got) {
+		t.Errorf("an oversized incoming ID was kept: %q", got)
+	}
+}
+
+func TestGetRequestIDWithoutMiddleware(t *testing.T) {
+	if id := GetRequestID(httptest.NewRequest("GET", "/", nil).Context()); id != "" {
+		t.Errorf("GetRequestID = %q, want empty", id)
+	}
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Timeout cancels the request context and responds with a 503 JSON error if
+// the handler takes longer than d. If the handler has already started its
+// response by then, the connection is aborted instead so the client can't
+// mistake a cut off body for a complete one. Don't use it on streaming routes.
+func Timeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{w: w, h: w.Header().Clone()}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+						return
+					}
+					close(done)
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+			}()
+
+			select {
+			case p := <-panicked:
+				// Re-panic on the server's goroutine so Recover sees it
+				panic(p)
+			case <-done:
+				return
+			case <-ctx.Done():
+			}
+
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			select {
+			case <-done:
+				return // Finished while the lock was being taken
+			default:
+			}
+			tw.timedOut = true
+
+			switch {
+			case tw.hijacked:
+				// The handler owns the connection now
+			case tw.wroteHeader:
+				panic(http.ErrAbortHandler)
+			case errors.Is(ctx.Err(), context.DeadlineExceeded):
+				WriteError(w, http.StatusServiceUnavailable, "Request timed out")
+			}
+		})
+	}
+}
+
+// timeoutWriter passes writes through to the client until the request times
+// out, after which they fail with http.ErrHandlerTimeout. The handler gets
+// its own header map, so a late handler can't race the timeout response.
+type timeoutWriter struct {
+	w http.ResponseWriter
+	h http.Header
+
+	mu          sync.Mutex
+	wroteHeader bool
+	hijacked    bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeader(status)
+}
+
+// writeHeader sends the handler's headers; tw.mu must be held
+func (tw *timeoutWriter) writeHeader(status int) {
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+
+	dst := tw.w.Header()
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+	tw.w.WriteHeader(status)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeader(http.StatusOK)
+	return tw.w.Write(b)
+}
+
+// Flush sends buffered data to the client, unless the request has timed out
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	tw.writeHeader(http.StatusOK)
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets protocol upgrades take over the connection, after which the
+// timeout no longer applies
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	h, ok := tw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		tw.hijacked = true
+	}
+	return conn, rw, err
+}
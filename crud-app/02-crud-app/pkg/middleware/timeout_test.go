@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutPassesFastResponsesThrough(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("X-Outer", "kept")
+	Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if w.Header().Get("X-Outer") != "kept" {
+			t.Error("headers set by outer middlewares are missing")
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("done"))
+	})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusAccepted || w.Body.String() != "done" || w.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("got %d %q %v", w.Code, w.Body, w.Header())
+	}
+}
+
+func TestTimeoutRespondsWithJSON(t *testing.T) {
+	lateWrite := make(chan error, 1)
+	w := httptest.NewRecorder()
+	Timeout(10*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/plain")
+		_, err := w.Write([]byte("too late"))
+		lateWrite <- err
+	})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if got := w.Body.String(); got != "{\"error\":\"Request timed out\"}\n" {
+		t.Errorf("body = %q", got)
+	}
+	if err := <-lateWrite; !errors.Is(err, http.ErrHandlerTimeout) {
+		t.Errorf("late write error = %v, want ErrHandlerTimeout", err)
+	}
+}
+
+func TestTimeoutDoesNotWaitForHandlersIgnoringTheContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	Timeout(10*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusServiceUnavailable || time.Since(start) > time.Second {
+		t.Errorf("status %d after %v, want a prompt 503", w.Code, time.Since(start))
+	}
+}
+
+func TestTimeoutAbortsStartedResponses(t *testing.T) {
+	srv := httptest.NewServer(Timeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, _ := io.ReadAll(resp.Body)
+	if len(got) == 100 {
+		t.Error("the cut off response looked complete")
+	}
+}
+
+func TestTimeoutSupportsFlush(t *testing.T) {
+	w := httptest.NewRecorder()
+	Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("chunk"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Flush: %v", err)
+		}
+	})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if !w.Flushed {
+		t.Error("the flush did not reach the client")
+	}
+}
+
+func TestTimeoutPanicsReachRecover(t *testing.T) {
+	w := httptest.NewRecorder()
+	New(Recover(), Timeout(time.Second)).ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+}
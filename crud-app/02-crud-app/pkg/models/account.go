@@ -0,0 +1,103 @@
+package models
+
+import (
+	"context"
+	"crud-app/pkg/telemetry"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Account is a user record with login credentials
+type Account struct {
+	ID           int
+	Name         string
+	Email        string
+	PasswordHash string
+	Role         string
+}
+
+// isDuplicateKey reports whether err is a MySQL unique key violation
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+// CreateAccount creates a user that can log in with email and password,
+// and records a user.created event
+func CreateAccount(ctx context.Context, user User, email, passwordHash, role string) (int, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.CreateAccount")
+	defer span.End()
+
+	var id int
+	err := WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		query := "INSERT INTO users (name, address, country, email, password_hash, role) VALUES (?, ?, ?, ?, ?, ?)"
+		result, err := tx.ExecContext(ctx, query, user.Name, user.Address, user.Country, email, passwordHash, role)
+		if err != nil {
+			if isDuplicateKey(err) {
+				return fmt.Errorf("email already registered")
+			}
+			return fmt.Errorf("error creating account: %w", err)
+		}
+
+		lastID, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("error getting last insert id: %w", err)
+		}
+		id = int(lastID)
+
+		user.ID = strconv.Itoa(id)
+		return insertOutboxEvent(ctx, tx, EventUserCreated, user)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetAccountByEmail retrieves the account registered with email
+func GetAccountByEmail(ctx context.Context, email string) (*Account, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.GetAccountByEmail")
+	defer span.End()
+
+	query := "SELECT id, name, email, password_hash, role FROM users WHERE email = ? AND password_hash IS NOT NULL"
+	row := conn(ctx).QueryRowContext(ctx, query, email)
+
+	var account Account
+	err := row.Scan(&account.ID, &account.Name, &account.Email, &account.PasswordHash, &account.Role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("account not found")
+		}
+		return nil, fmt.Errorf("error scanning account: %w", err)
+	}
+
+	return &account, nil
+}
+
+// UpdatePasswordHash sets a new password hash for a user
+func UpdatePasswordHash(ctx context.Context, userID int, passwordHash string) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.UpdatePasswordHash")
+	defer span.End()
+
+	query := "UPDATE users SET password_hash = ? WHERE id = ?"
+	result, err := conn(ctx).ExecContext(ctx, query, passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("error updating password: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("account not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"context"
+	"crud-app/pkg/telemetry"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// APIKeyPrefix starts every generated API key so they are easy to recognise
+const APIKeyPrefix = "ak_"
+
+// APIKey represents a stored API key. Only the SHA-256 hash of the key is kept.
+type APIKey struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	KeyPrefix string     `json:"key_prefix"`
+	Role      string     `json:"role"`
+	UserID    *int       `json:"user_id,omitempty"` // User record the key acts as, if any
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateAPIKey generates a new API key and stores its hash.
+// The plaintext key is returned once and cannot be recovered later.
+func CreateAPIKey(ctx context.Context, name, role string, userID *int) (string, *APIKey, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.CreateAPIKey")
+	defer span.End()
+
+	key, err := NewToken(APIKeyPrefix)
+	if err != nil {
+		return "", nil, err
+	}
+	prefix := key[:len(APIKeyPrefix)+6]
+
+	query := "INSERT INTO api_keys (name, key_prefix, key_hash, role, user_id) VALUES (?, ?, ?, ?, ?)"
+	result, err := conn(ctx).ExecContext(ctx, query, name, prefix, HashToken(key), role, userID)
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating api key: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return "", nil, fmt.Errorf("error getting last insert id: %w", err)
+	}
+
+	return key, &APIKey{ID: int(id), Name: name, KeyPrefix: prefix, Role: role, UserID: userID, CreatedAt: time.Now()}, nil
+}
+
+// GetActiveAPIKeyByHash finds a key that has not been revoked by its hash
+func GetActiveAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.GetActiveAPIKeyByHash")
+	defer span.End()
+
+	query := "SELECT id, name, key_prefix, role, user_id, created_at FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL"
+	row := conn(ctx).QueryRowContext(ctx, query, hash)
+
+	var key APIKey
+	err := row.Scan(&key.ID, &key.Name, &key.KeyPrefix, &key.Role, &key.UserID, &key.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("api key not found")
+		}
+		return nil, fmt.Errorf("error scanning api key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// ListAPIKeys retrieves all API keys, including revoked ones
+func ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.ListAPIKeys")
+	defer span.End()
+
+	query := "SELECT id, name, key_prefix, role, user_id, created_at, revoked_at FROM api_keys ORDER BY id"
+	rows, err := conn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(&key.ID, &key.Name, &key.KeyPrefix, &key.Role, &key.UserID, &key.CreatedAt, &key.RevokedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey marks an API key as revoked
+func RevokeAPIKey(ctx context.Context, id int) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.RevokeAPIKey")
+	defer span.End()
+
+	query := "UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL"
+	result, err := conn(ctx).ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("error revoking api key: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("api key not found")
+	}
+
+	return nil
+}
@@ -1,20 +1,25 @@
 package models
 
 import (
+	"context"
+	"crud-app/pkg/config"
 	"database/sql"
 	"fmt"
+	"log"
 	"os"
-	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 var DB *sql.DB
 
 // * NOTE: When you actually do your assignment, make utility loaders and a config package for env references.
 
-func InitDatabase() (*sql.DB, error) {
+// InitDatabase connects to the primary database with the given pool settings
+func InitDatabase(pool config.PoolConfig) (*sql.DB, error) {
 	// Load environment variables
 	err := godotenv.Load()
 	if err != nil {
@@ -28,35 +33,46 @@ func InitDatabase() (*sql.DB, error) {
 	database := os.Getenv("MYSQL_DATABASE")
 	dbPort := os.Getenv("MYSQL_PORT")
 
-	// Create connection string
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
+	// Create connection string. clientFoundRows makes an UPDATE report the rows
+	// it matched rather than the ones it changed, so writing a user's current
+	// values again isn't mistaken for a missing user.
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&clientFoundRows=true",
 		dbUser, dbPassword, dbHost, dbPort, database)
 
-	// Open database connection
-	DB, err = sql.Open("mysql", dsn)
+	// Open database connection through the otelsql wrapper so every query gets a span
+	DB, err = otelsql.Open("mysql", dsn, otelsql.WithAttributes(semconv.DBSystemMySQL))
 	if err != nil {
-		return nil, fmt.Errorf("error opening database: %v", err)
+		return nil, fmt.Errorf("error opening database: %w", err)
 	}
 
 	// Configure connection pool settings
-	DB.SetMaxOpenConns(25)                 // Maximum number of open connections
-	DB.SetMaxIdleConns(5)                  // Maximum number of idle connections
-	DB.SetConnMaxLifetime(5 * time.Minute) // Maximum lifetime of a connection
+	configurePool(DB, pool)
+	publishPoolStats("primary", DB)
 
 	// Test the connection
 	err = DB.Ping()
 	if err != nil {
-		return nil, fmt.Errorf("error connecting to database: %v", err)
+		return nil, fmt.Errorf("error connecting to database: %w", err)
 	}
 
+	// Prepare the queries behind every user read
+	statements.prepare(context.Background(), DB)
+
 	fmt.Println("Database connected successfully!")
 	return DB, nil
 }
 
-// CloseDatabase closes the database connection
+// CloseDatabase closes the database connection and any replicas
 func CloseDatabase() error {
+	if replicas != nil {
+		if err := replicas.close(); err != nil {
+			log.Printf("Error closing replicas: %v", err)
+		}
+		replicas = nil
+	}
 	if DB != nil {
 		fmt.Println("Closing database connection...")
+		statements.close(DB)
 		return DB.Close()
 	}
 	return nil
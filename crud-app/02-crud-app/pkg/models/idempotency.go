@@ -0,0 +1,105 @@
+package models
+
+import (
+	"context"
+	"crud-app/pkg/telemetry"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// IdempotentResponse is the stored outcome of a request made with an Idempotency-Key
+type IdempotentResponse struct {
+	RequestHash string
+	Completed   bool // False while the first request is still being handled
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// ReserveIdempotencyKey claims keyHash for a request until lockedUntil. It
+// returns nil if the key was free, or if an earlier request with the same
+// payload reserved it but never finished before its lock ran out. Otherwise it
+// returns the existing record.
+func ReserveIdempotencyKey(ctx context.Context, keyHash, requestHash string, expiresAt, lockedUntil time.Time) (*IdempotentResponse, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.ReserveIdempotencyKey")
+	defer span.End()
+
+	now := time.Now()
+
+	// Clear out expired keys first so an old key can be reused
+	_, err := conn(ctx).ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= ?", now)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting expired idempotency keys: %w", err)
+	}
+
+	query := "INSERT INTO idempotency_keys (key_hash, request_hash, expires_at, locked_until) VALUES (?, ?, ?, ?)"
+	_, err = conn(ctx).ExecContext(ctx, query, keyHash, requestHash, expiresAt, lockedUntil)
+	if err == nil {
+		return nil, nil
+	}
+	if !isDuplicateKey(err) {
+		return nil, fmt.Errorf("error reserving idempotency key: %w", err)
+	}
+
+	// Take over a reservation that was abandoned before it stored a response
+	query = `UPDATE idempotency_keys SET expires_at = ?, locked_until = ?
+		WHERE key_hash = ? AND request_hash = ? AND status_code IS NULL AND locked_until <= ?`
+	result, err := conn(ctx).ExecContext(ctx, query, expiresAt, lockedUntil, keyHash, requestHash, now)
+	if err != nil {
+		return nil, fmt.Errorf("error reclaiming idempotency key: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected > 0 {
+		return nil, nil
+	}
+
+	query = "SELECT request_hash, status_code, content_type, response_body FROM idempotency_keys WHERE key_hash = ?"
+	row := conn(ctx).QueryRowContext(ctx, query, keyHash)
+
+	var existing IdempotentResponse
+	var status sql.NullInt64
+	var contentType sql.NullString
+	err = row.Scan(&existing.RequestHash, &status, &contentType, &existing.Body)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("idempotency key not found")
+		}
+		return nil, fmt.Errorf("error scanning idempotency key: %w", err)
+	}
+	existing.Completed = status.Valid
+	existing.StatusCode = int(status.Int64)
+	existing.ContentType = contentType.String
+
+	return &existing, nil
+}
+
+// SaveIdempotentResponse stores the response for a reserved key so retries can replay it
+func SaveIdempotentResponse(ctx context.Context, keyHash string, status int, contentType string, body []byte) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.SaveIdempotentResponse")
+	defer span.End()
+
+	query := "UPDATE idempotency_keys SET status_code = ?, content_type = ?, response_body = ? WHERE key_hash = ?"
+	_, err := conn(ctx).ExecContext(ctx, query, status, contentType, body, keyHash)
+	if err != nil {
+		return fmt.Errorf("error saving idempotent response: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteIdempotencyKey releases a reserved key, e.g. after a failed request
+func DeleteIdempotencyKey(ctx context.Context, keyHash string) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.DeleteIdempotencyKey")
+	defer span.End()
+
+	_, err := conn(ctx).ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key_hash = ?", keyHash)
+	if err != nil {
+		return fmt.Errorf("error deleting idempotency key: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,246 @@
+package models
+
+import (
+	"context"
+	"crud-app/pkg/telemetry"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event types written to the outbox when users change
+const (
+	EventUserCreated = "user.created"
+	EventUserUpdated = "user.updated"
+	EventUserDeleted = "user.deleted"
+)
+
+// OutboxEvent is a change event waiting to be delivered downstream
+type OutboxEvent struct {
+	ID        int64
+	Type      string
+	UserID    int
+	Payload   json.RawMessage // The user as it was after the change
+	CreatedAt time.Time
+	Attempts  int // Deliveries tried so far, including the current one
+}
+
+// insertOutboxEvent records a user change in the same transaction as the change itself
+func insertOutboxEvent(ctx context.Context, tx *sql.Tx, eventType string, user User) error {
+	payload, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("error encoding event: %w", err)
+	}
+
+	userID, err := strconv.Atoi(user.ID)
+	if err != nil {
+		return fmt.Errorf("invalid user id %q", user.ID)
+	}
+
+	query := "INSERT INTO outbox_events (event_type, user_id, payload) VALUES (?, ?, ?)"
+	_, err = tx.ExecContext(ctx, query, eventType, userID, payload)
+	if err != nil {
+		return fmt.Errorf("error writing outbox event: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimOutboxEvents returns up to limit events that are due for delivery and
+// hides them from other dispatchers for lease. An event that isn't marked
+// delivered before the lease ends is picked up again.
+func ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]OutboxEvent, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.ClaimOutboxEvents")
+	defer span.End()
+
+	var events []OutboxEvent
+	err := WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		// SKIP LOCKED lets several dispatchers claim disjoint batches
+		query := `SELECT id, event_type, user_id, payload, created_at, attempts FROM outbox_events
+			WHERE delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?
+			ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED`
+		rows, err := tx.QueryContext(ctx, query, time.Now(), limit)
+		if err != nil {
+			return fmt.Errorf("error querying outbox events: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var event OutboxEvent
+			err := rows.Scan(&event.ID, &event.Type, &event.UserID, &event.Payload, &event.CreatedAt, &event.Attempts)
+			if err != nil {
+				return fmt.Errorf("error scanning outbox event: %w", err)
+			}
+			event.Attempts++
+			events = append(events, event)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error querying outbox events: %w", err)
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		ids := make([]interface{}, 0, len(events)+1)
+		ids = append(ids, time.Now().Add(lease))
+		for _, event := range events {
+			ids = append(ids, event.ID)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(events)), ", ")
+		query = "UPDATE outbox_events SET next_attempt_at = ?, attempts = attempts + 1 WHERE id IN (" + placeholders + ")"
+		if _, err := tx.ExecContext(ctx, query, ids...); err != nil {
+			return fmt.Errorf("error claiming outbox events: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// MarkOutboxEventDelivered records that an event reached every sink
+func MarkOutboxEventDelivered(ctx context.Context, id int64) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.MarkOutboxEventDelivered")
+	defer span.End()
+
+	query := "UPDATE outbox_events SET delivered_at = ?, last_error = NULL WHERE id = ?"
+	_, err := conn(ctx).ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("error marking outbox event delivered: %w", err)
+	}
+
+	return nil
+}
+
+// RetryOutboxEvent records a failed delivery and schedules the next attempt
+func RetryOutboxEvent(ctx context.Context, id int64, lastErr string, nextAttemptAt time.Time) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.RetryOutboxEvent")
+	defer span.End()
+
+	query := "UPDATE outbox_events SET last_error = ?, next_attempt_at = ? WHERE id = ?"
+	_, err := conn(ctx).ExecContext(ctx, query, lastErr, nextAttemptAt, id)
+	if err != nil {
+		return fmt.Errorf("error rescheduling outbox event: %w", err)
+	}
+
+	return nil
+}
+
+// FailOutboxEvent records a failed delivery and stops retrying the event
+func FailOutboxEvent(ctx context.Context, id int64, lastErr string) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.FailOutboxEvent")
+	defer span.End()
+
+	query := "UPDATE outbox_events SET last_error = ?, failed_at = ? WHERE id = ?"
+	_, err := conn(ctx).ExecContext(ctx, query, lastErr, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("error failing outbox event: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseOutboxEvents hands back claimed events that were never attempted,
+// e.g. on shutdown, so they are due again straight away and the claim
+// doesn't count as an attempt
+func ReleaseOutboxEvents(ctx context.Context, ids []int64) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.ReleaseOutboxEvents")
+	defer span.End()
+
+	if len(ids) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, time.Now())
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	query := "UPDATE outbox_events SET next_attempt_at = ?, attempts = attempts - 1 WHERE attempts > 0 AND id IN (" + placeholders + ")"
+	_, err := conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("error releasing outbox events: %w", err)
+	}
+
+	return nil
+}
+
+// GetOutboxEventsAfter retrieves up to limit events with an ID greater than
+// afterID, ordered by ID, whether or not they have been delivered
+func GetOutboxEventsAfter(ctx context.Context, afterID int64, limit int) ([]OutboxEvent, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.GetOutboxEventsAfter")
+	defer span.End()
+
+	query := "SELECT id, event_type, user_id, payload, created_at, attempts FROM outbox_events WHERE id > ? ORDER BY id LIMIT ?"
+	rows, err := conn(ctx).QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []OutboxEvent
+	for rows.Next() {
+		var event OutboxEvent
+		err := rows.Scan(&event.ID, &event.Type, &event.UserID, &event.Payload, &event.CreatedAt, &event.Attempts)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning outbox event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// GetOutboxEventsByID retrieves the events with the given IDs that exist,
+// ordered by ID
+func GetOutboxEventsByID(ctx context.Context, ids []int64) ([]OutboxEvent, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.GetOutboxEventsByID")
+	defer span.End()
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	query := "SELECT id, event_type, user_id, payload, created_at, attempts FROM outbox_events WHERE id IN (" + placeholders + ") ORDER BY id"
+	rows, err := conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []OutboxEvent
+	for rows.Next() {
+		var event OutboxEvent
+		err := rows.Scan(&event.ID, &event.Type, &event.UserID, &event.Payload, &event.CreatedAt, &event.Attempts)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning outbox event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// GetLatestOutboxEventID returns the highest event ID, or 0 if there are no events
+func GetLatestOutboxEventID(ctx context.Context) (int64, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.GetLatestOutboxEventID")
+	defer span.End()
+
+	var id int64
+	err := conn(ctx).QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM outbox_events").Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error querying latest outbox event: %w", err)
+	}
+
+	return id, nil
+}
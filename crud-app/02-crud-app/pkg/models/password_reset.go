@@ -0,0 +1,58 @@
+package models
+
+import (
+	"context"
+	"crud-app/pkg/telemetry"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CreatePasswordReset stores a password reset token hash for a user
+func CreatePasswordReset(ctx context.Context, tokenHash string, userID int, expiresAt time.Time) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.CreatePasswordReset")
+	defer span.End()
+
+	query := "INSERT INTO password_resets (token_hash, user_id, expires_at) VALUES (?, ?, ?)"
+	_, err := conn(ctx).ExecContext(ctx, query, tokenHash, userID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error creating password reset: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumePasswordReset marks an unused, unexpired reset token as used and
+// returns its user ID. Each token can only be consumed once.
+func ConsumePasswordReset(ctx context.Context, tokenHash string) (int, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.ConsumePasswordReset")
+	defer span.End()
+
+	// Claim the token first so concurrent requests can't both use it
+	query := "UPDATE password_resets SET used_at = ? WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?"
+	now := time.Now()
+	result, err := conn(ctx).ExecContext(ctx, query, now, tokenHash, now)
+	if err != nil {
+		return 0, fmt.Errorf("error consuming password reset: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return 0, fmt.Errorf("password reset not found")
+	}
+
+	var userID int
+	err = conn(ctx).QueryRowContext(ctx, "SELECT user_id FROM password_resets WHERE token_hash = ?", tokenHash).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("password reset not found")
+		}
+		return 0, fmt.Errorf("error scanning password reset: %w", err)
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"context"
+	"crud-app/pkg/config"
+	"database/sql"
+	"expvar"
+	"fmt"
+	"log"
+	"time"
+)
+
+// poolMetrics publishes the stats of every connection pool under "db_pool" in /debug/vars
+var poolMetrics = expvar.NewMap("db_pool")
+
+// PoolStats is a snapshot of a connection pool, as served at /debug/vars
+type PoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`       // Queries that had to wait for a free connection
+	WaitDurationMS     int64 `json:"wait_duration_ms"` // Total time spent waiting
+	MaxIdleClosed      int64 `json:"max_idle_closed"`  // Closed because MaxIdleConns was reached
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+// configurePool applies cfg to db
+func configurePool(db *sql.DB, cfg config.PoolConfig) {
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+}
+
+// publishPoolStats serves db's stats at /debug/vars as db_pool.<name>
+func publishPoolStats(name string, db *sql.DB) {
+	poolMetrics.Set(name, expvar.Func(func() interface{} {
+		stats := db.Stats()
+		return PoolStats{
+			MaxOpenConnections: stats.MaxOpenConnections,
+			OpenConnections:    stats.OpenConnections,
+			InUse:              stats.InUse,
+			Idle:               stats.Idle,
+			WaitCount:          stats.WaitCount,
+			WaitDurationMS:     stats.WaitDuration.Milliseconds(),
+			MaxIdleClosed:      stats.MaxIdleClosed,
+			MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+			MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		}
+	}))
+}
+
+// MonitorPools checks the primary's and replicas' pool stats every interval
+// until ctx is cancelled, logging a warning for each pool that queries had to
+// wait on since the last check
+func MonitorPools(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	last := map[*sql.DB]sql.DBStats{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for name, db := range pools() {
+			stats := db.Stats()
+			if warning := saturationWarning(last[db], stats, interval); warning != "" {
+				log.Printf("Database pool %s saturated: %s", name, warning)
+			}
+			last[db] = stats
+		}
+	}
+}
+
+// pools returns the primary and replica pools by name
+func pools() map[string]*sql.DB {
+	all := map[string]*sql.DB{}
+	if DB != nil {
+		all["primary"] = DB
+	}
+	if replicas != nil {
+		for _, r := range replicas.replicas {
+			all["replica "+r.name] = r.db
+		}
+	}
+	return all
+}
+
+// saturationWarning describes how long queries waited for a connection
+// between prev and cur, or returns "" if none did
+func saturationWarning(prev, cur sql.DBStats, interval time.Duration) string {
+	waits := cur.WaitCount - prev.WaitCount
+	if waits <= 0 {
+		return ""
+	}
+
+	waited := cur.WaitDuration - prev.WaitDuration
+	return fmt.Sprintf("%d queries waited %v in total (%v on average) for a connection in the last %v; %d of %d connections in use. Consider raising MYSQL_MAX_OPEN_CONNS.",
+		waits, waited.Round(time.Millisecond), (waited / time.Duration(waits)).Round(time.Microsecond), interval, cur.InUse, cur.MaxOpenConnections)
+}
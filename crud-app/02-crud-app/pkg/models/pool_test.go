@@ -0,0 +1,24 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaturationWarning(t *testing.T) {
+	prev := sql.DBStats{MaxOpenConnections: 25, InUse: 3, WaitCount: 10, WaitDuration: time.Second}
+
+	if got := saturationWarning(prev, prev, time.Minute); got != "" {
+		t.Errorf("no new waits gave warning %q", got)
+	}
+
+	cur := sql.DBStats{MaxOpenConnections: 25, InUse: 25, WaitCount: 14, WaitDuration: 3 * time.Second}
+	got := saturationWarning(prev, cur, time.Minute)
+	for _, want := range []string{"4 queries waited 2s", "500ms on average", "25 of 25 connections in use"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("warning %q does not contain %q", got, want)
+		}
+	}
+}
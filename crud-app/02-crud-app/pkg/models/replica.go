@@ -0,0 +1,200 @@
+package models
+
+import (
+	"context"
+	"crud-app/pkg/config"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/XSAM/otelsql"
+	"github.com/go-sql-driver/mysql"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// replicas serve user reads when set; nil sends every read to the primary
+var replicas *replicaSet
+
+// replicaSet is a pool of read replicas. Reads go to healthy replicas in
+// turn, and a background check takes replicas that stop answering out of
+// rotation until they recover.
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// replica is one read replica
+type replica struct {
+	name    string // Host and port, for logs; the DSN holds credentials
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// InitReplicas opens a connection pool for each of cfg.ReplicaDSNs and sends
+// user reads to them, checking every cfg.ReplicaCheckInterval that they still
+// answer. Replicas that can't be reached at startup begin out of rotation
+// rather than failing it.
+func InitReplicas(cfg config.DatabaseConfig) error {
+	if len(cfg.ReplicaDSNs) == 0 {
+		return nil
+	}
+	interval := cfg.ReplicaCheckInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	set := &replicaSet{stop: make(chan struct{})}
+	for _, dsn := range cfg.ReplicaDSNs {
+		db, err := otelsql.Open("mysql", dsn, otelsql.WithAttributes(semconv.DBSystemMySQL))
+		if err != nil {
+			set.close()
+			return fmt.Errorf("error opening replica: %w", err)
+		}
+		configurePool(db, cfg.Pool)
+
+		r := &replica{name: dsnAddr(dsn), db: db}
+		publishPoolStats("replica "+r.name, db)
+		r.healthy.Store(true) // So the first check logs replicas that are down
+		set.replicas = append(set.replicas, r)
+	}
+	set.check()
+
+	set.stopped.Add(1)
+	go set.run(interval)
+
+	replicas = set
+	fmt.Printf("Sending user reads to %d replica(s)\n", len(set.replicas))
+	return nil
+}
+
+// readDB returns where to send a read: the transaction ctx is running in,
+// the next healthy replica, or the primary if ctx is pinned to it or no
+// replica is healthy
+func readDB(ctx context.Context) querier {
+	if state := txFromContext(ctx); state != nil {
+		return state.tx
+	}
+	if replicas == nil || primaryPinned(ctx) {
+		return DB
+	}
+	return replicas.pick(DB)
+}
+
+// pick returns the next healthy replica in turn, or fallback if none is
+func (s *replicaSet) pick(fallback *sql.DB) *sql.DB {
+	start := s.next.Add(1)
+	for i := range s.replicas {
+		r := s.replicas[(start+uint64(i))%uint64(len(s.replicas))]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+	return fallback
+}
+
+// run checks the replicas every interval until close is called
+func (s *replicaSet) run(interval time.Duration) {
+	defer s.stopped.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.check()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// check pings every replica, logging those that go down or come back
+func (s *replicaSet) check() {
+	for _, r := range s.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err := r.db.PingContext(ctx)
+		cancel()
+
+		healthy := err == nil
+		// Replicas that were down at startup prepare their statements once they answer
+		if healthy && !statements.prepared(r.db) {
+			statements.prepare(context.Background(), r.db)
+		}
+		if r.healthy.Swap(healthy) == healthy {
+			continue
+		}
+		if healthy {
+			log.Printf("Replica %s is back in rotation", r.name)
+		} else {
+			log.Printf("Replica %s taken out of rotation: %v", r.name, err)
+		}
+	}
+}
+
+// close stops the health checks and closes every replica
+func (s *replicaSet) close() error {
+	close(s.stop)
+	s.stopped.Wait()
+
+	var firstErr error
+	for _, r := range s.replicas {
+		statements.close(r.db)
+		if err := r.db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// dsnAddr returns the address in a DSN such as user:pass@tcp(host:3306)/db
+func dsnAddr(dsn string) string {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "replica"
+	}
+	return cfg.Addr
+}
+
+// primaryPin records whether a request has written, so its later reads go
+// to the primary
+type primaryPin struct {
+	pinned atomic.Bool
+}
+
+type primaryPinKey struct{}
+
+// ReadYourWrites returns a context whose reads go to the primary once a write
+// has been made with it, so a request that changes users sees its own changes
+// even if the replicas are behind
+func ReadYourWrites(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(primaryPinKey{}).(*primaryPin); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, primaryPinKey{}, &primaryPin{})
+}
+
+// UsePrimary returns a context whose reads all go to the primary
+func UsePrimary(ctx context.Context) context.Context {
+	pin := &primaryPin{}
+	pin.pinned.Store(true)
+	return context.WithValue(ctx, primaryPinKey{}, pin)
+}
+
+// pinPrimary sends ctx's later reads to the primary if it was created with ReadYourWrites
+func pinPrimary(ctx context.Context) {
+	if pin, ok := ctx.Value(primaryPinKey{}).(*primaryPin); ok {
+		pin.pinned.Store(true)
+	}
+}
+
+// primaryPinned reports whether ctx's reads must go to the primary
+func primaryPinned(ctx context.Context) bool {
+	pin, ok := ctx.Value(primaryPinKey{}).(*primaryPin)
+	return ok && pin.pinned.Load()
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+// testReplicas swaps in replicas backed by unopened pools, which is enough to
+// see which one a read is sent to
+func testReplicas(t *testing.T, n int) (*sql.DB, []*replica) {
+	t.Helper()
+	open := func() *sql.DB {
+		db, err := sql.Open("mysql", "user:pass@tcp(127.0.0.1:1)/db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+
+	primary, oldDB, oldReplicas := open(), DB, replicas
+	set := &replicaSet{}
+	for i := 0; i < n; i++ {
+		r := &replica{db: open()}
+		r.healthy.Store(true)
+		set.replicas = append(set.replicas, r)
+	}
+	DB, replicas = primary, set
+	t.Cleanup(func() { DB, replicas = oldDB, oldReplicas })
+	return primary, set.replicas
+}
+
+func TestReadDBRoundRobinsHealthyReplicas(t *testing.T) {
+	primary, rs := testReplicas(t, 3)
+	ctx := context.Background()
+
+	counts := map[querier]int{}
+	for i := 0; i < 6; i++ {
+		counts[readDB(ctx)]++
+	}
+	for i, r := range rs {
+		if counts[r.db] != 2 {
+			t.Errorf("replica %d got %d of 6 reads, want 2", i, counts[r.db])
+		}
+	}
+
+	rs[1].healthy.Store(false)
+	for i := 0; i < 6; i++ {
+		if readDB(ctx) == rs[1].db {
+			t.Fatal("read sent to an unhealthy replica")
+		}
+	}
+
+	rs[0].healthy.Store(false)
+	rs[2].healthy.Store(false)
+	if readDB(ctx) != primary {
+		t.Error("reads did not fall back to the primary with no healthy replicas")
+	}
+}
+
+func TestReadYourWritesPinsAfterWrite(t *testing.T) {
+	primary, _ := testReplicas(t, 2)
+
+	ctx := ReadYourWrites(context.Background())
+	if readDB(ctx) == primary {
+		t.Fatal("read went to the primary before any write")
+	}
+	pinPrimary(ctx)
+	if readDB(ctx) != primary {
+		t.Fatal("read after a write did not go to the primary")
+	}
+	if readDB(context.Background()) == primary {
+		t.Error("pin leaked to other contexts")
+	}
+
+	if readDB(UsePrimary(context.Background())) != primary {
+		t.Error("UsePrimary read did not go to the primary")
+	}
+	// Writes without a ReadYourWrites context pin nothing
+	pinPrimary(context.Background())
+	if readDB(context.Background()) == primary {
+		t.Error("write without ReadYourWrites pinned reads")
+	}
+}
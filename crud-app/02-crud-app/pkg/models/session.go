@@ -0,0 +1,80 @@
+package models
+
+import (
+	"context"
+	"crud-app/pkg/telemetry"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Session is a server-side login session. Only the hash of the session token is stored.
+type Session struct {
+	UserID    int
+	Email     string
+	Role      string
+	CSRFToken string
+	ExpiresAt time.Time
+}
+
+// CreateSession stores a new session for a user
+func CreateSession(ctx context.Context, tokenHash string, userID int, csrfToken string, expiresAt time.Time) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.CreateSession")
+	defer span.End()
+
+	query := "INSERT INTO sessions (token_hash, user_id, csrf_token, expires_at) VALUES (?, ?, ?, ?)"
+	_, err := conn(ctx).ExecContext(ctx, query, tokenHash, userID, csrfToken, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error creating session: %w", err)
+	}
+
+	return nil
+}
+
+// GetSessionByTokenHash retrieves an unexpired session along with its user's email and role
+func GetSessionByTokenHash(ctx context.Context, tokenHash string) (*Session, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.GetSessionByTokenHash")
+	defer span.End()
+
+	query := `SELECT s.user_id, u.email, u.role, s.csrf_token, s.expires_at
+		FROM sessions s JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = ? AND s.expires_at > ?`
+	row := conn(ctx).QueryRowContext(ctx, query, tokenHash, time.Now())
+
+	var session Session
+	err := row.Scan(&session.UserID, &session.Email, &session.Role, &session.CSRFToken, &session.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("session not found")
+		}
+		return nil, fmt.Errorf("error scanning session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// DeleteSession removes a single session, e.g. on logout
+func DeleteSession(ctx context.Context, tokenHash string) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.DeleteSession")
+	defer span.End()
+
+	query := "DELETE FROM sessions WHERE token_hash = ?"
+	if _, err := conn(ctx).ExecContext(ctx, query, tokenHash); err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteUserSessions removes every session of a user, e.g. after a password reset
+func DeleteUserSessions(ctx context.Context, userID int) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.DeleteUserSessions")
+	defer span.End()
+
+	query := "DELETE FROM sessions WHERE user_id = ?"
+	if _, err := conn(ctx).ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("error deleting sessions: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+)
+
+// hotQueries are prepared once per pool at startup instead of being sent as
+// SQL text with every call. A *sql.Stmt prepares itself again on whichever
+// connection runs it, so statements survive reconnects without any help.
+var hotQueries = []string{
+	queryAllUsers,
+	queryListUsers,
+	queryUserByID,
+	queryLastUserDeletion,
+}
+
+// statements holds the prepared hotQueries of each pool
+var statements = &stmtCache{byDB: map[*sql.DB]map[string]*sql.Stmt{}}
+
+// stmtCache maps a pool and query to its prepared statement
+type stmtCache struct {
+	mu   sync.RWMutex
+	byDB map[*sql.DB]map[string]*sql.Stmt
+}
+
+// prepare prepares hotQueries on db. Queries that fail to prepare, e.g.
+// because a migration hasn't run yet, are logged and sent as text instead.
+func (c *stmtCache) prepare(ctx context.Context, db *sql.DB) {
+	stmts := map[string]*sql.Stmt{}
+	for _, query := range hotQueries {
+		stmt, err := db.PrepareContext(ctx, query)
+		if err != nil {
+			log.Printf("Not preparing %q: %v", query, err)
+			continue
+		}
+		stmts[query] = stmt
+	}
+
+	c.mu.Lock()
+	c.byDB[db] = stmts
+	c.mu.Unlock()
+}
+
+// prepared reports whether prepare has been called for db
+func (c *stmtCache) prepared(db *sql.DB) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.byDB[db]
+	return ok
+}
+
+// get returns the statement prepared for query on db, or nil if there is none
+func (c *stmtCache) get(db *sql.DB, query string) *sql.Stmt {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.byDB[db][query]
+}
+
+// close closes db's statements; call it before closing db
+func (c *stmtCache) close(db *sql.DB) {
+	c.mu.Lock()
+	stmts := c.byDB[db]
+	delete(c.byDB, db)
+	c.mu.Unlock()
+
+	for _, stmt := range stmts {
+		stmt.Close()
+	}
+}
+
+// queryContext runs query on q, using a prepared statement if q is a pool
+// that has one. Queries in a transaction are sent as text.
+func queryContext(ctx context.Context, q querier, query string, args ...interface{}) (*sql.Rows, error) {
+	if db, ok := q.(*sql.DB); ok {
+		if stmt := statements.get(db, query); stmt != nil {
+			return stmt.QueryContext(ctx, args...)
+		}
+	}
+	return q.QueryContext(ctx, query, args...)
+}
+
+// queryRowContext runs query on q, using a prepared statement if q is a pool
+// that has one. Queries in a transaction are sent as text.
+func queryRowContext(ctx context.Context, q querier, query string, args ...interface{}) *sql.Row {
+	if db, ok := q.(*sql.DB); ok {
+		if stmt := statements.get(db, query); stmt != nil {
+			return stmt.QueryRowContext(ctx, args...)
+		}
+	}
+	return q.QueryRowContext(ctx, query, args...)
+}
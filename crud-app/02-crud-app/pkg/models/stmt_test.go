@@ -0,0 +1,111 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testStmtDB points DB at a recordingDriver with hotQueries prepared
+func testStmtDB(t testing.TB, failPrepare ...string) *recordingDriver {
+	t.Helper()
+	d := &recordingDriver{fail: map[string]error{}}
+	for _, query := range failPrepare {
+		d.fail["PREPARE "+query] = errors.New("Table 'test_db.outbox_events' doesn't exist")
+	}
+
+	db := sql.OpenDB(recordingConnector{d})
+	oldDB, oldReplicas, oldCache := DB, replicas, userCache
+	DB, replicas, userCache = db, nil, nil
+	statements.prepare(context.Background(), db)
+	t.Cleanup(func() {
+		statements.close(db)
+		db.Close()
+		DB, replicas, userCache = oldDB, oldReplicas, oldCache
+	})
+	return d
+}
+
+func TestHotQueriesUsePreparedStatements(t *testing.T) {
+	d := testStmtDB(t, queryLastUserDeletion)
+	ctx := context.Background()
+
+	GetUserByID(ctx, 1)
+	ListUsers(ctx, 0, 10)
+	GetAllUsers(ctx)
+	LastUserDeletion(ctx)
+
+	want := []string{
+		"PREPARE " + queryAllUsers,
+		"PREPARE " + queryListUsers,
+		"PREPARE " + queryUserByID,
+		"PREPARE " + queryLastUserDeletion,
+		"EXECUTE " + queryUserByID,
+		"EXECUTE " + queryListUsers,
+		"EXECUTE " + queryAllUsers,
+		// Failed to prepare, so it is sent as text
+		"QUERY " + queryLastUserDeletion,
+	}
+	if !reflect.DeepEqual(d.log, want) {
+		t.Errorf("statements = %q, want %q", d.log, want)
+	}
+}
+
+func TestHotQueriesInTransactionsAreSentAsText(t *testing.T) {
+	d := testStmtDB(t)
+	d.log = nil
+
+	err := WithTx(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		GetUserByID(ctx, 1)
+		ListUsers(ctx, 0, 10)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"BEGIN", "QUERY " + queryUserByID, "QUERY " + queryListUsers, "COMMIT"}
+	if !reflect.DeepEqual(d.log, want) {
+		t.Errorf("statements = %q, want %q", d.log, want)
+	}
+}
+
+func TestClosedPoolForgetsStatements(t *testing.T) {
+	testStmtDB(t)
+	db := DB
+	if !statements.prepared(db) || statements.get(db, queryUserByID) == nil {
+		t.Fatal("statements were not prepared")
+	}
+
+	statements.close(db)
+	if statements.prepared(db) || statements.get(db, queryUserByID) != nil {
+		t.Error("statements are still cached after close")
+	}
+}
+
+// BenchmarkUserByID compares a prepared GetUserByID with the same query sent
+// as text. It runs against recordingDriver, not MySQL, so it only measures
+// the client side cost in database/sql; the server's parse and plan time,
+// which preparing is meant to save, isn't included.
+func BenchmarkUserByID(b *testing.B) {
+	for _, bm := range []struct {
+		name    string
+		prepare bool
+	}{{"prepared", true}, {"text", false}} {
+		b.Run(bm.name, func(b *testing.B) {
+			d := testStmtDB(b)
+			d.discard = true
+			if !bm.prepare {
+				statements.close(DB)
+			}
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				getUserByID(ctx, 1)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// maxTxAttempts is how many times WithTx runs a transaction that keeps
+// failing with a deadlock or lock wait timeout
+const maxTxAttempts = 3
+
+// querier is implemented by both *sql.DB and *sql.Tx, so models functions can
+// run inside or outside a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// txState is the transaction a context is running in
+type txState struct {
+	tx          *sql.Tx
+	savepoints  int      // Savepoints opened so far, used to name the next one
+	afterCommit []func() // Run once the outermost transaction commits
+}
+
+type txKey struct{}
+
+// WithTx runs fn in a transaction, committing if it returns nil and rolling
+// back otherwise. fn's error is returned unchanged.
+//
+// Models functions called with the ctx passed to fn join the transaction, so
+// several of them can be made atomic. Calling WithTx inside fn opens a
+// savepoint instead of a new transaction: if the inner fn fails, only its
+// changes are rolled back and the outer fn can carry on.
+//
+// If the transaction hits a deadlock or lock wait timeout, the whole of fn
+// is run again, up to maxTxAttempts times, so fn shouldn't have side effects
+// outside the database. Once it has committed, reads made with a
+// ReadYourWrites context go to the primary.
+func WithTx(ctx context.Context, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	if state := txFromContext(ctx); state != nil {
+		return withSavepoint(ctx, state, fn)
+	}
+
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = runTx(ctx, fn)
+		if err == nil || !isRetryable(err) || attempt == maxTxAttempts {
+			break
+		}
+
+		backoff := time.Duration(attempt) * (10*time.Millisecond + time.Duration(rand.Int63n(int64(10*time.Millisecond))))
+		log.Printf("Retrying transaction in %v after attempt %d failed: %v", backoff, attempt, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+	}
+	return err
+}
+
+// runTx runs fn in a new transaction once
+func runTx(ctx context.Context, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	state := &txState{tx: tx}
+	if err := fn(context.WithValue(ctx, txKey{}, state), tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	pinPrimary(ctx)
+	for _, f := range state.afterCommit {
+		f()
+	}
+	return nil
+}
+
+// withSavepoint runs fn inside a savepoint of the transaction in state
+func withSavepoint(ctx context.Context, state *txState, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	state.savepoints++
+	name := fmt.Sprintf("sp_%d", state.savepoints)
+	if _, err := state.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("error creating savepoint: %w", err)
+	}
+
+	hooks := len(state.afterCommit)
+	if err := fn(ctx, state.tx); err != nil {
+		state.afterCommit = state.afterCommit[:hooks]
+		// A deadlock has already rolled back the whole transaction, which the
+		// outermost WithTx will retry. A lock wait timeout only rolls back the
+		// statement that timed out, so the savepoint is still there to undo
+		// the rest of fn.
+		if !isDeadlock(err) {
+			if _, rbErr := state.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rbErr != nil {
+				return fmt.Errorf("error rolling back to savepoint: %w", rbErr)
+			}
+		}
+		return err
+	}
+
+	if _, err := state.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("error releasing savepoint: %w", err)
+	}
+	return nil
+}
+
+// txFromContext returns the transaction ctx is running in, or nil
+func txFromContext(ctx context.Context) *txState {
+	state, _ := ctx.Value(txKey{}).(*txState)
+	return state
+}
+
+// conn returns the transaction ctx is running in, or the primary database
+func conn(ctx context.Context) querier {
+	if state := txFromContext(ctx); state != nil {
+		return state.tx
+	}
+	return DB
+}
+
+// afterCommit runs f once the transaction ctx is running in commits, or
+// straight away if it isn't running in one. f isn't run if the transaction,
+// or the savepoint it was added in, rolls back.
+func afterCommit(ctx context.Context, f func()) {
+	if state := txFromContext(ctx); state != nil {
+		state.afterCommit = append(state.afterCommit, f)
+		return
+	}
+	f()
+}
+
+// isRetryable reports whether err is a deadlock (1213) or lock wait timeout
+// (1205), after which the transaction can be run again
+func isRetryable(err error) bool {
+	return hasErrorNumber(err, 1213, 1205)
+}
+
+// isDeadlock reports whether err is a deadlock, which rolls back the whole
+// transaction
+func isDeadlock(err error) bool {
+	return hasErrorNumber(err, 1213)
+}
+
+// hasErrorNumber reports whether err is, or wraps, a MySQL error with one of
+// numbers. Models functions wrap driver errors with %w so it can be found.
+func hasErrorNumber(err error, numbers ...uint16) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && slices.Contains(numbers, mysqlErr.Number)
+}
@@ -0,0 +1,258 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// recordingDriver logs the statements run through it. Statements in fail
+// return their error once. Queries return no rows; they are logged as
+// "QUERY <sql>" when sent as text, and as "PREPARE <sql>" followed by
+// "EXECUTE <sql>" when prepared.
+type recordingDriver struct {
+	mu      sync.Mutex
+	log     []string
+	fail    map[string]error
+	discard bool // Don't keep the log, for benchmarks
+}
+
+func (d *recordingDriver) record(query string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.discard {
+		return nil
+	}
+	d.log = append(d.log, query)
+	if err, ok := d.fail[query]; ok {
+		delete(d.fail, query)
+		return err
+	}
+	return nil
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) { return recordingConn{d}, nil }
+
+type recordingConn struct{ d *recordingDriver }
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	if err := c.d.record("PREPARE " + query); err != nil {
+		return nil, err
+	}
+	return recordingStmt{c.d, query}, nil
+}
+func (c recordingConn) Close() error { return nil }
+func (c recordingConn) Begin() (driver.Tx, error) {
+	return recordingTx{c.d}, c.d.record("BEGIN")
+}
+func (c recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), c.d.record(query)
+}
+
+func (c recordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return noRows{}, c.d.record("QUERY " + query)
+}
+
+type recordingStmt struct {
+	d     *recordingDriver
+	query string
+}
+
+func (s recordingStmt) Close() error  { return nil }
+func (s recordingStmt) NumInput() int { return -1 }
+func (s recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), s.d.record("EXECUTE " + s.query)
+}
+func (s recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return noRows{}, s.d.record("EXECUTE " + s.query)
+}
+
+type noRows struct{}
+
+func (noRows) Columns() []string              { return nil }
+func (noRows) Close() error                   { return nil }
+func (noRows) Next(dest []driver.Value) error { return io.EOF }
+
+type recordingTx struct{ d *recordingDriver }
+
+func (t recordingTx) Commit() error   { return t.d.record("COMMIT") }
+func (t recordingTx) Rollback() error { return t.d.record("ROLLBACK") }
+
+// testTxDB points DB at a recordingDriver
+func testTxDB(t *testing.T) *recordingDriver {
+	t.Helper()
+	d := &recordingDriver{fail: map[string]error{}}
+
+	db := sql.OpenDB(recordingConnector{d})
+	oldDB := DB
+	DB = db
+	t.Cleanup(func() {
+		DB = oldDB
+		db.Close()
+	})
+	return d
+}
+
+type recordingConnector struct{ d *recordingDriver }
+
+func (c recordingConnector) Connect(context.Context) (driver.Conn, error) {
+	return recordingConn{c.d}, nil
+}
+func (c recordingConnector) Driver() driver.Driver { return c.d }
+
+func TestWithTxSavepoints(t *testing.T) {
+	d := testTxDB(t)
+	ctx := context.Background()
+	innerErr := errors.New("inner failed")
+
+	var committed []string
+	err := WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		conn(ctx).ExecContext(ctx, "INSERT a")
+		afterCommit(ctx, func() { committed = append(committed, "a") })
+
+		if err := WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+			conn(ctx).ExecContext(ctx, "INSERT b")
+			afterCommit(ctx, func() { committed = append(committed, "b") })
+			return innerErr
+		}); err != innerErr {
+			t.Errorf("inner WithTx error = %v, want %v", err, innerErr)
+		}
+
+		return WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+			_, err := conn(ctx).ExecContext(ctx, "INSERT c")
+			afterCommit(ctx, func() { committed = append(committed, "c") })
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"BEGIN", "INSERT a",
+		"SAVEPOINT sp_1", "INSERT b", "ROLLBACK TO SAVEPOINT sp_1",
+		"SAVEPOINT sp_2", "INSERT c", "RELEASE SAVEPOINT sp_2",
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(d.log, want) {
+		t.Errorf("statements = %q, want %q", d.log, want)
+	}
+	if !reflect.DeepEqual(committed, []string{"a", "c"}) {
+		t.Errorf("after commit ran %q, want [a c]", committed)
+	}
+}
+
+func TestWithTxRetriesDeadlocks(t *testing.T) {
+	d := testTxDB(t)
+	ctx := context.Background()
+	d.fail["UPDATE a"] = &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+
+	attempts := 0
+	err := WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		attempts++
+		// Wrapped with %w like the rest of the models package
+		if _, err := tx.ExecContext(ctx, "UPDATE a"); err != nil {
+			return fmt.Errorf("error updating: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("ran %d times, want 2", attempts)
+	}
+	want := []string{"BEGIN", "UPDATE a", "ROLLBACK", "BEGIN", "UPDATE a", "COMMIT"}
+	if !reflect.DeepEqual(d.log, want) {
+		t.Errorf("statements = %q, want %q", d.log, want)
+	}
+}
+
+func TestWithTxSavepointAfterLockWaitTimeout(t *testing.T) {
+	d := testTxDB(t)
+	ctx := context.Background()
+	d.fail["UPDATE b"] = &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded; try restarting transaction"}
+	deadlock := fmt.Errorf("error updating: %w", &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"})
+
+	attempts := 0
+	err := WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		attempts++
+		conn(ctx).ExecContext(ctx, "INSERT a")
+
+		// The timeout only undid UPDATE b, so the savepoint is rolled back to
+		// undo INSERT c too
+		timeoutErr := WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+			conn(ctx).ExecContext(ctx, "INSERT c")
+			if _, err := conn(ctx).ExecContext(ctx, "UPDATE b"); err != nil {
+				return fmt.Errorf("error updating: %w", err)
+			}
+			return nil
+		})
+		if attempts == 1 && (timeoutErr == nil || !isRetryable(timeoutErr)) {
+			t.Errorf("inner WithTx error = %v, want the lock wait timeout", timeoutErr)
+		}
+
+		// A deadlock has already rolled back everything, savepoints included
+		if attempts == 1 {
+			return WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error { return deadlock })
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"BEGIN", "INSERT a",
+		"SAVEPOINT sp_1", "INSERT c", "UPDATE b", "ROLLBACK TO SAVEPOINT sp_1",
+		"SAVEPOINT sp_2",
+		"ROLLBACK",
+		"BEGIN", "INSERT a",
+		"SAVEPOINT sp_1", "INSERT c", "UPDATE b", "RELEASE SAVEPOINT sp_1",
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(d.log, want) {
+		t.Errorf("statements = %q, want %q", d.log, want)
+	}
+}
+
+func TestWithTxDoesNotRetryOtherErrors(t *testing.T) {
+	testTxDB(t)
+	failed := errors.New("user not found")
+
+	attempts := 0
+	err := WithTx(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		attempts++
+		return failed
+	})
+	if err != failed || attempts != 1 {
+		t.Errorf("got %v after %d attempts, want %v after 1", err, attempts, failed)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&mysql.MySQLError{Number: 1213}, true},
+		{fmt.Errorf("error updating user: %w", &mysql.MySQLError{Number: 1205}), true},
+		// %v drops the driver error, so its number can't be checked
+		{fmt.Errorf("error updating user: %v", &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}), false},
+		{&mysql.MySQLError{Number: 1062}, false},
+		{errors.New("user not found"), false},
+	}
+	for _, tt := range tests {
+		if got := isRetryable(tt.err); got != tt.want {
+			t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
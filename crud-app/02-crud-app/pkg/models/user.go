@@ -1,8 +1,13 @@
 package models
 
 import (
+	"context"
+	"crud-app/pkg/telemetry"
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // User represents a user entity
@@ -11,23 +16,44 @@ type User struct {
 	Name    string `json:"name"`
 	Address string `json:"address"`
 	Country string `json:"country"`
+
+	// UpdatedAt is when the row last changed. It backs HTTP caching headers
+	// rather than being part of the user's representation.
+	UpdatedAt time.Time `json:"-"`
+}
+
+// UserPatch holds a partial update; nil fields are left unchanged
+type UserPatch struct {
+	Name    *string `json:"name"`
+	Address *string `json:"address"`
+	Country *string `json:"country"`
 }
 
-// GetAllUsers retrieves all users from database
-func GetAllUsers() ([]User, error) {
-	query := "SELECT id, name, address, country FROM users"
-	rows, err := DB.Query(query)
+// Queries run on every user read, which are prepared at startup
+const (
+	queryAllUsers         = "SELECT id, name, address, country, updated_at FROM users"
+	queryListUsers        = "SELECT id, name, address, country, updated_at FROM users WHERE id > ? ORDER BY id LIMIT ?"
+	queryUserByID         = "SELECT id, name, address, country, updated_at FROM users WHERE id = ?"
+	queryLastUserDeletion = "SELECT MAX(created_at) FROM outbox_events WHERE event_type = ?"
+)
+
+// GetAllUsers retrieves all users from database, or from a replica if any are set
+func GetAllUsers(ctx context.Context) ([]User, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.GetAllUsers")
+	defer span.End()
+
+	rows, err := queryContext(ctx, readDB(ctx), queryAllUsers)
 	if err != nil {
-		return nil, fmt.Errorf("error querying users: %v", err)
+		return nil, fmt.Errorf("error querying users: %w", err)
 	}
 	defer rows.Close()
 
 	var users []User
 	for rows.Next() {
 		var user User
-		err := rows.Scan(&user.ID, &user.Name, &user.Address, &user.Country)
+		err := rows.Scan(&user.ID, &user.Name, &user.Address, &user.Country, &user.UpdatedAt)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning user: %v", err)
+			return nil, fmt.Errorf("error scanning user: %w", err)
 		}
 		users = append(users, user)
 	}
@@ -35,75 +61,333 @@ func GetAllUsers() ([]User, error) {
 	return users, nil
 }
 
-// GetUserByID retrieves a user by ID
-func GetUserByID(id int) (*User, error) {
-	query := "SELECT id, name, address, country FROM users WHERE id = ?"
-	row := DB.QueryRow(query, id)
+// ListUsers retrieves up to limit users with an ID greater than afterID, ordered by ID
+func ListUsers(ctx context.Context, afterID, limit int) ([]User, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.ListUsers")
+	defer span.End()
+
+	rows, err := queryContext(ctx, readDB(ctx), queryListUsers, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&user.ID, &user.Name, &user.Address, &user.Country, &user.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// EachUser calls fn for every user in ID order, reading rows from the
+// database as fn consumes them instead of loading them all into memory.
+// It stops at and returns fn's first error.
+func EachUser(ctx context.Context, fn func(User) error) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.EachUser")
+	defer span.End()
+
+	query := "SELECT id, name, address, country, updated_at FROM users ORDER BY id"
+	rows, err := readDB(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("error querying users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&user.ID, &user.Name, &user.Address, &user.Country, &user.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("error scanning user: %w", err)
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading users: %w", err)
+	}
+	return nil
+}
+
+// UserFilter narrows a user listing. Empty fields match every user.
+type UserFilter struct {
+	Country      string
+	NameContains string
+}
+
+// FindUsers retrieves up to limit users matching filter with an ID greater
+// than afterID, ordered by ID
+func FindUsers(ctx context.Context, filter UserFilter, afterID, limit int) ([]User, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.FindUsers")
+	defer span.End()
+
+	query := "SELECT id, name, address, country, updated_at FROM users WHERE id > ?"
+	args := []interface{}{afterID}
+	if filter.Country != "" {
+		query += " AND country = ?"
+		args = append(args, filter.Country)
+	}
+	if filter.NameContains != "" {
+		query += " AND name LIKE ?"
+		args = append(args, "%"+escapeLike(filter.NameContains)+"%")
+	}
+	query += " ORDER BY id LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := readDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&user.ID, &user.Name, &user.Address, &user.Country, &user.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// GetUserByID retrieves a user by ID, from the user cache if one is set.
+// Inside a transaction it reads the database, which may hold uncommitted changes.
+func GetUserByID(ctx context.Context, id int) (*User, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.GetUserByID")
+	defer span.End()
+
+	if userCache != nil && txFromContext(ctx) == nil {
+		return getCachedUser(ctx, id)
+	}
+	return getUserByID(ctx, id)
+}
+
+// getUserByID reads a user from a replica, or the primary if ctx is pinned to it
+func getUserByID(ctx context.Context, id int) (*User, error) {
+	row := queryRowContext(ctx, readDB(ctx), queryUserByID, id)
 
 	var user User
-	err := row.Scan(&user.ID, &user.Name, &user.Address, &user.Country)
+	err := row.Scan(&user.ID, &user.Name, &user.Address, &user.Country, &user.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("user not found")
 		}
-		return nil, fmt.Errorf("error scanning user: %v", err)
+		return nil, fmt.Errorf("error scanning user: %w", err)
 	}
 
 	return &user, nil
 }
 
-// CreateUser creates a new user
-func CreateUser(user User) (int, error) {
-	query := "INSERT INTO users (name, address, country) VALUES (?, ?, ?)"
-	result, err := DB.Exec(query, user.Name, user.Address, user.Country)
-	if err != nil {
-		return 0, fmt.Errorf("error creating user: %v", err)
-	}
+// CreateUser creates a new user and records a user.created event
+func CreateUser(ctx context.Context, user User) (int, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.CreateUser")
+	defer span.End()
+
+	var id int
+	err := WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		query := "INSERT INTO users (name, address, country) VALUES (?, ?, ?)"
+		result, err := tx.ExecContext(ctx, query, user.Name, user.Address, user.Country)
+		if err != nil {
+			return fmt.Errorf("error creating user: %w", err)
+		}
+
+		lastID, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("error getting last insert id: %w", err)
+		}
+		id = int(lastID)
 
-	id, err := result.LastInsertId()
+		user.ID = strconv.Itoa(id)
+		return insertOutboxEvent(ctx, tx, EventUserCreated, user)
+	})
 	if err != nil {
-		return 0, fmt.Errorf("error getting last insert id: %v", err)
+		return 0, err
 	}
 
-	return int(id), nil
+	return id, nil
 }
 
-// UpdateUser updates an existing user
-func UpdateUser(id int, user User) error {
-	query := "UPDATE users SET name = ?, address = ?, country = ? WHERE id = ?"
-	result, err := DB.Exec(query, user.Name, user.Address, user.Country, id)
+// CreateUsers creates users in a single transaction, recording a
+// user.created event for each, and returns their IDs. Either every user is
+// created or none are.
+func CreateUsers(ctx context.Context, users []User) ([]int, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.CreateUsers")
+	defer span.End()
+
+	ids := make([]int, 0, len(users))
+	err := WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, "INSERT INTO users (name, address, country) VALUES (?, ?, ?)")
+		if err != nil {
+			return fmt.Errorf("error preparing insert: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, user := range users {
+			result, err := stmt.ExecContext(ctx, user.Name, user.Address, user.Country)
+			if err != nil {
+				return fmt.Errorf("error creating user: %w", err)
+			}
+
+			lastID, err := result.LastInsertId()
+			if err != nil {
+				return fmt.Errorf("error getting last insert id: %w", err)
+			}
+			ids = append(ids, int(lastID))
+
+			user.ID = strconv.Itoa(int(lastID))
+			if err := insertOutboxEvent(ctx, tx, EventUserCreated, user); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("error updating user: %v", err)
+		return nil, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return ids, nil
+}
+
+// UpdateUser updates an existing user and records a user.updated event
+func UpdateUser(ctx context.Context, id int, user User) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.UpdateUser")
+	defer span.End()
+
+	err := WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		query := "UPDATE users SET name = ?, address = ?, country = ? WHERE id = ?"
+		result, err := tx.ExecContext(ctx, query, user.Name, user.Address, user.Country, id)
+		if err != nil {
+			return fmt.Errorf("error updating user: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error getting rows affected: %w", err)
+		}
+
+		if rowsAffected == 0 {
+			return fmt.Errorf("user not found")
+		}
+
+		user.ID = strconv.Itoa(id)
+		return insertOutboxEvent(ctx, tx, EventUserUpdated, user)
+	})
 	if err != nil {
-		return fmt.Errorf("error getting rows affected: %v", err)
+		return err
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("user not found")
+	invalidateCachedUser(ctx, id)
+	return nil
+}
+
+// PatchUser updates only the fields of an existing user that are set in patch,
+// and records a user.updated event
+func PatchUser(ctx context.Context, id int, patch UserPatch) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.PatchUser")
+	defer span.End()
+
+	err := WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		// COALESCE keeps the current value for fields that are nil in the patch
+		query := "UPDATE users SET name = COALESCE(?, name), address = COALESCE(?, address), country = COALESCE(?, country) WHERE id = ?"
+		result, err := tx.ExecContext(ctx, query, patch.Name, patch.Address, patch.Country, id)
+		if err != nil {
+			return fmt.Errorf("error patching user: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error getting rows affected: %w", err)
+		}
+
+		if rowsAffected == 0 {
+			return fmt.Errorf("user not found")
+		}
+
+		// The event carries the full user, so read back the merged row
+		user, err := getUserForUpdate(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return insertOutboxEvent(ctx, tx, EventUserUpdated, *user)
+	})
+	if err != nil {
+		return err
 	}
 
+	invalidateCachedUser(ctx, id)
 	return nil
 }
 
-// DeleteUser deletes a user by ID
-func DeleteUser(id int) error {
-	query := "DELETE FROM users WHERE id = ?"
-	result, err := DB.Exec(query, id)
+// DeleteUser deletes a user by ID and records a user.deleted event
+func DeleteUser(ctx context.Context, id int) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.DeleteUser")
+	defer span.End()
+
+	err := WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		// The event carries the user as it was before deletion
+		user, err := getUserForUpdate(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		query := "DELETE FROM users WHERE id = ?"
+		_, err = tx.ExecContext(ctx, query, id)
+		if err != nil {
+			return fmt.Errorf("error deleting user: %w", err)
+		}
+
+		return insertOutboxEvent(ctx, tx, EventUserDeleted, *user)
+	})
 	if err != nil {
-		return fmt.Errorf("error deleting user: %v", err)
+		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	invalidateCachedUser(ctx, id)
+	return nil
+}
+
+// getUserForUpdate reads and locks a user row inside tx
+func getUserForUpdate(ctx context.Context, tx *sql.Tx, id int) (*User, error) {
+	query := "SELECT id, name, address, country, updated_at FROM users WHERE id = ? FOR UPDATE"
+	row := tx.QueryRowContext(ctx, query, id)
+
+	var user User
+	err := row.Scan(&user.ID, &user.Name, &user.Address, &user.Country, &user.UpdatedAt)
 	if err != nil {
-		return fmt.Errorf("error getting rows affected: %v", err)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("error scanning user: %w", err)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("user not found")
-	}
+	return &user, nil
+}
 
-	return nil
+// LastUserDeletion returns when a user was last deleted, or the zero time if
+// none has been. Deleting a user doesn't touch any remaining row, so listings
+// combine this with the rows' updated_at to tell when they last changed.
+func LastUserDeletion(ctx context.Context) (time.Time, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.LastUserDeletion")
+	defer span.End()
+
+	var last sql.NullTime
+	if err := queryRowContext(ctx, readDB(ctx), queryLastUserDeletion, EventUserDeleted).Scan(&last); err != nil {
+		return time.Time{}, fmt.Errorf("error querying user deletions: %w", err)
+	}
+	return last.Time, nil
 }
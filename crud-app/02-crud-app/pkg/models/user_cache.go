@@ -0,0 +1,70 @@
+package models
+
+import (
+	"context"
+	"crud-app/pkg/cache"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// userCache serves GetUserByID lookups when set; nil disables caching
+var userCache *cache.ReadThrough
+
+// SetUserCache puts store in front of GetUserByID, keeping users for ttl.
+// Updates and deletes invalidate the cached user. A nil store disables caching.
+func SetUserCache(store cache.Store, ttl time.Duration) {
+	if store == nil {
+		userCache = nil
+		return
+	}
+	userCache = cache.NewReadThrough("users", store, ttl)
+}
+
+// cachedUser is how a user is stored in the cache. UpdatedAt is kept out of
+// the user's JSON, so it is added here.
+type cachedUser struct {
+	User
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// userCacheKey is the cache key for the user with id
+func userCacheKey(id int) string {
+	return "users:" + strconv.Itoa(id)
+}
+
+// getCachedUser returns the user with id from the cache, loading it with
+// getUserByID on a miss. Misses read from the primary: a replica that is
+// behind could return the row from before an invalidating write, and it
+// would then be cached for the whole TTL.
+func getCachedUser(ctx context.Context, id int) (*User, error) {
+	data, err := userCache.Get(ctx, userCacheKey(id), func(ctx context.Context) ([]byte, error) {
+		user, err := getUserByID(UsePrimary(ctx), id)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(cachedUser{User: *user, UpdatedAt: user.UpdatedAt})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var cached cachedUser
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, err
+	}
+	cached.User.UpdatedAt = cached.UpdatedAt
+	return &cached.User, nil
+}
+
+// invalidateCachedUser drops the user with id from the cache after it
+// changes. Inside a transaction that waits for the commit, so the user isn't
+// loaded again before the change is visible.
+func invalidateCachedUser(ctx context.Context, id int) {
+	if userCache == nil {
+		return
+	}
+	afterCommit(ctx, func() {
+		userCache.Invalidate(context.WithoutCancel(ctx), userCacheKey(id))
+	})
+}
@@ -0,0 +1,374 @@
+package models
+
+import (
+	"context"
+	"crud-app/pkg/telemetry"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is a URL subscribed to user change events
+type Webhook struct {
+	ID                  int        `json:"id"`
+	URL                 string     `json:"url"`
+	Events              []string   `json:"events"`
+	Active              bool       `json:"active"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	Secret              string     `json:"-"` // HMAC key for signing payloads; only shown on creation
+}
+
+// WebhookDelivery is one event sent, or waiting to be sent, to one webhook
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	EventID        int64           `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"` // DeliveryPending, DeliveryDelivered or DeliveryFailed
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"` // Only set while pending
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// DueWebhookDelivery is a claimed delivery along with where to send it
+type DueWebhookDelivery struct {
+	WebhookDelivery
+	URL    string
+	Secret string
+}
+
+const webhookColumns = "id, url, secret, events, active, consecutive_failures, disabled_at, created_at"
+
+// scanWebhook scans a row selected with webhookColumns
+func scanWebhook(row interface{ Scan(...interface{}) error }) (*Webhook, error) {
+	var webhook Webhook
+	var events string
+	err := row.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, &events, &webhook.Active,
+		&webhook.ConsecutiveFailures, &webhook.DisabledAt, &webhook.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Events = strings.Split(events, ",")
+	return &webhook, nil
+}
+
+// CreateWebhook subscribes url to the given event types
+func CreateWebhook(ctx context.Context, url, secret string, events []string) (*Webhook, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.CreateWebhook")
+	defer span.End()
+
+	query := "INSERT INTO webhooks (url, secret, events) VALUES (?, ?, ?)"
+	result, err := conn(ctx).ExecContext(ctx, query, url, secret, strings.Join(events, ","))
+	if err != nil {
+		return nil, fmt.Errorf("error creating webhook: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error getting last insert id: %w", err)
+	}
+
+	return &Webhook{ID: int(id), URL: url, Secret: secret, Events: events, Active: true, CreatedAt: time.Now()}, nil
+}
+
+// GetAllWebhooks retrieves every webhook
+func GetAllWebhooks(ctx context.Context) ([]Webhook, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.GetAllWebhooks")
+	defer span.End()
+
+	rows, err := conn(ctx).QueryContext(ctx, "SELECT "+webhookColumns+" FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("error querying webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook: %w", err)
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// GetWebhookByID retrieves a webhook by ID
+func GetWebhookByID(ctx context.Context, id int) (*Webhook, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.GetWebhookByID")
+	defer span.End()
+
+	row := conn(ctx).QueryRowContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", id)
+	webhook, err := scanWebhook(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("webhook not found")
+		}
+		return nil, fmt.Errorf("error scanning webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+// DeleteWebhook removes a webhook along with its delivery log
+func DeleteWebhook(ctx context.Context, id int) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.DeleteWebhook")
+	defer span.End()
+
+	result, err := conn(ctx).ExecContext(ctx, "DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("webhook not found")
+	}
+
+	return nil
+}
+
+// EnableWebhook re-activates a disabled webhook and resets its failure count.
+// Deliveries still pending resume on the next poll.
+func EnableWebhook(ctx context.Context, id int) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.EnableWebhook")
+	defer span.End()
+
+	query := "UPDATE webhooks SET active = 1, consecutive_failures = 0, disabled_at = NULL WHERE id = ?"
+	result, err := conn(ctx).ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("error enabling webhook: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("webhook not found")
+	}
+
+	return nil
+}
+
+// EnqueueWebhookDeliveries queues an event for every active webhook subscribed
+// to its type. Queuing the same event twice is a no-op.
+func EnqueueWebhookDeliveries(ctx context.Context, eventID int64, eventType string, payload []byte) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.EnqueueWebhookDeliveries")
+	defer span.End()
+
+	webhooks, err := GetAllWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Active || !slices.Contains(webhook.Events, eventType) {
+			continue
+		}
+
+		// INSERT IGNORE skips deliveries already queued by an earlier attempt
+		query := "INSERT IGNORE INTO webhook_deliveries (webhook_id, event_id, event_type, payload) VALUES (?, ?, ?, ?)"
+		_, err := conn(ctx).ExecContext(ctx, query, webhook.ID, eventID, eventType, payload)
+		if err != nil {
+			return fmt.Errorf("error queuing webhook delivery: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries to active
+// webhooks that are due, and hides them from other workers for lease
+func ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]DueWebhookDelivery, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.ClaimWebhookDeliveries")
+	defer span.End()
+
+	var deliveries []DueWebhookDelivery
+	err := WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		query := `SELECT d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.attempts, d.created_at, w.url, w.secret
+			FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.status = ? AND d.next_attempt_at <= ? AND w.active = 1
+			ORDER BY d.id LIMIT ? FOR UPDATE OF d SKIP LOCKED`
+		rows, err := tx.QueryContext(ctx, query, DeliveryPending, time.Now(), limit)
+		if err != nil {
+			return fmt.Errorf("error querying webhook deliveries: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var d DueWebhookDelivery
+			err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Attempts, &d.CreatedAt, &d.URL, &d.Secret)
+			if err != nil {
+				return fmt.Errorf("error scanning webhook delivery: %w", err)
+			}
+			d.Status = DeliveryPending
+			d.Attempts++
+			deliveries = append(deliveries, d)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error querying webhook deliveries: %w", err)
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		args := make([]interface{}, 0, len(deliveries)+1)
+		args = append(args, time.Now().Add(lease))
+		for _, d := range deliveries {
+			args = append(args, d.ID)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(deliveries)), ", ")
+		query = "UPDATE webhook_deliveries SET next_attempt_at = ?, attempts = attempts + 1 WHERE id IN (" + placeholders + ")"
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("error claiming webhook deliveries: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RenewWebhookDeliveryLease hides a claimed delivery from other workers for
+// another lease, counted from now. It returns false if the delivery's earlier
+// lease ran out and another worker has claimed it since.
+func RenewWebhookDeliveryLease(ctx context.Context, d DueWebhookDelivery, lease time.Duration) (bool, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.RenewWebhookDeliveryLease")
+	defer span.End()
+
+	// Another claim would have counted another attempt
+	query := "UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id = ? AND status = ? AND attempts = ?"
+	result, err := conn(ctx).ExecContext(ctx, query, time.Now().Add(lease), d.ID, DeliveryPending, d.Attempts)
+	if err != nil {
+		return false, fmt.Errorf("error renewing webhook delivery lease: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// MarkWebhookDeliveryDelivered records a successful delivery and resets the
+// webhook's failure count
+func MarkWebhookDeliveryDelivered(ctx context.Context, d DueWebhookDelivery, statusCode int) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.MarkWebhookDeliveryDelivered")
+	defer span.End()
+
+	return WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		query := "UPDATE webhook_deliveries SET status = ?, last_status_code = ?, last_error = NULL, delivered_at = ? WHERE id = ?"
+		if _, err := tx.ExecContext(ctx, query, DeliveryDelivered, statusCode, time.Now(), d.ID); err != nil {
+			return fmt.Errorf("error updating webhook delivery: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE webhooks SET consecutive_failures = 0 WHERE id = ?", d.WebhookID); err != nil {
+			return fmt.Errorf("error updating webhook: %w", err)
+		}
+		return nil
+	})
+}
+
+// MarkWebhookDeliveryFailed records a failed attempt. The delivery is retried
+// at nextAttemptAt, or given up on if nextAttemptAt is nil. statusCode is 0
+// if no response was received. The webhook is disabled once it reaches
+// disableAfter consecutive failures, and disabled reports whether this
+// failure was the one that disabled it.
+func MarkWebhookDeliveryFailed(ctx context.Context, d DueWebhookDelivery, statusCode int, lastErr string, nextAttemptAt *time.Time, disableAfter int) (disabled bool, err error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.MarkWebhookDeliveryFailed")
+	defer span.End()
+
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+
+	err = WithTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if nextAttemptAt != nil {
+			query := "UPDATE webhook_deliveries SET last_status_code = ?, last_error = ?, next_attempt_at = ? WHERE id = ?"
+			_, err = tx.ExecContext(ctx, query, code, lastErr, *nextAttemptAt, d.ID)
+		} else {
+			query := "UPDATE webhook_deliveries SET status = ?, last_status_code = ?, last_error = ? WHERE id = ?"
+			_, err = tx.ExecContext(ctx, query, DeliveryFailed, code, lastErr, d.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("error updating webhook delivery: %w", err)
+		}
+
+		query := "UPDATE webhooks SET consecutive_failures = consecutive_failures + 1 WHERE id = ?"
+		if _, err := tx.ExecContext(ctx, query, d.WebhookID); err != nil {
+			return fmt.Errorf("error updating webhook: %w", err)
+		}
+
+		query = "UPDATE webhooks SET active = 0, disabled_at = ? WHERE id = ? AND active = 1 AND consecutive_failures >= ?"
+		result, err := tx.ExecContext(ctx, query, time.Now(), d.WebhookID, disableAfter)
+		if err != nil {
+			return fmt.Errorf("error disabling webhook: %w", err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error getting rows affected: %w", err)
+		}
+		disabled = rowsAffected > 0
+		return nil
+	})
+	return disabled, err
+}
+
+// GetWebhookDeliveries retrieves the latest deliveries for a webhook, newest first
+func GetWebhookDeliveries(ctx context.Context, webhookID, limit int) ([]WebhookDelivery, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "models.GetWebhookDeliveries")
+	defer span.End()
+
+	query := `SELECT id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+			last_status_code, last_error, created_at, delivered_at
+		FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`
+	rows, err := conn(ctx).QueryContext(ctx, query, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		var nextAttemptAt time.Time
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&nextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook delivery: %w", err)
+		}
+		if d.Status == DeliveryPending {
+			d.NextAttemptAt = &nextAttemptAt
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,171 @@
+package outbox
+
+import (
+	"context"
+	"crud-app/pkg/config"
+	"crud-app/pkg/models"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// deliveryTimeout bounds a single delivery to a single sink
+	deliveryTimeout = 10 * time.Second
+	// maxRetryBackoff caps the delay between delivery attempts
+	maxRetryBackoff = time.Hour
+)
+
+// Dispatcher polls the outbox table and delivers events to its sinks.
+// An event is marked delivered only once every sink has accepted it; if any
+// sink fails, the whole event is retried later with exponential backoff.
+type Dispatcher struct {
+	sinks []Sink
+	cfg   config.OutboxConfig
+	store store
+}
+
+// store records the progress of events through the outbox table
+type store interface {
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error)
+	Release(ctx context.Context, ids []int64) error
+	MarkDelivered(ctx context.Context, id int64) error
+	Retry(ctx context.Context, id int64, lastErr string, next time.Time) error
+	Fail(ctx context.Context, id int64, lastErr string) error
+}
+
+// dbStore is the outbox_events table
+type dbStore struct{}
+
+func (dbStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	return models.ClaimOutboxEvents(ctx, limit, lease)
+}
+
+func (dbStore) Release(ctx context.Context, ids []int64) error {
+	return models.ReleaseOutboxEvents(ctx, ids)
+}
+
+func (dbStore) MarkDelivered(ctx context.Context, id int64) error {
+	return models.MarkOutboxEventDelivered(ctx, id)
+}
+
+func (dbStore) Retry(ctx context.Context, id int64, lastErr string, next time.Time) error {
+	return models.RetryOutboxEvent(ctx, id, lastErr, next)
+}
+
+func (dbStore) Fail(ctx context.Context, id int64, lastErr string) error {
+	return models.FailOutboxEvent(ctx, id, lastErr)
+}
+
+// NewDispatcher creates a Dispatcher that delivers to sinks
+func NewDispatcher(sinks []Sink, cfg config.OutboxConfig) *Dispatcher {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 100
+	}
+	return &Dispatcher{sinks: sinks, cfg: cfg, store: dbStore{}}
+}
+
+// Run delivers events until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := d.poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("outbox: %v", err)
+		}
+
+		// A full batch means there are probably more events waiting
+		if n == d.cfg.BatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll claims and delivers one batch of events, returning how many were claimed
+func (d *Dispatcher) poll(ctx context.Context) (int, error) {
+	// Events stay claimed long enough for every sink to time out once
+	lease := time.Duration(len(d.sinks)+1) * deliveryTimeout
+	events, err := d.store.Claim(ctx, d.cfg.BatchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, e := range events {
+		// On shutdown, hand back the events not yet started rather than
+		// leaving them claimed until the lease runs out
+		if ctx.Err() != nil {
+			ids := make([]int64, 0, len(events)-i)
+			for _, e := range events[i:] {
+				ids = append(ids, e.ID)
+			}
+			if err := d.store.Release(context.WithoutCancel(ctx), ids); err != nil {
+				return len(events), err
+			}
+			break
+		}
+		// Don't abandon an event halfway through delivery on shutdown
+		d.dispatch(context.WithoutCancel(ctx), e)
+	}
+	return len(events), nil
+}
+
+// dispatch delivers one event to every sink and records the outcome
+func (d *Dispatcher) dispatch(ctx context.Context, e models.OutboxEvent) {
+	event := NewEvent(e)
+
+	var failures []string
+	for _, sink := range d.sinks {
+		sinkCtx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+		err := sink.Deliver(sinkCtx, event)
+		cancel()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", sink.Name(), err))
+		}
+	}
+
+	if len(failures) == 0 {
+		if err := d.store.MarkDelivered(ctx, e.ID); err != nil {
+			log.Printf("outbox: %v", err)
+		}
+		return
+	}
+
+	lastErr := strings.Join(failures, "; ")
+	if e.Attempts >= d.cfg.MaxAttempts {
+		log.Printf("outbox: giving up on event %d after %d attempts: %s", e.ID, e.Attempts, lastErr)
+		if err := d.store.Fail(ctx, e.ID, lastErr); err != nil {
+			log.Printf("outbox: %v", err)
+		}
+		return
+	}
+
+	next := time.Now().Add(d.backoff(e.Attempts))
+	log.Printf("outbox: event %d attempt %d failed, retrying at %s: %s", e.ID, e.Attempts, next.Format(time.RFC3339), lastErr)
+	if err := d.store.Retry(ctx, e.ID, lastErr, next); err != nil {
+		log.Printf("outbox: %v", err)
+	}
+}
+
+// backoff returns the delay after the given number of failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.cfg.RetryBackoff
+	for i := 1; i < attempts && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryBackoff)
+}
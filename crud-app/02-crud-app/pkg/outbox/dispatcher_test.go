@@ -0,0 +1,213 @@
+package outbox
+
+import (
+	"context"
+	"crud-app/pkg/config"
+	"crud-app/pkg/models"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is a store that records what the dispatcher did
+type memoryStore struct {
+	mu        sync.Mutex
+	events    []models.OutboxEvent // Returned by the next Claim
+	released  []int64
+	delivered []int64
+	retried   map[int64]time.Time
+	failed    map[int64]string
+	lastErr   string
+}
+
+func newMemoryStore(events ...models.OutboxEvent) *memoryStore {
+	return &memoryStore{events: events, retried: map[int64]time.Time{}, failed: map[int64]string{}}
+}
+
+func (s *memoryStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := min(limit, len(s.events))
+	claimed := s.events[:n]
+	s.events = s.events[n:]
+	return claimed, nil
+}
+
+func (s *memoryStore) Release(ctx context.Context, ids []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.released = append(s.released, ids...)
+	return ctx.Err()
+}
+
+func (s *memoryStore) MarkDelivered(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delivered = append(s.delivered, id)
+	return ctx.Err()
+}
+
+func (s *memoryStore) Retry(ctx context.Context, id int64, lastErr string, next time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retried[id], s.lastErr = next, lastErr
+	return ctx.Err()
+}
+
+func (s *memoryStore) Fail(ctx context.Context, id int64, lastErr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed[id] = lastErr
+	return ctx.Err()
+}
+
+// fakeSink records events and fails with err, if set
+type fakeSink struct {
+	name    string
+	err     error
+	deliver func(ctx context.Context, event Event) // Called on each delivery, if set
+
+	mu     sync.Mutex
+	events []int64
+}
+
+func (s *fakeSink) Name() string { return s.name }
+
+func (s *fakeSink) Deliver(ctx context.Context, event Event) error {
+	if s.deliver != nil {
+		s.deliver(ctx, event)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event.ID)
+	return s.err
+}
+
+func testDispatcher(store *memoryStore, sinks ...Sink) *Dispatcher {
+	d := NewDispatcher(sinks, config.OutboxConfig{BatchSize: 10, MaxAttempts: 5, RetryBackoff: time.Second})
+	d.store = store
+	return d
+}
+
+func TestDispatchMarksDeliveredOnceEverySinkAccepts(t *testing.T) {
+	store := newMemoryStore(models.OutboxEvent{ID: 1, Attempts: 1}, models.OutboxEvent{ID: 2, Attempts: 1})
+	a, b := &fakeSink{name: "a"}, &fakeSink{name: "b"}
+
+	n, err := testDispatcher(store, a, b).poll(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("poll = %d, %v; want 2 events", n, err)
+	}
+	if len(store.delivered) != 2 || len(store.retried) != 0 || len(store.failed) != 0 {
+		t.Errorf("delivered %v, retried %v, failed %v; want both delivered", store.delivered, store.retried, store.failed)
+	}
+	if len(a.events) != 2 || len(b.events) != 2 {
+		t.Errorf("sinks saw %v and %v, want both events each", a.events, b.events)
+	}
+}
+
+func TestDispatchRetriesWithBackoff(t *testing.T) {
+	store := newMemoryStore(models.OutboxEvent{ID: 1, Attempts: 3})
+	ok, broken := &fakeSink{name: "ok"}, &fakeSink{name: "broken", err: errors.New("connection refused")}
+
+	start := time.Now()
+	testDispatcher(store, ok, broken).poll(context.Background())
+
+	next, retried := store.retried[1]
+	if !retried || len(store.delivered) != 0 {
+		t.Fatalf("retried %v, delivered %v; want a retry", store.retried, store.delivered)
+	}
+	// 1s doubled for the second and third failed attempts
+	if delay := next.Sub(start); delay < 4*time.Second || delay > 5*time.Second {
+		t.Errorf("next attempt in %v, want about 4s", delay)
+	}
+	if store.lastErr != "broken: connection refused" {
+		t.Errorf("last error = %q, want only the failing sink", store.lastErr)
+	}
+}
+
+func TestDispatchGivesUpAfterMaxAttempts(t *testing.T) {
+	store := newMemoryStore(models.OutboxEvent{ID: 1, Attempts: 5})
+	broken := &fakeSink{name: "broken", err: errors.New("timeout")}
+
+	testDispatcher(store, broken).poll(context.Background())
+
+	if store.failed[1] != "broken: timeout" || len(store.retried) != 0 {
+		t.Errorf("failed %v, retried %v; want the event failed", store.failed, store.retried)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := testDispatcher(newMemoryStore())
+	tests := map[int]time.Duration{
+		0:  time.Second,
+		1:  time.Second,
+		2:  2 * time.Second,
+		5:  16 * time.Second,
+		12: 2048 * time.Second,
+		13: maxRetryBackoff,
+		60: maxRetryBackoff,
+	}
+	for attempts, want := range tests {
+		if got := d.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestPollStopsBetweenEventsOnShutdown(t *testing.T) {
+	store := newMemoryStore(models.OutboxEvent{ID: 1, Attempts: 1}, models.OutboxEvent{ID: 2, Attempts: 1}, models.OutboxEvent{ID: 3, Attempts: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Shutdown starts while the first event is being delivered
+	sink := &fakeSink{name: "slow", deliver: func(sinkCtx context.Context, event Event) {
+		cancel()
+		if sinkCtx.Err() != nil {
+			t.Errorf("event %d: delivery was cancelled midway", event.ID)
+		}
+	}}
+	testDispatcher(store, sink).poll(ctx)
+
+	if len(sink.events) != 1 || len(store.delivered) != 1 {
+		t.Errorf("sink saw %v, delivered %v; want only the first event", sink.events, store.delivered)
+	}
+	if len(store.released) != 2 || store.released[0] != 2 || store.released[1] != 3 {
+		t.Errorf("released %v, want [2 3]", store.released)
+	}
+}
+
+func TestRunDeliversUntilCancelled(t *testing.T) {
+	store := newMemoryStore(models.OutboxEvent{ID: 1, Attempts: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := &fakeSink{name: "sink", deliver: func(context.Context, Event) { cancel() }}
+
+	done := make(chan struct{})
+	go func() {
+		testDispatcher(store, sink).Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after ctx was cancelled")
+	}
+	if len(store.delivered) != 1 {
+		t.Errorf("delivered %v, want [1]", store.delivered)
+	}
+}
+
+func TestNewSinks(t *testing.T) {
+	sinks, err := NewSinks(config.OutboxConfig{Sinks: []string{"log", "nats"}, NATSURL: "nats://localhost:4222"})
+	if err != nil || len(sinks) != 2 || sinks[0].Name() != "log" || sinks[1].Name() != "nats" {
+		t.Errorf("NewSinks = %v, %v", sinks, err)
+	}
+
+	// The webhook sink needs a URL
+	for _, name := range []string{"webhook", "kafka"} {
+		if _, err := NewSinks(config.OutboxConfig{Sinks: []string{name}}); err == nil {
+			t.Errorf("NewSinks(%s) succeeded", name)
+		}
+	}
+}
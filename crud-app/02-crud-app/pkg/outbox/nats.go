@@ -0,0 +1,159 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSSink publishes events to a NATS server using the plain text client
+// protocol. Each event goes to <prefix>.<event type>, e.g. events.user.created.
+// A publish is followed by a PING, and only counts as delivered once the
+// server's PONG confirms it has processed the message.
+type NATSSink struct {
+	URL           string
+	SubjectPrefix string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	dial   func(ctx context.Context, network, address string) (net.Conn, error) // Replaced in tests
+}
+
+// NewNATSSink creates a NATSSink for a server URL such as nats://localhost:4222
+func NewNATSSink(url, subjectPrefix string) *NATSSink {
+	return &NATSSink{URL: url, SubjectPrefix: subjectPrefix}
+}
+
+// Name returns "nats"
+func (s *NATSSink) Name() string { return "nats" }
+
+// Deliver publishes the event, connecting first if needed
+func (s *NATSSink) Deliver(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error encoding event: %v", err)
+	}
+	subject := event.Type
+	if s.SubjectPrefix != "" {
+		subject = s.SubjectPrefix + "." + event.Type
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := s.publish(ctx, subject, payload); err != nil {
+		// Drop the connection so the next attempt starts afresh
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// connect dials the server and completes the CONNECT handshake
+func (s *NATSSink) connect(ctx context.Context) error {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return fmt.Errorf("invalid NATS URL: %v", err)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	dial := s.dial
+	if dial == nil {
+		var dialer net.Dialer
+		dial = dialer.DialContext
+	}
+	conn, err := dial(ctx, "tcp", host)
+	if err != nil {
+		return fmt.Errorf("error connecting to NATS: %v", err)
+	}
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+
+	options := map[string]interface{}{"verbose": false, "pedantic": false, "name": "crud-app outbox"}
+	if u.User != nil {
+		options["user"] = u.User.Username()
+		options["pass"], _ = u.User.Password()
+	}
+	connect, _ := json.Marshal(options)
+
+	err = s.roundTrip(ctx, func() error {
+		// The server greets every client with an INFO line
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, "INFO") {
+			return fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+		}
+		_, err = fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect)
+		return err
+	})
+	if err != nil {
+		conn.Close()
+		s.conn = nil
+		return fmt.Errorf("error connecting to NATS: %v", err)
+	}
+	return nil
+}
+
+// publish sends a PUB for subject and waits for the server to acknowledge it
+func (s *NATSSink) publish(ctx context.Context, subject string, payload []byte) error {
+	err := s.roundTrip(ctx, func() error {
+		_, err := fmt.Fprintf(s.conn, "PUB %s %d\r\n%s\r\nPING\r\n", subject, len(payload), payload)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error publishing to NATS: %v", err)
+	}
+	return nil
+}
+
+// roundTrip runs send and then reads until the server's PONG, within ctx's deadline
+func (s *NATSSink) roundTrip(ctx context.Context, send func() error) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(deliveryTimeout)
+	}
+	s.conn.SetDeadline(deadline)
+	defer s.conn.SetDeadline(time.Time{})
+
+	if err := send(); err != nil {
+		return err
+	}
+
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := s.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// Anything else, such as +OK or a fresh INFO, needs no reply
+	}
+}
@@ -0,0 +1,55 @@
+package outbox
+
+import (
+	"context"
+	"crud-app/pkg/config"
+	"crud-app/pkg/models"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event is a user change as delivered to sinks
+type Event struct {
+	ID         int64           `json:"id"`
+	Type       string          `json:"type"` // models.EventUserCreated, EventUserUpdated or EventUserDeleted
+	UserID     int             `json:"user_id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"` // The user as it was after the change
+}
+
+// NewEvent converts a stored outbox row into an Event
+func NewEvent(e models.OutboxEvent) Event {
+	return Event{ID: e.ID, Type: e.Type, UserID: e.UserID, OccurredAt: e.CreatedAt, Data: e.Payload}
+}
+
+// Sink delivers events downstream. Delivery is at least once, so sinks may see
+// the same event more than once and should be idempotent on Event.ID.
+// Implementations must be safe for concurrent use.
+type Sink interface {
+	Name() string
+	Deliver(ctx context.Context, event Event) error
+}
+
+// NewSinks returns the sinks selected in the config
+func NewSinks(cfg config.OutboxConfig) ([]Sink, error) {
+	var sinks []Sink
+	for _, name := range cfg.Sinks {
+		switch name {
+		case "log":
+			sinks = append(sinks, &LogSink{})
+		case "file":
+			sinks = append(sinks, &FileSink{Path: cfg.FilePath})
+		case "webhook":
+			if cfg.WebhookURL == "" {
+				return nil, fmt.Errorf("OUTBOX_WEBHOOK_URL is required for the webhook sink")
+			}
+			sinks = append(sinks, NewWebhookSink(cfg.WebhookURL))
+		case "nats":
+			sinks = append(sinks, NewNATSSink(cfg.NATSURL, cfg.NATSSubjectPrefix))
+		default:
+			return nil, fmt.Errorf("unknown outbox sink %q", name)
+		}
+	}
+	return sinks, nil
+}
@@ -0,0 +1,103 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LogSink writes events to the application log
+type LogSink struct{}
+
+// Name returns "log"
+func (s *LogSink) Name() string { return "log" }
+
+// Deliver logs the event
+func (s *LogSink) Deliver(ctx context.Context, event Event) error {
+	log.Printf("event id=%d type=%s user_id=%d data=%s", event.ID, event.Type, event.UserID, event.Data)
+	return nil
+}
+
+// FileSink appends events to a file as newline-delimited JSON
+type FileSink struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Name returns "file"
+func (s *FileSink) Name() string { return "file" }
+
+// Deliver appends the event to the file
+func (s *FileSink) Deliver(ctx context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error encoding event: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening event file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing event file: %v", err)
+	}
+	return nil
+}
+
+// WebhookSink POSTs each event as JSON to a fixed URL. Any 2xx response
+// counts as delivered.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhookSink creates a WebhookSink for url
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{URL: url, Client: &http.Client{Timeout: deliveryTimeout}}
+}
+
+// Name returns "webhook"
+func (s *WebhookSink) Name() string { return "webhook" }
+
+// Deliver POSTs the event to the webhook URL
+func (s *WebhookSink) Deliver(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error encoding event: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", strconv.FormatInt(event.ID, 10))
+	req.Header.Set("X-Event-Type", event.Type)
+	req.Header.Set("X-Event-Time", event.OccurredAt.UTC().Format(time.RFC3339))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"crud-app/pkg/auth"
+	"crud-app/pkg/middleware"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limiter applies per-route rate limits, keyed by client, against a Store
+type Limiter struct {
+	store Store
+}
+
+// NewLimiter creates a Limiter backed by store
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{store: store}
+}
+
+// Limit returns middleware that allows each client limit.Rate requests per
+// second, with bursts up to limit.Burst, on the routes it wraps. Routes that
+// share a name share a bucket.
+func (l *Limiter) Limit(name string, limit Limit) middleware.Middleware {
+	return l.limit(name, limit, ClientKey)
+}
+
+// LimitAddr is like Limit, but keys every request by IP address, even once it
+// has been authenticated. Running it before authentication caps how fast one
+// address can try credentials.
+func (l *Limiter) LimitAddr(name string, limit Limit) middleware.Middleware {
+	return l.limit(name, limit, AddrKey)
+}
+
+func (l *Limiter) limit(name string, limit Limit, key func(*http.Request) string) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := l.store.Take(r.Context(), name+":"+key(r), limit)
+			if err != nil {
+				// Fail open, so a broken shared store doesn't take the API down
+				log.Printf("rate limit store error: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+			h.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			h.Set("X-RateLimit-Reset", ceilSeconds(result.ResetAfter))
+
+			if !result.Allowed {
+				h.Set("Retry-After", ceilSeconds(result.RetryAfter))
+				middleware.WriteError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientKey identifies the caller: their API key, token subject or account
+// if the request was authenticated, otherwise their IP address. Limits must
+// run after authentication for authenticated callers to get their own bucket.
+func ClientKey(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		return p.Method + ":" + p.Subject
+	}
+	return AddrKey(r)
+}
+
+// AddrKey identifies the caller by their IP address
+func AddrKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,27 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit is a token bucket: requests refill at Rate per second, up to Burst
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed    bool
+	Remaining  int           // Whole tokens left after this request
+	RetryAfter time.Duration // How long until a token is available, if not allowed
+	ResetAfter time.Duration // How long until the bucket is full again
+}
+
+// Store keeps token buckets. Implementations must be safe for concurrent use.
+// The in-memory store works for a single instance; a shared store (e.g. Redis)
+// can implement the same interface to limit across instances.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
@@ -0,0 +1,151 @@
+package ratelimit
+
+import (
+	"context"
+	"crud-app/pkg/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testStore returns a MemoryStore whose clock only moves when advance is called
+func testStore() (*MemoryStore, func(time.Duration)) {
+	now := time.Now()
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	s.lastSweep = now
+	return s, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestMemoryStoreAllowsBurst(t *testing.T) {
+	ctx := context.Background()
+	s, _ := testStore()
+	limit := Limit{Rate: 1, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		result, _ := s.Take(ctx, "a", limit)
+		if !result.Allowed {
+			t.Fatalf("request %d was limited within the burst", i+1)
+		}
+		if result.Remaining != 2-i {
+			t.Errorf("request %d: Remaining = %d, want %d", i+1, result.Remaining, 2-i)
+		}
+	}
+
+	result, _ := s.Take(ctx, "a", limit)
+	if result.Allowed {
+		t.Fatal("request past the burst was allowed")
+	}
+	if result.RetryAfter != time.Second {
+		t.Errorf("RetryAfter = %v, want 1s", result.RetryAfter)
+	}
+	if result.ResetAfter != 3*time.Second {
+		t.Errorf("ResetAfter = %v, want 3s", result.ResetAfter)
+	}
+
+	// Other keys have their own bucket
+	if result, _ := s.Take(ctx, "b", limit); !result.Allowed {
+		t.Error("a different key was limited")
+	}
+}
+
+func TestMemoryStoreRefills(t *testing.T) {
+	ctx := context.Background()
+	s, advance := testStore()
+	limit := Limit{Rate: 2, Burst: 2}
+
+	s.Take(ctx, "a", limit)
+	s.Take(ctx, "a", limit)
+	if result, _ := s.Take(ctx, "a", limit); result.Allowed {
+		t.Fatal("empty bucket allowed a request")
+	}
+
+	advance(250 * time.Millisecond)
+	result, _ := s.Take(ctx, "a", limit)
+	if result.Allowed {
+		t.Fatal("half a token allowed a request")
+	}
+	if result.RetryAfter != 250*time.Millisecond {
+		t.Errorf("RetryAfter = %v, want 250ms", result.RetryAfter)
+	}
+
+	advance(250 * time.Millisecond)
+	if result, _ := s.Take(ctx, "a", limit); !result.Allowed {
+		t.Fatal("refilled token was not allowed")
+	}
+
+	// Refilling stops at the burst
+	advance(time.Hour)
+	for i := 0; i < 2; i++ {
+		s.Take(ctx, "a", limit)
+	}
+	if result, _ := s.Take(ctx, "a", limit); result.Allowed {
+		t.Error("bucket refilled past its burst")
+	}
+}
+
+func TestMemoryStoreSweepsFullBuckets(t *testing.T) {
+	ctx := context.Background()
+	s, advance := testStore()
+	limit := Limit{Rate: 1, Burst: 1}
+
+	s.Take(ctx, "a", limit)
+	advance(sweepInterval)
+	s.Take(ctx, "b", limit)
+
+	if _, ok := s.buckets["a"]; ok {
+		t.Error("full bucket was not swept")
+	}
+	if _, ok := s.buckets["b"]; !ok {
+		t.Error("bucket in use was swept")
+	}
+}
+
+func TestLimitRespondsWith429(t *testing.T) {
+	s, _ := testStore()
+	h := NewLimiter(s).Limit("test", Limit{Rate: 0.5, Burst: 1})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("first request status = %d", w.Code)
+	}
+	if got := w.Header().Get("X-RateLimit-Limit"); got != "1" {
+		t.Errorf("X-RateLimit-Limit = %q, want 1", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("X-RateLimit-Remaining = %q, want 0", got)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+}
+
+func TestClientKeys(t *testing.T) {
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if got := ClientKey(req); got != "ip:192.0.2.1" {
+		t.Errorf("anonymous ClientKey = %q", got)
+	}
+
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{Method: auth.MethodAPIKey, Subject: "7"}))
+	if got := ClientKey(req); got != auth.MethodAPIKey+":7" {
+		t.Errorf("authenticated ClientKey = %q", got)
+	}
+	if got := AddrKey(req); got != "ip:192.0.2.1" {
+		t.Errorf("AddrKey = %q, want the address even when authenticated", got)
+	}
+}
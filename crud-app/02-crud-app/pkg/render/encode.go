@@ -0,0 +1,266 @@
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Every format is derived from the value's JSON encoding, so XML, MessagePack
+// and CSV bodies carry the same fields, names and omissions as JSON ones.
+
+// encodeJSON writes v as JSON
+func encodeJSON(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// encodeMsgpack writes v as MessagePack. Whole JSON numbers become integers.
+func encodeMsgpack(w io.Writer, v interface{}) error {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	return msgpack.NewEncoder(w).Encode(generic)
+}
+
+// encodeXML writes v as XML under a <response> root. Object fields become
+// elements named after their JSON keys and list items become <item> elements.
+func encodeXML(w io.Writer, v interface{}) error {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	if err := writeXMLElement(enc, "response", generic); err != nil {
+		return err
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// writeXMLElement writes value as an element called name. Keys that aren't
+// valid element names are written as <entry key="..."> instead.
+func writeXMLElement(enc *xml.Encoder, name string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !isXMLName(name) {
+		start = xml.StartElement{
+			Name: xml.Name{Local: "entry"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}},
+		}
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := writeXMLElement(enc, key, value[key]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if err := writeXMLElement(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(value))); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// isXMLName reports whether s can be used as an element name. It is stricter
+// than the XML spec, which is fine for JSON keys.
+func isXMLName(s string) bool {
+	if s == "" || strings.HasPrefix(strings.ToLower(s), "xml") {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case i > 0 && (c >= '0' && c <= '9' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// encodeCSV writes a list as CSV with a header row of field names. Fields
+// holding objects or lists are written as JSON.
+func encodeCSV(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var rows []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return fmt.Errorf("CSV needs a list of objects: %v", err)
+	}
+
+	columns := csvColumns(reflect.TypeOf(v).Elem(), rows)
+	cw := csv.NewWriter(w)
+	if len(columns) > 0 {
+		if err := cw.Write(columns); err != nil {
+			return err
+		}
+	}
+
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, column := range columns {
+			record[i] = csvCell(row[column])
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvColumns returns the header for a list of elem. Structs use their JSON
+// field names in declaration order, so empty lists still get a header;
+// anything else uses every key that appears, sorted.
+func csvColumns(elem reflect.Type, rows []map[string]json.RawMessage) []string {
+	for elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+	if elem.Kind() == reflect.Struct {
+		return jsonFieldNames(elem)
+	}
+
+	seen := map[string]bool{}
+	var columns []string
+	for _, row := range rows {
+		for key := range row {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// jsonFieldNames returns the names encoding/json uses for t's fields.
+// Untagged embedded structs are flattened, as encoding/json does.
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				names = append(names, jsonFieldNames(ft)...)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// csvCell formats one JSON value for a CSV cell
+func csvCell(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if raw[0] == '"' && json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// isList reports whether v is a list whose items encode as JSON objects
+func isList(v interface{}) bool {
+	t := reflect.TypeOf(v)
+	if t == nil || (t.Kind() != reflect.Slice && t.Kind() != reflect.Array) {
+		return false
+	}
+	elem := t.Elem()
+	for elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+	return elem.Kind() == reflect.Struct || (elem.Kind() == reflect.Map && elem.Key().Kind() == reflect.String)
+}
+
+// toGeneric converts v to maps, slices and scalars by way of its JSON
+// encoding. Whole numbers become int64s and others float64s.
+func toGeneric(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return convertNumbers(generic), nil
+}
+
+// convertNumbers replaces the json.Numbers in v
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = convertNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertNumbers(item)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
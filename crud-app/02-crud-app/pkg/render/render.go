@@ -0,0 +1,197 @@
+// Package render writes API responses in the format the client asks for in
+// its Accept header: JSON, XML, MessagePack or, for lists, CSV.
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// format is one of the response formats the API can write
+type format struct {
+	mediaType string   // Sent as the Content-Type
+	aliases   []string // Other media types that select this format
+	listsOnly bool     // Only list responses can be written in this format
+	encode    func(w io.Writer, v interface{}) error
+}
+
+// formats in order of preference, for when the client likes several equally.
+// JSON comes first so clients that don't send Accept get what they always have.
+var formats = []format{
+	{mediaType: "application/json", encode: encodeJSON},
+	{mediaType: "application/xml", aliases: []string{"text/xml"}, encode: encodeXML},
+	{mediaType: "application/msgpack", aliases: []string{"application/x-msgpack", "application/vnd.msgpack"}, encode: encodeMsgpack},
+	{mediaType: "text/csv", listsOnly: true, encode: encodeCSV},
+}
+
+// SupportedTypes lists the media types the API can respond with
+func SupportedTypes() []string {
+	var types []string
+	for _, f := range formats {
+		types = append(types, f.mediaType)
+	}
+	return types
+}
+
+// Acceptable reports whether r accepts at least one of the supported formats.
+// Whether a particular response can be written also depends on its value;
+// CSV only suits lists.
+func Acceptable(r *http.Request) bool {
+	ranges := parseAccept(r.Header.Get("Accept"))
+	for _, f := range formats {
+		if q, _, _ := f.quality(ranges); q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Respond writes v with the given status code in the format r prefers. If r
+// accepts none of the formats that can represent v, a successful response is
+// replaced by 406 Not Acceptable; error responses fall back to JSON.
+func Respond(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Add("Vary", "Accept")
+
+	f, contentType, ok := negotiate(r.Header.Get("Accept"), isList(v))
+	if !ok {
+		if status < 400 {
+			NotAcceptable(w)
+			return
+		}
+		f, contentType = formats[0], formats[0].mediaType
+	}
+
+	// Encode up front so an encoding error can still become a 500
+	var buf bytes.Buffer
+	if err := f.encode(&buf, v); err != nil {
+		log.Printf("error encoding %s response: %v", contentType, err)
+		JSON(w, http.StatusInternalServerError, map[string]string{"error": "Error encoding response"})
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// JSON writes v as a JSON body with the given status code, whatever the
+// client accepts
+func JSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// NotAcceptable writes a 406 response listing the supported media types
+func NotAcceptable(w http.ResponseWriter) {
+	JSON(w, http.StatusNotAcceptable, map[string]string{
+		"error": fmt.Sprintf("Not Acceptable: supported types are %s", strings.Join(SupportedTypes(), ", ")),
+	})
+}
+
+// negotiate picks the format for a response from an Accept header. list says
+// whether the response is a list, which CSV requires. contentType is the
+// media type to send: the one the client's range matched, or the format's own
+// if it only matched */*. Formats the client names beat those it only
+// accepts through a wildcard at the same quality.
+func negotiate(accept string, list bool) (f format, contentType string, ok bool) {
+	ranges := parseAccept(accept)
+	bestQ, bestSpecificity := 0.0, -1
+	for _, candidate := range formats {
+		if candidate.listsOnly && !list {
+			continue
+		}
+		q, specificity, matched := candidate.quality(ranges)
+		if q > bestQ || (q == bestQ && q > 0 && specificity > bestSpecificity) {
+			f, contentType, ok = candidate, matched, true
+			bestQ, bestSpecificity = q, specificity
+		}
+	}
+	return f, contentType, ok
+}
+
+// quality returns how much ranges want f, how specifically, and which of f's
+// media types to send
+func (f format) quality(ranges []mediaRange) (q float64, specificity int, contentType string) {
+	specificity = -1
+	contentType = f.mediaType
+	for _, t := range append([]string{f.mediaType}, f.aliases...) {
+		tq, ts := matchType(ranges, t)
+		if tq > q || (tq == q && tq > 0 && ts > specificity) {
+			q, specificity = tq, ts
+			if ts > 0 {
+				contentType = t
+			} else {
+				contentType = f.mediaType
+			}
+		}
+	}
+	return q, specificity, contentType
+}
+
+// matchType returns the quality of the most specific range matching
+// mediaType, as RFC 9110 section 12.5.1 describes, and how specific that
+// range was: 0 for */*, 1 for type/*, 2 for an exact match
+func matchType(ranges []mediaRange, mediaType string) (q float64, specificity int) {
+	typ, sub, _ := strings.Cut(mediaType, "/")
+	specificity = -1
+	for _, mr := range ranges {
+		s := -1
+		switch {
+		case mr.typ == typ && mr.sub == sub:
+			s = 2
+		case mr.typ == typ && mr.sub == "*":
+			s = 1
+		case mr.typ == "*" && mr.sub == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = mr.q, s
+		}
+	}
+	if specificity < 0 {
+		return 0, -1
+	}
+	return q, specificity
+}
+
+// mediaRange is one entry of an Accept header
+type mediaRange struct {
+	typ, sub string
+	q        float64
+}
+
+// parseAccept parses an Accept header. A missing header accepts anything.
+// Malformed entries are skipped.
+func parseAccept(header string) []mediaRange {
+	if strings.TrimSpace(header) == "" {
+		return []mediaRange{{typ: "*", sub: "*", q: 1}}
+	}
+
+	var ranges []mediaRange
+	for _, entry := range strings.Split(header, ",") {
+		params := strings.Split(entry, ";")
+		typ, sub, ok := strings.Cut(strings.ToLower(strings.TrimSpace(params[0])), "/")
+		if !ok || typ == "" || sub == "" || (typ == "*" && sub != "*") {
+			continue
+		}
+
+		mr := mediaRange{typ: typ, sub: sub, q: 1}
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(strings.TrimSpace(name), "q") {
+				var q float64
+				if _, err := fmt.Sscanf(strings.TrimSpace(value), "%g", &q); err == nil && q >= 0 && q <= 1 {
+					mr.q = q
+				}
+			}
+		}
+		ranges = append(ranges, mr)
+	}
+	return ranges
+}
@@ -0,0 +1,135 @@
+package render
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type row struct {
+	ID   string   `json:"id"`
+	Name string   `json:"name"`
+	Tags []string `json:"tags,omitempty"`
+	note string
+}
+
+func respond(t *testing.T, accept string, status int, v interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/", nil)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	Respond(w, r, status, v)
+	return w
+}
+
+func TestNegotiate(t *testing.T) {
+	list := []row{{ID: "1", Name: "Ann"}}
+	one := row{ID: "1", Name: "Ann"}
+
+	tests := []struct {
+		accept      string
+		v           interface{}
+		status      int
+		contentType string
+	}{
+		{"", one, http.StatusOK, "application/json"},
+		{"*/*", list, http.StatusOK, "application/json"},
+		{"application/xml", one, http.StatusOK, "application/xml"},
+		{"text/xml", one, http.StatusOK, "text/xml"},
+		{"text/*", one, http.StatusOK, "text/xml"},
+		{"application/xml, */*", one, http.StatusOK, "application/xml"},
+		{"application/json;q=0.5, application/msgpack", one, http.StatusOK, "application/msgpack"},
+		{"application/x-msgpack", one, http.StatusOK, "application/x-msgpack"},
+		{"text/csv", list, http.StatusOK, "text/csv"},
+		{"text/csv, application/json;q=0.1", one, http.StatusOK, "application/json"},
+		{"TEXT/CSV; charset=utf-8", list, http.StatusOK, "text/csv"},
+		{"application/json;q=0, */*", one, http.StatusOK, "application/xml"},
+
+		{"text/csv", one, http.StatusNotAcceptable, "application/json"},
+		{"text/html", list, http.StatusNotAcceptable, "application/json"},
+	}
+	for _, tt := range tests {
+		w := respond(t, tt.accept, http.StatusOK, tt.v)
+		if w.Code != tt.status || w.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("Accept %q: got %d %s, want %d %s", tt.accept, w.Code, w.Header().Get("Content-Type"), tt.status, tt.contentType)
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("Accept %q: Vary = %q", tt.accept, w.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestErrorsFallBackToJSON(t *testing.T) {
+	w := respond(t, "text/html", http.StatusNotFound, map[string]string{"error": "User not found"})
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("got %d %s, want a JSON 404", w.Code, w.Header().Get("Content-Type"))
+	}
+}
+
+func TestAcceptable(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"":                          true,
+		"text/csv":                  true,
+		"application/*":             true,
+		"text/html":                 false,
+		"text/html, */*;q=0":        false,
+		"application/json;q=0":      false,
+		"not a media type, image/*": false,
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+		if got := Acceptable(r); got != want {
+			t.Errorf("Acceptable(%q) = %v, want %v", accept, got, want)
+		}
+	}
+}
+
+func TestEncodeCSV(t *testing.T) {
+	w := respond(t, "text/csv", http.StatusOK, []row{
+		{ID: "1", Name: "Ann, Jr.", Tags: []string{"a", "b"}},
+		{ID: "2", Name: "Bob"},
+	})
+	want := "id,name,tags\n1,\"Ann, Jr.\",\"[\"\"a\"\",\"\"b\"\"]\"\n2,Bob,\n"
+	if w.Body.String() != want {
+		t.Errorf("CSV body = %q, want %q", w.Body.String(), want)
+	}
+
+	w = respond(t, "text/csv", http.StatusOK, []row{})
+	if w.Body.String() != "id,name,tags\n" {
+		t.Errorf("empty CSV body = %q", w.Body.String())
+	}
+}
+
+func TestEncodeXML(t *testing.T) {
+	w := respond(t, "application/xml", http.StatusOK, []interface{}{
+		row{ID: "1", Name: "A & B"},
+		map[string]interface{}{"count": 2, "bad key": nil},
+	})
+	want := `<response><item><id>1</id><name>A &amp; B</name></item>` +
+		`<item><entry key="bad key"></entry><count>2</count></item></response>`
+	if body := w.Body.String(); !strings.Contains(body, want) || !strings.HasPrefix(body, "<?xml") {
+		t.Errorf("XML body = %s, want it to contain %s", body, want)
+	}
+}
+
+func TestEncodeMsgpack(t *testing.T) {
+	w := respond(t, "application/msgpack", http.StatusCreated, map[string]interface{}{"id": 7, "user": row{ID: "7", Name: "Ann"}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d", w.Code)
+	}
+
+	var got map[string]interface{}
+	if err := msgpack.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+	user, _ := got["user"].(map[string]interface{})
+	if fmt.Sprint(got["id"]) != "7" || user["name"] != "Ann" {
+		t.Errorf("decoded %#v", got)
+	}
+}
@@ -0,0 +1,131 @@
+package stream
+
+import (
+	"crud-app/pkg/outbox"
+	"slices"
+	"sync"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before it
+// is dropped. Dropped clients can reconnect and resume from the broker's buffer.
+const subscriberBuffer = 64
+
+// Broker fans user change events out to live subscribers, and keeps the most
+// recent events so reconnecting clients can resume where they left off
+type Broker struct {
+	mu     sync.Mutex
+	recent []outbox.Event // In the order published, at most size events
+	size   int
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// Subscription receives events published after it was created. C is closed
+// when the subscriber falls too far behind or the broker shuts down.
+type Subscription struct {
+	C <-chan outbox.Event
+
+	ch     chan outbox.Event
+	lagged bool
+}
+
+// Lagged reports whether the subscription was dropped for falling behind,
+// rather than closed by the broker shutting down. Only valid once C is closed.
+func (s *Subscription) Lagged() bool {
+	return s.lagged
+}
+
+// NewBroker creates a Broker that keeps the last size events for resuming
+func NewBroker(size int) *Broker {
+	return &Broker{size: size, subs: map[*Subscription]struct{}{}}
+}
+
+// Publish sends event to every subscriber without blocking. Subscribers whose
+// buffer is full are dropped rather than slowing everyone else down.
+func (b *Broker) Publish(event outbox.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	if b.size > 0 {
+		if len(b.recent) == b.size {
+			b.recent = append(b.recent[:0], b.recent[1:]...)
+		}
+		b.recent = append(b.recent, event)
+	}
+
+	for sub := range b.subs {
+		select {
+		case sub.ch <- event:
+		default:
+			delete(b.subs, sub)
+			sub.lagged = true
+			close(sub.ch)
+		}
+	}
+}
+
+// Subscribe registers a new subscriber. If lastEventID is non-zero, the
+// buffered events after it are returned so the caller can replay them first;
+// complete is false if some events after lastEventID are no longer buffered.
+func (b *Broker) Subscribe(lastEventID int64) (sub *Subscription, backlog []outbox.Event, complete bool) {
+	ch := make(chan outbox.Event, subscriberBuffer)
+	sub = &Subscription{C: ch, ch: ch}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+		return sub, nil, true
+	}
+	b.subs[sub] = struct{}{}
+
+	if lastEventID == 0 {
+		return sub, nil, true
+	}
+
+	// Events that committed late are published after higher IDs, so resume
+	// from the client's last event in the order events were published
+	for i, event := range b.recent {
+		if event.ID == lastEventID {
+			return sub, slices.Clone(b.recent[i+1:]), true
+		}
+	}
+
+	// With nothing buffered, e.g. just after a restart, the client may have missed events
+	complete = len(b.recent) > 0 && b.recent[0].ID <= lastEventID+1
+	for _, event := range b.recent {
+		if event.ID > lastEventID {
+			backlog = append(backlog, event)
+		}
+	}
+	return sub, backlog, complete
+}
+
+// Unsubscribe removes a subscriber. It is safe to call more than once.
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Close ends every subscription, and any made later, so streaming handlers
+// return and the HTTP server can shut down
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
@@ -0,0 +1,104 @@
+package stream
+
+import (
+	"crud-app/pkg/outbox"
+	"slices"
+	"testing"
+)
+
+func publishRange(b *Broker, from, to int64) {
+	for id := from; id <= to; id++ {
+		b.Publish(outbox.Event{ID: id, Type: "user.updated"})
+	}
+}
+
+func TestSubscribeResumesFromBuffer(t *testing.T) {
+	b := NewBroker(5)
+	publishRange(b, 1, 8) // Buffer now holds 4-8
+
+	for _, tc := range []struct {
+		lastEventID  int64
+		wantFirst    int64
+		wantLen      int
+		wantComplete bool
+	}{
+		{lastEventID: 6, wantFirst: 7, wantLen: 2, wantComplete: true},
+		{lastEventID: 3, wantFirst: 4, wantLen: 5, wantComplete: true},
+		{lastEventID: 2, wantFirst: 4, wantLen: 5, wantComplete: false},
+		{lastEventID: 8, wantLen: 0, wantComplete: true},
+	} {
+		sub, backlog, complete := b.Subscribe(tc.lastEventID)
+		b.Unsubscribe(sub)
+
+		if len(backlog) != tc.wantLen || complete != tc.wantComplete {
+			t.Errorf("Subscribe(%d) = %d events, complete %v; want %d, %v",
+				tc.lastEventID, len(backlog), complete, tc.wantLen, tc.wantComplete)
+			continue
+		}
+		if tc.wantLen > 0 && backlog[0].ID != tc.wantFirst {
+			t.Errorf("Subscribe(%d) starts at %d, want %d", tc.lastEventID, backlog[0].ID, tc.wantFirst)
+		}
+	}
+}
+
+func TestSubscribeResumesInPublishOrder(t *testing.T) {
+	b := NewBroker(10)
+	// 3 committed late, after 4 had been published
+	for _, id := range []int64{1, 2, 4, 3, 5} {
+		b.Publish(outbox.Event{ID: id, Type: "user.updated"})
+	}
+
+	for lastEventID, want := range map[int64][]int64{4: {3, 5}, 3: {5}, 5: nil} {
+		sub, backlog, complete := b.Subscribe(lastEventID)
+		b.Unsubscribe(sub)
+
+		var got []int64
+		for _, event := range backlog {
+			got = append(got, event.ID)
+		}
+		if !complete || !slices.Equal(got, want) {
+			t.Errorf("Subscribe(%d) = %v, complete %v; want %v", lastEventID, got, complete, want)
+		}
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := NewBroker(0)
+	slow, _, _ := b.Subscribe(0)
+	fast, _, _ := b.Subscribe(0)
+
+	for id := int64(1); id <= subscriberBuffer+1; id++ {
+		b.Publish(outbox.Event{ID: id})
+		<-fast.C
+	}
+
+	n := 0
+	for range slow.C {
+		n++
+	}
+	if n != subscriberBuffer || !slow.Lagged() {
+		t.Errorf("slow subscriber got %d events, lagged %v; want %d, true", n, slow.Lagged(), subscriberBuffer)
+	}
+
+	b.Publish(outbox.Event{ID: 100})
+	if event := <-fast.C; event.ID != 100 {
+		t.Errorf("fast subscriber got event %d, want 100", event.ID)
+	}
+}
+
+func TestCloseEndsSubscriptions(t *testing.T) {
+	b := NewBroker(10)
+	sub, _, _ := b.Subscribe(0)
+	b.Close()
+
+	if _, ok := <-sub.C; ok || sub.Lagged() {
+		t.Error("subscription still open, or marked lagged, after Close")
+	}
+
+	// Subscribing after Close returns an already closed subscription
+	late, _, _ := b.Subscribe(0)
+	if _, ok := <-late.C; ok {
+		t.Error("subscription made after Close is open")
+	}
+	b.Unsubscribe(sub)
+}
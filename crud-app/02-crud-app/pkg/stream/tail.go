@@ -0,0 +1,150 @@
+package stream
+
+import (
+	"context"
+	"crud-app/pkg/models"
+	"crud-app/pkg/outbox"
+	"log"
+	"slices"
+	"time"
+)
+
+const (
+	// tailBatchSize is the most events read from the outbox per query
+	tailBatchSize = 500
+
+	// gapGrace is how long a skipped ID is watched for. IDs are allocated when
+	// a row is inserted, so a transaction that commits after a later one leaves
+	// a gap until it does. Gaps left by rolled back transactions never fill.
+	gapGrace = time.Minute
+
+	// maxGaps bounds how many skipped IDs are watched at once, e.g. after a
+	// large import is rolled back. The oldest are given up on first.
+	maxGaps = 1000
+)
+
+// Tail follows the outbox table and publishes new events to b until ctx is
+// cancelled. Unlike the outbox dispatcher it sees every event, delivered or
+// not, so every replica can stream every change.
+//
+// Events are published in the order their transactions commit, as seen by
+// polling. An event that commits after a later ID has already been read is
+// still published, as long as it commits within gapGrace; clients needing
+// every change regardless should use webhooks or another outbox sink.
+func Tail(ctx context.Context, b *Broker, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Start from the newest event; older ones were never seen by live clients
+	var t *tailer
+	for {
+		id, err := models.GetLatestOutboxEventID(ctx)
+		if err == nil {
+			t = newTailer(id)
+			break
+		}
+		log.Printf("stream: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+
+	for {
+		// Events that committed late, filling gaps left earlier
+		if gaps := t.pending(time.Now()); len(gaps) > 0 {
+			events, err := models.GetOutboxEventsByID(ctx, gaps)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("stream: %v", err)
+			}
+			for _, e := range t.fill(events) {
+				b.Publish(outbox.NewEvent(e))
+			}
+		}
+
+		events, err := models.GetOutboxEventsAfter(ctx, t.lastID, tailBatchSize)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("stream: %v", err)
+		}
+		for _, e := range events {
+			b.Publish(outbox.NewEvent(e))
+		}
+		t.advance(events, time.Now())
+
+		// A full batch means there are probably more events waiting
+		if len(events) == tailBatchSize && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tailer tracks the highest event ID read so far and the IDs skipped below
+// it, which may still commit
+type tailer struct {
+	lastID int64
+	gaps   map[int64]time.Time // Skipped ID to when it was first skipped
+}
+
+func newTailer(lastID int64) *tailer {
+	return &tailer{lastID: lastID, gaps: map[int64]time.Time{}}
+}
+
+// advance records events read after lastID, in ID order, and notes any IDs
+// they skipped
+func (t *tailer) advance(events []models.OutboxEvent, now time.Time) {
+	for _, e := range events {
+		for id := t.lastID + 1; id < e.ID; id++ {
+			t.gaps[id] = now
+		}
+		t.lastID = e.ID
+	}
+
+	if len(t.gaps) > maxGaps {
+		ids := t.sortedGaps()
+		for _, id := range ids[:len(ids)-maxGaps] {
+			delete(t.gaps, id)
+		}
+	}
+}
+
+// pending drops gaps older than gapGrace and returns the rest in ID order
+func (t *tailer) pending(now time.Time) []int64 {
+	for id, skipped := range t.gaps {
+		if now.Sub(skipped) > gapGrace {
+			delete(t.gaps, id)
+		}
+	}
+	return t.sortedGaps()
+}
+
+// fill returns the events that filled a gap, removing the gaps they filled
+func (t *tailer) fill(events []models.OutboxEvent) []models.OutboxEvent {
+	var filled []models.OutboxEvent
+	for _, e := range events {
+		if _, ok := t.gaps[e.ID]; ok {
+			delete(t.gaps, e.ID)
+			filled = append(filled, e)
+		}
+	}
+	return filled
+}
+
+func (t *tailer) sortedGaps() []int64 {
+	ids := make([]int64, 0, len(t.gaps))
+	for id := range t.gaps {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
@@ -0,0 +1,61 @@
+package stream
+
+import (
+	"crud-app/pkg/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func outboxEvents(ids ...int64) []models.OutboxEvent {
+	events := make([]models.OutboxEvent, len(ids))
+	for i, id := range ids {
+		events[i] = models.OutboxEvent{ID: id}
+	}
+	return events
+}
+
+func eventIDs(events []models.OutboxEvent) []int64 {
+	ids := []int64{}
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestTailerWatchesGaps(t *testing.T) {
+	now := time.Now()
+	tl := newTailer(10)
+
+	tl.advance(outboxEvents(11, 14, 15), now)
+	if tl.lastID != 15 {
+		t.Errorf("lastID = %d, want 15", tl.lastID)
+	}
+	if got := tl.pending(now); !reflect.DeepEqual(got, []int64{12, 13}) {
+		t.Fatalf("pending = %v, want [12 13]", got)
+	}
+
+	// 13 commits late; 12 was rolled back
+	if got := eventIDs(tl.fill(outboxEvents(13))); !reflect.DeepEqual(got, []int64{13}) {
+		t.Errorf("fill = %v, want [13]", got)
+	}
+	if got := eventIDs(tl.fill(outboxEvents(13))); len(got) != 0 {
+		t.Errorf("fill published 13 twice")
+	}
+	if got := tl.pending(now.Add(gapGrace)); !reflect.DeepEqual(got, []int64{12}) {
+		t.Errorf("pending = %v, want [12]", got)
+	}
+	if got := tl.pending(now.Add(gapGrace + time.Second)); len(got) != 0 {
+		t.Errorf("pending = %v after the grace period, want none", got)
+	}
+}
+
+func TestTailerBoundsGaps(t *testing.T) {
+	tl := newTailer(0)
+	tl.advance(outboxEvents(maxGaps+11), time.Now())
+
+	got := tl.pending(time.Now())
+	if len(got) != maxGaps || got[0] != 11 {
+		t.Errorf("watching %d gaps from %d, want the newest %d", len(got), got[0], maxGaps)
+	}
+}
@@ -0,0 +1,201 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crud-app/pkg/config"
+	"crud-app/pkg/models"
+	"crud-app/pkg/outbox"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Events lists the event types a webhook can subscribe to
+var Events = []string{models.EventUserCreated, models.EventUserUpdated, models.EventUserDeleted}
+
+const (
+	// SecretPrefix starts every webhook signing secret
+	SecretPrefix = "whsec_"
+
+	// maxRetryBackoff caps the delay between delivery attempts
+	maxRetryBackoff = 6 * time.Hour
+)
+
+// NewSecret generates a signing secret for a new webhook
+func NewSecret() (string, error) {
+	return models.NewToken(SecretPrefix)
+}
+
+// Sink is an outbox sink that queues each event for every webhook subscribed
+// to it. The Worker then delivers the queue, so a failing webhook is retried
+// on its own without holding up the outbox or other webhooks.
+type Sink struct{}
+
+// NewSink creates a Sink
+func NewSink() *Sink {
+	return &Sink{}
+}
+
+// Name returns "webhooks"
+func (s *Sink) Name() string { return "webhooks" }
+
+// Deliver queues event for the subscribed webhooks
+func (s *Sink) Deliver(ctx context.Context, event outbox.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error encoding event: %v", err)
+	}
+	return models.EnqueueWebhookDeliveries(ctx, event.ID, event.Type, payload)
+}
+
+// Worker delivers queued events to webhooks, retrying failures with
+// exponential backoff and disabling webhooks that keep failing
+type Worker struct {
+	client *http.Client
+	cfg    config.WebhooksConfig
+}
+
+// NewWorker creates a Worker
+func NewWorker(cfg config.WebhooksConfig) *Worker {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 50
+	}
+	return &Worker{client: &http.Client{Timeout: cfg.Timeout}, cfg: cfg}
+}
+
+// Run delivers webhooks until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := w.poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("webhooks: %v", err)
+		}
+
+		// A full batch means there are probably more deliveries waiting
+		if n == w.cfg.BatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll claims and sends one batch of deliveries, returning how many were claimed
+func (w *Worker) poll(ctx context.Context) (int, error) {
+	// Deliveries are sent one at a time, so the batch is claimed for long
+	// enough to send every one of them
+	lease := w.lease() * time.Duration(w.cfg.BatchSize)
+	deliveries, err := models.ClaimWebhookDeliveries(ctx, w.cfg.BatchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range deliveries {
+		// Don't abandon a delivery halfway through on shutdown
+		dctx := context.WithoutCancel(ctx)
+
+		// Renew the claim before sending, in case earlier deliveries took
+		// longer than expected and another worker has taken this one over
+		claimed, err := models.RenewWebhookDeliveryLease(dctx, d, w.lease())
+		if err != nil {
+			log.Printf("webhooks: %v", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		w.deliver(dctx, d)
+	}
+	return len(deliveries), nil
+}
+
+// lease returns how long a worker holds one delivery: long enough to send it
+// and record the outcome
+func (w *Worker) lease() time.Duration {
+	return 2 * w.cfg.Timeout
+}
+
+// deliver sends one delivery and records the outcome
+func (w *Worker) deliver(ctx context.Context, d models.DueWebhookDelivery) {
+	status, err := w.send(ctx, d)
+	if err == nil {
+		if err := models.MarkWebhookDeliveryDelivered(ctx, d, status); err != nil {
+			log.Printf("webhooks: %v", err)
+		}
+		return
+	}
+
+	var next *time.Time
+	if d.Attempts < w.cfg.MaxAttempts {
+		t := time.Now().Add(w.backoff(d.Attempts))
+		next = &t
+	}
+
+	disabled, dbErr := models.MarkWebhookDeliveryFailed(ctx, d, status, err.Error(), next, w.cfg.DisableAfter)
+	if dbErr != nil {
+		log.Printf("webhooks: %v", dbErr)
+		return
+	}
+
+	if next == nil {
+		log.Printf("webhooks: giving up on delivery %d to webhook %d after %d attempts: %v", d.ID, d.WebhookID, d.Attempts, err)
+	}
+	if disabled {
+		log.Printf("webhooks: disabled webhook %d after %d consecutive failures", d.WebhookID, w.cfg.DisableAfter)
+	}
+}
+
+// send POSTs a signed delivery and returns the response status, or 0 if
+// no response was received. Any 2xx status counts as delivered.
+func (w *Worker) send(ctx context.Context, d models.DueWebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "crud-app-webhooks/1.0")
+	req.Header.Set("X-Webhook-ID", strconv.Itoa(d.WebhookID))
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(d.ID, 10))
+	req.Header.Set("X-Event-ID", strconv.FormatInt(d.EventID, 10))
+	req.Header.Set("X-Event-Type", d.EventType)
+	req.Header.Set(SignatureHeader, Sign(d.Secret, time.Now(), d.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error sending webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay after the given number of failed attempts
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.cfg.RetryBackoff
+	for i := 1; i < attempts && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryBackoff)
+}
@@ -0,0 +1,126 @@
+package webhooks
+
+import (
+	"context"
+	"crud-app/pkg/config"
+	"crud-app/pkg/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testSecret = "whsec_test"
+
+func testDelivery(url string) models.DueWebhookDelivery {
+	return models.DueWebhookDelivery{
+		WebhookDelivery: models.WebhookDelivery{
+			ID:        42,
+			WebhookID: 7,
+			EventID:   1001,
+			EventType: models.EventUserUpdated,
+			Payload:   []byte(`{"id":1001,"type":"user.updated","user_id":3,"data":{"id":"3","name":"Ada"}}`),
+			Attempts:  1,
+		},
+		URL:    url,
+		Secret: testSecret,
+	}
+}
+
+func TestSendSignsDelivery(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		if err := Verify(testSecret, r.Header.Get(SignatureHeader), body, 5*time.Minute); err != nil {
+			t.Errorf("Verify: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		received <- r
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	worker := NewWorker(config.WebhooksConfig{Timeout: time.Second})
+	d := testDelivery(receiver.URL)
+	status, err := worker.send(context.Background(), d)
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if status != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", status, http.StatusNoContent)
+	}
+
+	r := <-received
+	if string(body) != string(d.Payload) {
+		t.Errorf("body = %s, want %s", body, d.Payload)
+	}
+	for header, want := range map[string]string{
+		"Content-Type":       "application/json",
+		"X-Webhook-ID":       "7",
+		"X-Webhook-Delivery": "42",
+		"X-Event-ID":         "1001",
+		"X-Event-Type":       models.EventUserUpdated,
+	} {
+		if got := r.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestSendReportsFailures(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+
+	worker := NewWorker(config.WebhooksConfig{Timeout: time.Second})
+	status, err := worker.send(context.Background(), testDelivery(receiver.URL))
+	if err == nil || status != http.StatusServiceUnavailable {
+		t.Errorf("send = %d, %v; want 503 and an error", status, err)
+	}
+
+	// With the receiver gone there is no status at all
+	receiver.Close()
+	status, err = worker.send(context.Background(), testDelivery(receiver.URL))
+	if err == nil || status != 0 {
+		t.Errorf("send to closed receiver = %d, %v; want 0 and an error", status, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	now := time.Now()
+	header := Sign(testSecret, now, body)
+
+	if err := Verify(testSecret, header, body, time.Minute); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	if err := Verify("whsec_other", header, body, time.Minute); err == nil {
+		t.Error("wrong secret verified")
+	}
+	if err := Verify(testSecret, header, []byte(`{"id":2}`), time.Minute); err == nil {
+		t.Error("tampered body verified")
+	}
+	if err := Verify(testSecret, Sign(testSecret, now.Add(-time.Hour), body), body, time.Minute); err == nil {
+		t.Error("stale signature verified")
+	}
+	if err := Verify(testSecret, "v1=abc", body, 0); err == nil {
+		t.Error("header without timestamp verified")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	worker := NewWorker(config.WebhooksConfig{RetryBackoff: 30 * time.Second})
+	for attempts, want := range map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		5:  8 * time.Minute,
+		20: maxRetryBackoff,
+	} {
+		if got := worker.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
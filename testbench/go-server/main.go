@@ -1,26 +1,38 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"expvar"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 type Server struct {
-	db *sql.DB
+	db          *sql.DB
+	profileStmt *sql.Stmt     // nil when PREPARED_STATEMENTS is false
+	profiles    *profileCache // nil when PROFILE_CACHE_ENABLED is false
 }
 
+// profileQuery is run for every /process request that misses the profile cache
+const profileQuery = "SELECT profile_data FROM users WHERE id = ?"
+
 type Request struct {
 	UserID int    `json:"user_id"`
 	Data   string `json:"data"`
@@ -46,10 +58,16 @@ func (s *Server) preprocessData(data string) string {
 }
 
 // Database I/O operation
-func (s *Server) getUserProfile(userID int) (string, error) {
+func (s *Server) getUserProfile(ctx context.Context, userID int) (string, error) {
+	var row *sql.Row
+	if s.profileStmt != nil {
+		row = s.profileStmt.QueryRowContext(ctx, userID)
+	} else {
+		row = s.db.QueryRowContext(ctx, profileQuery, userID)
+	}
+
 	var profile string
-	query := "SELECT profile_data FROM users WHERE id = ?"
-	err := s.db.QueryRow(query, userID).Scan(&profile)
+	err := row.Scan(&profile)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// Create a mock profile if user doesn't exist
@@ -61,6 +79,14 @@ func (s *Server) getUserProfile(userID int) (string, error) {
 	return profile, nil
 }
 
+// lookupUserProfile reads a profile through the cache, if it is enabled
+func (s *Server) lookupUserProfile(ctx context.Context, userID int) (string, error) {
+	if s.profiles == nil {
+		return s.getUserProfile(ctx, userID)
+	}
+	return s.profiles.get(ctx, userID, s.getUserProfile)
+}
+
 // CPU-intensive postprocessing: simulate complex calculations
 func (s *Server) postprocessData(preprocessed string, profile string) string {
 	combined := preprocessed + profile
@@ -88,18 +114,26 @@ func (s *Server) processHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx := r.Context()
+
 	// Step 1: CPU-bound preprocessing
+	_, span := tracer.Start(ctx, "preprocess")
 	preprocessed := s.preprocessData(req.Data)
+	span.End()
 
 	// Step 2: DB I/O
-	profile, err := s.getUserProfile(req.UserID)
+	dbCtx, span := tracer.Start(ctx, "db.getUserProfile")
+	profile, err := s.lookupUserProfile(dbCtx, req.UserID)
+	span.End()
 	if err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
 	// Step 3: CPU-bound postprocessing
+	_, span = tracer.Start(ctx, "postprocess")
 	finalResult := s.postprocessData(preprocessed, profile)
+	span.End()
 
 	processingTime := time.Since(startTime)
 
@@ -142,7 +176,7 @@ func initDB() (*sql.DB, error) {
 	// Retry connection logic
 	maxRetries := 5
 	for i := 0; i < maxRetries; i++ {
-		db, err = sql.Open("mysql", dsn)
+		db, err = otelsql.Open("mysql", dsn, otelsql.WithAttributes(semconv.DBSystemMySQL))
 		if err != nil {
 			log.Printf("Failed to open database connection (attempt %d/%d): %v", i+1, maxRetries, err)
 			time.Sleep(5 * time.Second)
@@ -199,6 +233,12 @@ func initDB() (*sql.DB, error) {
 }
 
 func main() {
+	// Initialize tracing
+	shutdownTracing, err := initTracing(context.Background())
+	if err != nil {
+		log.Fatal("Failed to initialize tracing:", err)
+	}
+
 	// Initialize database
 	db, err := initDB()
 	if err != nil {
@@ -207,16 +247,45 @@ func main() {
 	defer db.Close()
 
 	// Set connection pool settings for better performance
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(25)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	configurePool(db)
+	publishPoolStats(db)
+	if interval := getEnvDuration("DB_POOL_STATS_INTERVAL", 30*time.Second); interval > 0 {
+		go monitorPool(db, interval)
+	}
 
 	server := &Server{db: db}
+	if getEnv("PREPARED_STATEMENTS", "true") == "true" {
+		// Prepared once here, the statement is re-prepared by database/sql on
+		// each connection it runs on, including ones opened after a reconnect
+		server.profileStmt, err = db.Prepare(profileQuery)
+		if err != nil {
+			log.Fatal("Failed to prepare profile query:", err)
+		}
+		defer server.profileStmt.Close()
+	}
+	if getEnv("PROFILE_CACHE_ENABLED", "true") == "true" {
+		server.profiles = newProfileCache(
+			getEnvInt("PROFILE_CACHE_SIZE", 10000),
+			getEnvDuration("PROFILE_CACHE_TTL", 30*time.Second),
+		)
+	}
 
 	// Set up routes
 	r := mux.NewRouter()
-	r.HandleFunc("/process", server.processHandler).Methods("POST")
+	processHandler := http.HandlerFunc(server.processHandler)
+	if getEnv("RATE_LIMIT_ENABLED", "true") == "true" {
+		// Each /process call burns CPU, so cap it per client
+		limiter := newRateLimiter()
+		processLimit := getEnvRateLimit("RATE_LIMIT_PROCESS", rateLimit{rate: 10, burst: 20})
+		processHandler = limiter.limit("process", processLimit, server.processHandler)
+	}
+	r.HandleFunc("/process", processHandler).Methods("POST")
 	r.HandleFunc("/health", server.healthHandler).Methods("GET")
+	if getEnv("DEBUG_VARS_ENABLED", "false") == "true" {
+		// Profile cache and connection pool stats; leave off where the port is public
+		r.Handle("/debug/vars", expvar.Handler()).Methods("GET")
+	}
+	r.Use(otelmux.Middleware("go-server"))
 
 	// Configure HTTP server
 	srv := &http.Server{
@@ -227,6 +296,30 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	log.Println("Go server starting on :8080")
-	log.Fatal(srv.ListenAndServe())
+	// Serve until SIGINT or SIGTERM, or until the listener fails
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Println("Go server starting on :8080")
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		log.Printf("Server error: %v", err)
+	case <-ctx.Done():
+		log.Println("Shutting down...")
+	}
+
+	// Finish open requests, then flush buffered spans before the deferred
+	// statement and database closes run
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("Error shutting down tracing: %v", err)
+	}
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"database/sql"
+	"expvar"
+	"log"
+	"time"
+)
+
+// configurePool sizes db's connection pool from the environment
+func configurePool(db *sql.DB) {
+	db.SetMaxOpenConns(getEnvInt("DB_MAX_OPEN_CONNS", 25))
+	db.SetMaxIdleConns(getEnvInt("DB_MAX_IDLE_CONNS", 25))
+	db.SetConnMaxLifetime(getEnvDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute))
+	db.SetConnMaxIdleTime(getEnvDuration("DB_CONN_MAX_IDLE_TIME", 0)) // 0 keeps idle connections until their lifetime ends
+}
+
+// publishPoolStats serves db's pool stats at /debug/vars as db_pool
+func publishPoolStats(db *sql.DB) {
+	expvar.Publish("db_pool", expvar.Func(func() interface{} {
+		stats := db.Stats()
+		return map[string]interface{}{
+			"max_open_connections": stats.MaxOpenConnections,
+			"open_connections":     stats.OpenConnections,
+			"in_use":               stats.InUse,
+			"idle":                 stats.Idle,
+			"wait_count":           stats.WaitCount,
+			"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+			"max_idle_closed":      stats.MaxIdleClosed,
+			"max_idle_time_closed": stats.MaxIdleTimeClosed,
+			"max_lifetime_closed":  stats.MaxLifetimeClosed,
+		}
+	}))
+}
+
+// monitorPool logs a warning every interval in which queries had to wait for
+// a free connection, so the pool can be resized
+func monitorPool(db *sql.DB, interval time.Duration) {
+	var last sql.DBStats
+	for range time.Tick(interval) {
+		stats := db.Stats()
+		if waits := stats.WaitCount - last.WaitCount; waits > 0 {
+			waited := stats.WaitDuration - last.WaitDuration
+			log.Printf("Database pool saturated: %d queries waited %v for a connection in the last %v; %d of %d connections in use",
+				waits, waited.Round(time.Millisecond), interval, stats.InUse, stats.MaxOpenConnections)
+		}
+		last = stats
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"expvar"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// profileCacheStats are served at /debug/vars as profile_cache
+var profileCacheStats = expvar.NewMap("profile_cache")
+
+// profileCache is a read-through LRU cache for getUserProfile. Entries expire
+// after ttl, and concurrent misses for the same user share one query.
+type profileCache struct {
+	maxEntries int
+	ttl        time.Duration
+
+	mu       sync.Mutex
+	entries  map[int]*list.Element
+	order    *list.List // Front is the most recently used
+	inflight map[int]*profileLoad
+}
+
+// profileEntry is one cached profile
+type profileEntry struct {
+	userID    int
+	profile   string
+	expiresAt time.Time
+}
+
+// profileLoad is a query that callers missing the same user wait on
+type profileLoad struct {
+	done    chan struct{}
+	profile string
+	err     error
+}
+
+func newProfileCache(maxEntries int, ttl time.Duration) *profileCache {
+	return &profileCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		entries:    map[int]*list.Element{},
+		order:      list.New(),
+		inflight:   map[int]*profileLoad{},
+	}
+}
+
+// get returns the cached profile for userID, or calls load on a miss.
+// Errors are not cached.
+func (c *profileCache) get(ctx context.Context, userID int, load func(context.Context, int) (string, error)) (string, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[userID]; ok {
+		entry := el.Value.(*profileEntry)
+		if time.Now().Before(entry.expiresAt) {
+			c.order.MoveToFront(el)
+			c.mu.Unlock()
+			profileCacheStats.Add("hits", 1)
+			return entry.profile, nil
+		}
+		c.remove(el)
+	}
+	profileCacheStats.Add("misses", 1)
+
+	// Join a query that is already running
+	if l, ok := c.inflight[userID]; ok {
+		c.mu.Unlock()
+		select {
+		case <-l.done:
+			return l.profile, l.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	l := &profileLoad{done: make(chan struct{})}
+	c.inflight[userID] = l
+	c.mu.Unlock()
+
+	// Other callers share this query, so one of them going away mustn't cancel it
+	profileCacheStats.Add("loads", 1)
+	l.profile, l.err = load(context.WithoutCancel(ctx), userID)
+
+	c.mu.Lock()
+	delete(c.inflight, userID)
+	if l.err == nil {
+		c.set(userID, l.profile)
+	}
+	c.mu.Unlock()
+	close(l.done)
+
+	return l.profile, l.err
+}
+
+// set stores profile, evicting the least recently used entry if full. c.mu must be held.
+func (c *profileCache) set(userID int, profile string) {
+	expiresAt := time.Now().Add(c.ttl)
+	if el, ok := c.entries[userID]; ok {
+		entry := el.Value.(*profileEntry)
+		entry.profile, entry.expiresAt = profile, expiresAt
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[userID] = c.order.PushFront(&profileEntry{userID: userID, profile: profile, expiresAt: expiresAt})
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *profileCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*profileEntry).userID)
+}
+
+// getEnvInt reads an integer from the environment, falling back to defaultValue
+func getEnvInt(key string, defaultValue int) int {
+	if n, err := strconv.Atoi(getEnv(key, "")); err == nil {
+		return n
+	}
+	return defaultValue
+}
+
+// getEnvDuration reads a duration such as "30s" from the environment
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if d, err := time.ParseDuration(getEnv(key, "")); err == nil {
+		return d
+	}
+	return defaultValue
+}
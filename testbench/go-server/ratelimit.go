@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimit is a token bucket: requests refill at rate per second, up to burst
+type rateLimit struct {
+	rate  float64
+	burst int
+}
+
+// bucket is the state of one client's token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps token buckets in memory, keyed by route and client
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: map[string]*bucket{}, lastSweep: time.Now()}
+}
+
+// take removes a token from the bucket for key. It returns whether the request
+// is allowed, the whole tokens left, and how long until a token is available.
+func (rl *rateLimiter) take(key string, limit rateLimit) (bool, int, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+
+	// Drop idle buckets now and then so the map doesn't grow forever
+	if now.Sub(rl.lastSweep) > time.Minute {
+		for k, b := range rl.buckets {
+			if now.Sub(b.last) > time.Minute {
+				delete(rl.buckets, k)
+			}
+		}
+		rl.lastSweep = now
+	}
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.burst), last: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(limit.burst), b.tokens+now.Sub(b.last).Seconds()*limit.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / limit.rate * float64(time.Second))
+		return false, 0, wait
+	}
+	b.tokens--
+	return true, int(b.tokens), 0
+}
+
+// limit wraps a handler with a per-client limit for the named route
+func (rl *rateLimiter) limit(name string, limit rateLimit, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		allowed, remaining, wait := rl.take(name+":"+clientKey(r), limit)
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Rate limit exceeded"})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// clientKey identifies the caller by IP. Headers such as X-API-Key are not
+// checked by this server, so keying on them would let a client reset its
+// limit by sending a new value with each request.
+func clientKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// getEnvRateLimit parses a "rate,burst" value such as "10,20"
+func getEnvRateLimit(key string, defaultValue rateLimit) rateLimit {
+	rate, burst, ok := strings.Cut(getEnv(key, ""), ",")
+	if !ok {
+		return defaultValue
+	}
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil || r <= 0 {
+		return defaultValue
+	}
+	b, err := strconv.Atoi(burst)
+	if err != nil || b < 1 {
+		return defaultValue
+	}
+	return rateLimit{rate: r, burst: b}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestRotatingAPIKeyDoesNotResetLimit(t *testing.T) {
+	limiter := newRateLimiter()
+	handler := limiter.limit("process", rateLimit{rate: 0.001, burst: 2}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	var codes []int
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("POST", "/process", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-API-Key", "key-"+strconv.Itoa(i))
+		w := httptest.NewRecorder()
+		handler(w, req)
+		codes = append(codes, w.Code)
+	}
+
+	want := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("statuses = %v, want %v", codes, want)
+		}
+	}
+}
+
+func TestClientsHaveSeparateLimits(t *testing.T) {
+	limiter := newRateLimiter()
+	handler := limiter.limit("process", rateLimit{rate: 0.001, burst: 1}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, addr := range []string{"192.0.2.1:1234", "192.0.2.2:1234"} {
+		req := httptest.NewRequest("POST", "/process", nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("first request from %s: status %d, want %d", addr, w.Code, http.StatusOK)
+		}
+	}
+}